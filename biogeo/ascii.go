@@ -0,0 +1,221 @@
+// Copyright (c) 2015, J. Salvador Arias <jsalarias@csnat.unt.edu.ar>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package biogeo
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/js-arias/evs/bitfield"
+)
+
+// A Presence is a presence map of a taxon (e.g. the output of a species
+// distribution model), stored as a regular grid in geographic coordinates
+// in which each cell is either occupied or empty.
+type Presence struct {
+	Cols   int
+	Rows   int
+	MinLon float64 // longitude of the lower left corner
+	MinLat float64 // latitude of the lower left corner
+	Size   float64 // size of the cells, in degrees
+
+	// occupied cells, by rows, starting from the top row
+	Cells bitfield.Bitfield
+}
+
+// ReadASCII reads a presence map from an input stream with an ESRI ASCII
+// grid. The cells with a value greater than or equal to threshold are
+// occupied, the cells with lower values or without data are empty.
+func ReadASCII(in io.Reader, threshold float64) (*Presence, error) {
+	sc := bufio.NewScanner(in)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	sc.Split(bufio.ScanWords)
+
+	// reads the header
+	p := &Presence{}
+	noData := math.NaN()
+	center := false
+	var word string
+	for {
+		if !sc.Scan() {
+			if err := sc.Err(); err != nil {
+				return nil, fmt.Errorf("header (ascii): %v", err)
+			}
+			return nil, errors.New("header (ascii): incomplete header")
+		}
+		key := strings.ToLower(sc.Text())
+		if (len(key) > 0) && ((key[0] == '-') || (key[0] == '.') || ((key[0] >= '0') && (key[0] <= '9'))) {
+			// first value
+			word = sc.Text()
+			break
+		}
+		if !sc.Scan() {
+			return nil, fmt.Errorf("header (ascii): undefined value for %s", key)
+		}
+		v, err := strconv.ParseFloat(sc.Text(), 64)
+		if err != nil {
+			return nil, fmt.Errorf("header (ascii): %s: %v", key, err)
+		}
+		switch key {
+		case "ncols":
+			p.Cols = int(v)
+		case "nrows":
+			p.Rows = int(v)
+		case "xllcorner":
+			p.MinLon = v
+		case "xllcenter":
+			p.MinLon = v
+			center = true
+		case "yllcorner":
+			p.MinLat = v
+		case "yllcenter":
+			p.MinLat = v
+			center = true
+		case "cellsize":
+			p.Size = v
+		case "nodata_value":
+			noData = v
+		default:
+			return nil, fmt.Errorf("header (ascii): unknown key %s", key)
+		}
+	}
+	if (p.Cols <= 0) || (p.Rows <= 0) || (p.Size <= 0) {
+		return nil, errors.New("header (ascii): incomplete header")
+	}
+	if center {
+		p.MinLon -= p.Size / 2
+		p.MinLat -= p.Size / 2
+	}
+
+	// reads the values
+	n := p.Cols * p.Rows
+	p.Cells = bitfield.New(n)
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			if !sc.Scan() {
+				if err := sc.Err(); err != nil {
+					return nil, fmt.Errorf("(ascii) cell %d: %v", i, err)
+				}
+				return nil, fmt.Errorf("(ascii): expecting %d cells, found %d", n, i)
+			}
+			word = sc.Text()
+		}
+		v, err := strconv.ParseFloat(word, 64)
+		if err != nil {
+			return nil, fmt.Errorf("(ascii) cell %d: %v", i, err)
+		}
+		if (v == noData) || (v < threshold) {
+			continue
+		}
+		p.Cells.PutOn(i)
+	}
+	return p, nil
+}
+
+// Bounds returns the bounding box of a cell of the presence map.
+func (p *Presence) Bounds(cell int) (minLon, minLat, maxLon, maxLat float64) {
+	c := cell % p.Cols
+	r := cell / p.Cols
+	minLon = p.MinLon + (float64(c) * p.Size)
+	maxLat = p.MinLat + (float64(p.Rows-r) * p.Size)
+	return minLon, maxLat - p.Size, minLon + p.Size, maxLat
+}
+
+// DefaultThreshold is the threshold used for presence maps without a
+// defined threshold.
+const DefaultThreshold = 0.5
+
+// ReadManifest reads a manifest of presence maps from an input stream in
+// tsv format, and reads the presence maps. The manifest must have the
+// columns 'Name' with the name of the taxon, and 'File' with the name of
+// an ESRI ASCII grid file; file names are relative to dir. Optionally, a
+// column 'Threshold' can be used to define the threshold of each map (by
+// default, DefaultThreshold).
+func ReadManifest(in io.Reader, dir string) (*DataSet, error) {
+	r := csv.NewReader(in)
+	r.Comma = '\t'
+
+	// reads the file header
+	h, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("header (manifest): %v", err)
+	}
+	name := -1
+	file := -1
+	thr := -1
+	for i, v := range h {
+		switch strings.ToLower(strings.TrimSpace(v)) {
+		case "name", "scientificname", "scientific name":
+			name = i
+		case "file", "map":
+			file = i
+		case "threshold":
+			thr = i
+		}
+	}
+	if (name < 0) || (file < 0) {
+		return nil, errors.New("header (manifest): incomplete header")
+	}
+
+	// reads the data
+	d := &DataSet{Names: make(map[string]*Taxon)}
+	for i := 1; ; i++ {
+		row, err := r.Read()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, fmt.Errorf("(manifest) row %d: %v", i, err)
+		}
+		// leading spaces are not trimmed by the csv reader, as the
+		// tab is also a space, and empty fields will be lost
+		for j := range row {
+			row[j] = strings.TrimSpace(row[j])
+		}
+		if lr := len(row); (lr <= name) || (lr <= file) {
+			continue
+		}
+		nm := strings.Join(strings.Fields(row[name]), " ")
+		if (len(nm) == 0) || (len(row[file]) == 0) {
+			continue
+		}
+		th := DefaultThreshold
+		if (thr >= 0) && (thr < len(row)) && (len(row[thr]) > 0) {
+			th, err = strconv.ParseFloat(row[thr], 64)
+			if err != nil {
+				return nil, fmt.Errorf("(manifest) row %d, col %d: %v", i, thr+1, err)
+			}
+		}
+		fn := row[file]
+		if !filepath.IsAbs(fn) {
+			fn = filepath.Join(dir, fn)
+		}
+		f, err := os.Open(fn)
+		if err != nil {
+			return nil, fmt.Errorf("(manifest) row %d: %v", i, err)
+		}
+		p, err := ReadASCII(f, th)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("(manifest) row %d: %s: %v", i, row[file], err)
+		}
+		t, ok := d.Names[strings.ToLower(nm)]
+		if !ok {
+			t = &Taxon{Name: nm}
+			d.Names[strings.ToLower(nm)] = t
+			d.Ls = append(d.Ls, t)
+		}
+		t.Maps = append(t.Maps, p)
+	}
+	return d, nil
+}
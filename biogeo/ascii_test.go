@@ -0,0 +1,86 @@
+// Copyright (c) 2015, J. Salvador Arias <jsalarias@csnat.unt.edu.ar>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package biogeo
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadASCII(t *testing.T) {
+	data := `ncols 4
+nrows 3
+xllcenter -69.5
+yllcenter -29.5
+cellsize 1
+NODATA_value -9999
+0.1 0.7 -9999 1
+0 0.5 0.2 0.9
+-9999 -9999 0.6 0
+`
+	p, err := ReadASCII(strings.NewReader(data), 0.5)
+	if err != nil {
+		t.Fatalf("read error: %v", err)
+	}
+	if (p.Cols != 4) || (p.Rows != 3) || (p.MinLon != -70) || (p.MinLat != -30) || (p.Size != 1) {
+		t.Errorf("header error: found %d cols, %d rows, corner %.2f %.2f, size %.2f", p.Cols, p.Rows, p.MinLon, p.MinLat, p.Size)
+	}
+	want := []int{1, 3, 5, 7, 10}
+	got := p.Cells.Bits()
+	if len(got) != len(want) {
+		t.Fatalf("cells error: expecting %v, found %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("cells error: expecting %v, found %v", want, got)
+			break
+		}
+	}
+	minLon, minLat, maxLon, maxLat := p.Bounds(1)
+	if (minLon != -69) || (maxLon != -68) || (minLat != -28) || (maxLat != -27) {
+		t.Errorf("bounds error: found %.2f %.2f %.2f %.2f", minLon, minLat, maxLon, maxLat)
+	}
+
+	if _, err := ReadASCII(strings.NewReader("ncols 2\nnrows 2\nxllcorner 0\nyllcorner 0\ncellsize 1\n1 1 1\n"), 0.5); err == nil {
+		t.Errorf("read error: expecting error on incomplete data")
+	}
+}
+
+func TestReadManifest(t *testing.T) {
+	dir := t.TempDir()
+	grid := "ncols 2\nnrows 1\nxllcorner 0\nyllcorner 0\ncellsize 1\n0.4 0.8\n"
+	for _, fn := range []string{"a.asc", "b.asc"} {
+		if err := os.WriteFile(filepath.Join(dir, fn), []byte(grid), 0644); err != nil {
+			t.Fatalf("write error: %v", err)
+		}
+	}
+	// an empty threshold in a middle column
+	data := "Name\tThreshold\tFile\r\n" +
+		"Aus bus\t\ta.asc\r\n" +
+		"Cus dus\t0.3\tb.asc\r\n"
+	d, err := ReadManifest(strings.NewReader(data), dir)
+	if err != nil {
+		t.Fatalf("read error: %v", err)
+	}
+	tests := []struct {
+		name  string
+		cells int
+	}{
+		{"Aus bus", 1}, // default threshold
+		{"Cus dus", 2},
+	}
+	for _, tc := range tests {
+		tx := d.Taxon(tc.name)
+		if (tx == nil) || (len(tx.Maps) != 1) {
+			t.Errorf("manifest error: expecting a map of %s", tc.name)
+			continue
+		}
+		if n := tx.Maps[0].Cells.Count(); n != tc.cells {
+			t.Errorf("manifest error: %s: expecting %d cells, found %d", tc.name, tc.cells, n)
+		}
+	}
+}
@@ -9,6 +9,8 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
+	"sort"
 	"strconv"
 	"strings"
 )
@@ -21,10 +23,32 @@ const (
 	MaxLat = 90
 )
 
+// EarthRadius is the mean radius of the Earth, in km.
+const EarthRadius = 6371.0088
+
+// Distance returns the great circle distance, in km, between two
+// geographic points, using the haversine formula.
+func Distance(lon1, lat1, lon2, lat2 float64) float64 {
+	la1 := lat1 * math.Pi / 180
+	la2 := lat2 * math.Pi / 180
+	dLat := la2 - la1
+	dLon := (lon2 - lon1) * math.Pi / 180
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(la1)*math.Cos(la2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	if h > 1 {
+		h = 1
+	}
+	return 2 * EarthRadius * math.Asin(math.Sqrt(h))
+}
+
 // A GeoRef is a georeferenced record.
 type GeoRef struct {
 	Catalog  string
 	Lon, Lat float64
+	Uncert   float64 // coordinate uncertainty, in meters (0 if unknown)
+
+	// additional attributes of the record (e.g. date, source), as a map
+	// of column name to value
+	Attrs map[string]string
 }
 
 // IsValid returns true if the GeoRef is a valid geographic point.
@@ -38,16 +62,21 @@ func (g GeoRef) IsValid() bool {
 	return true
 }
 
-// A Taxon is a named terminal taxon with a list of georeferenced records.
+// A Taxon is a named terminal taxon with a list of georeferenced records,
+// and optionally, a list of range polygons and presence maps.
 type Taxon struct {
-	Name string
-	Recs []GeoRef
+	Name  string
+	Recs  []GeoRef
+	Polys []Polygon
+	Maps  []*Presence
 }
 
 // A DataSet is a biogeography data set.
 type DataSet struct {
-	Ls    []*Taxon          // list of taxons, as found
-	Names map[string]*Taxon // a map of name (in lower caps) to taxon
+	Ls     []*Taxon          // list of taxons, as found
+	Names  map[string]*Taxon // a map of name (in lower caps) to taxon
+	Region *Region           // area of the data set (if restricted)
+	Attrs  []string          // names of the attribute columns, as found
 }
 
 // Taxon returns a taxon of a given name.
@@ -60,12 +89,46 @@ func (d *DataSet) Taxon(name string) *Taxon {
 	return nil
 }
 
+// Merge adds the records, polygons and presence maps of the taxa of o to
+// the dataset.
+func (d *DataSet) Merge(o *DataSet) {
+	if d.Names == nil {
+		d.Names = make(map[string]*Taxon)
+	}
+	for _, a := range o.Attrs {
+		found := false
+		for _, da := range d.Attrs {
+			if da == a {
+				found = true
+				break
+			}
+		}
+		if !found {
+			d.Attrs = append(d.Attrs, a)
+		}
+	}
+	for _, ot := range o.Ls {
+		t, ok := d.Names[strings.ToLower(ot.Name)]
+		if !ok {
+			t = &Taxon{Name: ot.Name}
+			d.Names[strings.ToLower(t.Name)] = t
+			d.Ls = append(d.Ls, t)
+		}
+		t.Recs = append(t.Recs, ot.Recs...)
+		t.Polys = append(t.Polys, ot.Polys...)
+		t.Maps = append(t.Maps, ot.Maps...)
+	}
+}
+
 // Read reads data from an input stream in tsv format.
 func Read(in io.Reader) (*DataSet, error) {
 	d := &DataSet{Names: make(map[string]*Taxon)}
 	r := csv.NewReader(in)
 	r.Comma = '\t'
-	r.TrimLeadingSpace = true
+
+	// leading spaces are not trimmed by the csv reader, as the tab is
+	// also a space, and empty fields will be lost; instead, each field
+	// is trimmed by hand when it is read (as in tree.Read)
 
 	// reads the file header
 	h, err := r.Read()
@@ -76,7 +139,10 @@ func Read(in io.Reader) (*DataSet, error) {
 	lon := -1
 	lat := -1
 	cat := -1
+	unc := -1
+	attrs := make(map[int]string)
 	for i, v := range h {
+		v = strings.TrimSpace(v)
 		switch strings.ToLower(v) {
 		case "name", "scientificname", "scientific name":
 			name = i
@@ -86,6 +152,14 @@ func Read(in io.Reader) (*DataSet, error) {
 			lat = i
 		case "catalog", "recordid", "record id":
 			cat = i
+		case "uncertainty", "coordinateuncertaintyinmeters":
+			unc = i
+		default:
+			if len(v) == 0 {
+				continue
+			}
+			attrs[i] = v
+			d.Attrs = append(d.Attrs, v)
 		}
 	}
 	if (name < 0) || (lon < 0) || (lat < 0) {
@@ -111,17 +185,17 @@ func Read(in io.Reader) (*DataSet, error) {
 			d.Names[strings.ToLower(nm)] = t
 			d.Ls = append(d.Ls, t)
 		}
-		lgv, err := strconv.ParseFloat(row[lon], 64)
+		lgv, err := strconv.ParseFloat(strings.TrimSpace(row[lon]), 64)
 		if err != nil {
 			return nil, fmt.Errorf("(data) row %d, col %d: %v", i, lon+1, err)
 		}
-		ltv, err := strconv.ParseFloat(row[lat], 64)
+		ltv, err := strconv.ParseFloat(strings.TrimSpace(row[lat]), 64)
 		if err != nil {
 			return nil, fmt.Errorf("(data) row %d, col %d: %v", i, lat+1, err)
 		}
 		var cv string
 		if (cat >= 0) && (cat < len(row)) {
-			cv = row[cat]
+			cv = strings.TrimSpace(row[cat])
 		}
 		g := GeoRef{
 			Lon:     lgv,
@@ -131,7 +205,135 @@ func Read(in io.Reader) (*DataSet, error) {
 		if !g.IsValid() {
 			return nil, fmt.Errorf("(data) row %d: invalid georeference", i)
 		}
+		if (unc >= 0) && (unc < len(row)) && (len(strings.TrimSpace(row[unc])) > 0) {
+			g.Uncert, err = strconv.ParseFloat(strings.TrimSpace(row[unc]), 64)
+			if err != nil {
+				return nil, fmt.Errorf("(data) row %d, col %d: %v", i, unc+1, err)
+			}
+			if g.Uncert < 0 {
+				return nil, fmt.Errorf("(data) row %d, col %d: negative uncertainty", i, unc+1)
+			}
+		}
+		for c, a := range attrs {
+			if c >= len(row) {
+				continue
+			}
+			v := strings.TrimSpace(row[c])
+			if len(v) == 0 {
+				continue
+			}
+			if g.Attrs == nil {
+				g.Attrs = make(map[string]string)
+			}
+			g.Attrs[a] = v
+		}
 		t.Recs = append(t.Recs, g)
 	}
 	return d, nil
 }
+
+// Write writes a dataset as csv into an output stream. If any record has a
+// coordinate uncertainty, it is written in the column 'Uncertainty'. The
+// attributes of the records are written as additional columns, in the
+// order of the Attrs field of the dataset, followed by any other attribute
+// in alphabetical order.
+func (d *DataSet) Write(out io.Writer) error {
+	w := csv.NewWriter(out)
+	w.Comma = '\t'
+	w.UseCRLF = true
+	unc := d.HasUncert()
+	h := []string{"Name", "Longitude", "Latitude", "Catalog"}
+	if unc {
+		h = append(h, "Uncertainty")
+	}
+	attrs := d.attrCols()
+	if err := w.Write(append(h, attrs...)); err != nil {
+		return err
+	}
+	for _, t := range d.Ls {
+		for _, g := range t.Recs {
+			rec := []string{
+				t.Name,
+				strconv.FormatFloat(g.Lon, 'f', -1, 64),
+				strconv.FormatFloat(g.Lat, 'f', -1, 64),
+				g.Catalog,
+			}
+			if unc {
+				u := ""
+				if g.Uncert > 0 {
+					u = strconv.FormatFloat(g.Uncert, 'f', -1, 64)
+				}
+				rec = append(rec, u)
+			}
+			for _, a := range attrs {
+				rec = append(rec, g.Attrs[a])
+			}
+			if err := w.Write(rec); err != nil {
+				return err
+			}
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// HasUncert returns true if a record of the dataset has a coordinate
+// uncertainty.
+func (d *DataSet) HasUncert() bool {
+	for _, t := range d.Ls {
+		for _, g := range t.Recs {
+			if g.Uncert > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// FilterUncert returns a new data set without the records with a
+// coordinate uncertainty greater than max (in meters). Taxa without
+// records, range polygons or presence maps are removed.
+func (d *DataSet) FilterUncert(max float64) *DataSet {
+	nd := &DataSet{
+		Names:  make(map[string]*Taxon),
+		Region: d.Region,
+		Attrs:  d.Attrs,
+	}
+	for _, t := range d.Ls {
+		nt := &Taxon{Name: t.Name, Polys: t.Polys, Maps: t.Maps}
+		for _, g := range t.Recs {
+			if g.Uncert <= max {
+				nt.Recs = append(nt.Recs, g)
+			}
+		}
+		if (len(nt.Recs) == 0) && (len(nt.Polys) == 0) && (len(nt.Maps) == 0) {
+			continue
+		}
+		nd.Names[strings.ToLower(nt.Name)] = nt
+		nd.Ls = append(nd.Ls, nt)
+	}
+	return nd
+}
+
+// attrCols returns the names of the attribute columns of a dataset.
+func (d *DataSet) attrCols() []string {
+	cols := append([]string{}, d.Attrs...)
+	found := make(map[string]bool)
+	for _, a := range d.Attrs {
+		found[a] = true
+	}
+	var other []string
+	for _, t := range d.Ls {
+		for _, g := range t.Recs {
+			for a := range g.Attrs {
+				if found[a] {
+					continue
+				}
+				found[a] = true
+				other = append(other, a)
+			}
+		}
+	}
+	sort.Strings(other)
+	return append(cols, other...)
+}
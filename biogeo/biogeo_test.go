@@ -0,0 +1,148 @@
+// Copyright (c) 2015, J. Salvador Arias <jsalarias@csnat.unt.edu.ar>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package biogeo
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestReadWrite(t *testing.T) {
+	data := "Name\tDate\tLongitude\tLatitude\tCatalog\tSource\r\n" +
+		"Aus bus\t1998-03-02\t-65.2\t-26.8\tMACN 1\tfield\r\n" +
+		"Aus bus\t\t-64\t-27\t\tGBIF\r\n" +
+		"Cus dus\t2001\t10.125\t45\tMLP 3\t\r\n"
+	d, err := Read(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("read error: %v", err)
+	}
+	if len(d.Attrs) != 2 || (d.Attrs[0] != "Date") || (d.Attrs[1] != "Source") {
+		t.Errorf("attributes error: expecting [Date Source], found %v", d.Attrs)
+	}
+	g := d.Taxon("Aus bus").Recs[0]
+	if (g.Attrs["Date"] != "1998-03-02") || (g.Attrs["Source"] != "field") {
+		t.Errorf("attributes error: found %v", g.Attrs)
+	}
+	if _, ok := d.Taxon("Aus bus").Recs[1].Attrs["Date"]; ok {
+		t.Errorf("attributes error: empty value stored")
+	}
+
+	var buf bytes.Buffer
+	if err := d.Write(&buf); err != nil {
+		t.Fatalf("write error: %v", err)
+	}
+	want := "Name\tLongitude\tLatitude\tCatalog\tDate\tSource\r\n" +
+		"Aus bus\t-65.2\t-26.8\tMACN 1\t1998-03-02\tfield\r\n" +
+		"Aus bus\t-64\t-27\t\t\tGBIF\r\n" +
+		"Cus dus\t10.125\t45\tMLP 3\t2001\t\r\n"
+	if buf.String() != want {
+		t.Errorf("write error: expecting\n%s\nfound\n%s", want, buf.String())
+	}
+
+	// the output is read back as the same data set
+	nd, err := Read(strings.NewReader(buf.String()))
+	if err != nil {
+		t.Fatalf("read error: %v", err)
+	}
+	if len(nd.Ls) != len(d.Ls) {
+		t.Fatalf("round-trip error: expecting %d taxa, found %d", len(d.Ls), len(nd.Ls))
+	}
+	for i, tx := range d.Ls {
+		ntx := nd.Ls[i]
+		if (ntx.Name != tx.Name) || (len(ntx.Recs) != len(tx.Recs)) {
+			t.Fatalf("round-trip error: taxon %s", tx.Name)
+		}
+		for j, g := range tx.Recs {
+			ng := ntx.Recs[j]
+			if (ng.Lon != g.Lon) || (ng.Lat != g.Lat) || (ng.Catalog != g.Catalog) || (len(ng.Attrs) != len(g.Attrs)) {
+				t.Errorf("round-trip error: taxon %s, record %d: expecting %v, found %v", tx.Name, j, g, ng)
+				continue
+			}
+			for k, v := range g.Attrs {
+				if ng.Attrs[k] != v {
+					t.Errorf("round-trip error: taxon %s, record %d, attribute %s: expecting %q, found %q", tx.Name, j, k, v, ng.Attrs[k])
+				}
+			}
+		}
+	}
+}
+
+func TestWriteAttrs(t *testing.T) {
+	// attributes not listed in the data set are written in alphabetical
+	// order
+	d := &DataSet{
+		Ls: []*Taxon{
+			{Name: "Aus bus", Recs: []GeoRef{
+				{Lon: 1, Lat: 2, Attrs: map[string]string{"Source": "x"}},
+				{Lon: 3, Lat: 4, Attrs: map[string]string{"Date": "2000"}},
+			}},
+		},
+	}
+	var buf bytes.Buffer
+	if err := d.Write(&buf); err != nil {
+		t.Fatalf("write error: %v", err)
+	}
+	h := strings.SplitN(buf.String(), "\r\n", 2)[0]
+	if h != "Name\tLongitude\tLatitude\tCatalog\tDate\tSource" {
+		t.Errorf("header error: found %q", h)
+	}
+}
+
+func TestUncert(t *testing.T) {
+	data := "Name\tLongitude\tLatitude\tcoordinateUncertaintyInMeters\r\n" +
+		"Aus bus\t-65.2\t-26.8\t5000\r\n" +
+		"Aus bus\t-64\t-27\t\r\n" +
+		"Cus dus\t10\t45\t50000\r\n"
+	d, err := Read(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("read error: %v", err)
+	}
+	if u := d.Taxon("Aus bus").Recs[0].Uncert; u != 5000 {
+		t.Errorf("uncertainty error: expecting 5000, found %.0f", u)
+	}
+	var buf bytes.Buffer
+	if err := d.Write(&buf); err != nil {
+		t.Fatalf("write error: %v", err)
+	}
+	want := "Name\tLongitude\tLatitude\tCatalog\tUncertainty\r\n" +
+		"Aus bus\t-65.2\t-26.8\t\t5000\r\n" +
+		"Aus bus\t-64\t-27\t\t\r\n" +
+		"Cus dus\t10\t45\t\t50000\r\n"
+	if buf.String() != want {
+		t.Errorf("write error: expecting\n%s\nfound\n%s", want, buf.String())
+	}
+
+	nd := d.FilterUncert(10000)
+	if (len(nd.Ls) != 1) || (len(nd.Ls[0].Recs) != 2) {
+		t.Errorf("filter error: expecting 2 records of Aus bus")
+	}
+}
+
+func TestMergeUncert(t *testing.T) {
+	// a file without an uncertainty column
+	data := "Name\tLongitude\tLatitude\tCatalog\r\n" +
+		"Aus bus\t-65.2\t-26.8\tMACN 1\r\n"
+	d, err := Read(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("read error: %v", err)
+	}
+	o := &DataSet{
+		Ls: []*Taxon{
+			{Name: "Bus cus", Recs: []GeoRef{{Lon: -50, Lat: -10, Catalog: "x1", Uncert: 5000}}},
+		},
+	}
+	d.Merge(o)
+	var buf bytes.Buffer
+	if err := d.Write(&buf); err != nil {
+		t.Fatalf("write error: %v", err)
+	}
+	want := "Name\tLongitude\tLatitude\tCatalog\tUncertainty\r\n" +
+		"Aus bus\t-65.2\t-26.8\tMACN 1\t\r\n" +
+		"Bus cus\t-50\t-10\tx1\t5000\r\n"
+	if buf.String() != want {
+		t.Errorf("write error: expecting\n%s\nfound\n%s", want, buf.String())
+	}
+}
@@ -0,0 +1,202 @@
+// Copyright (c) 2015, J. Salvador Arias <jsalarias@csnat.unt.edu.ar>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package biogeo
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Cleaning tests.
+const (
+	DupTest       = "duplicate"
+	ZeroTest      = "zero"
+	EqualTest     = "equal"
+	OutlierTest   = "outlier"
+	PrecisionTest = "precision"
+)
+
+// CleanOptions are the tests used to clean a dataset.
+type CleanOptions struct {
+	// If true, records of a taxon with the same coordinates are removed.
+	Dup bool
+
+	// If greater than 0, records of a taxon in the same cell of a grid
+	// of DupResol degrees are removed.
+	DupResol float64
+
+	// If true, records at 0, 0 are removed.
+	Zero bool
+
+	// If true, records with the same value for latitude and longitude
+	// are removed.
+	Equal bool
+
+	// If greater than 0, records at a distance from the centroid of the
+	// taxon greater than the median distance plus Outlier times the
+	// (scaled) median absolute deviation are removed. Only taxa with at
+	// least OutlierMin records are tested.
+	Outlier    float64
+	OutlierMin int
+
+	// If greater than 0, records with coordinates with less than
+	// Precision decimals are removed. Only significant decimals are
+	// counted: the trailing zeros of a coordinate are not stored (e.g.
+	// -34.600 is read as -34.6, with one decimal).
+	Precision int
+}
+
+// DefaultCleanOptions returns the default cleaning tests.
+func DefaultCleanOptions() *CleanOptions {
+	return &CleanOptions{
+		Dup:        true,
+		Zero:       true,
+		Equal:      true,
+		OutlierMin: 5,
+	}
+}
+
+// An Issue is a record flagged by a cleaning test.
+type Issue struct {
+	Taxon string
+	Rec   GeoRef
+	Test  string
+}
+
+// Clean returns a new dataset without the records flagged by the cleaning
+// tests, and the list of flagged records. Each record is flagged only by
+// the first failed test, in the order: zero, equal, precision, duplicate,
+// and outlier. Taxa without records are not included in the cleaned
+// dataset.
+func Clean(d *DataSet, opt *CleanOptions) (*DataSet, []Issue) {
+	nd := &DataSet{
+		Names: make(map[string]*Taxon),
+		Attrs: d.Attrs,
+	}
+	var iss []Issue
+	for _, t := range d.Ls {
+		var recs []GeoRef
+		dups := make(map[[2]float64]bool)
+		for _, g := range t.Recs {
+			test := ""
+			switch {
+			case opt.Zero && (g.Lon == 0) && (g.Lat == 0):
+				test = ZeroTest
+			case opt.Equal && (g.Lon == g.Lat):
+				test = EqualTest
+			case (opt.Precision > 0) && ((decimals(g.Lon) < opt.Precision) || (decimals(g.Lat) < opt.Precision)):
+				test = PrecisionTest
+			case opt.Dup || (opt.DupResol > 0):
+				k := [2]float64{g.Lon, g.Lat}
+				if opt.DupResol > 0 {
+					k[0] = math.Floor((g.Lon - MinLon) / opt.DupResol)
+					k[1] = math.Floor((MaxLat - g.Lat) / opt.DupResol)
+				}
+				if dups[k] {
+					test = DupTest
+				}
+				dups[k] = true
+			}
+			if len(test) > 0 {
+				iss = append(iss, Issue{Taxon: t.Name, Rec: g, Test: test})
+				continue
+			}
+			recs = append(recs, g)
+		}
+		if (opt.Outlier > 0) && (len(recs) >= opt.OutlierMin) {
+			var out []GeoRef
+			recs, out = outliers(recs, opt.Outlier)
+			for _, g := range out {
+				iss = append(iss, Issue{Taxon: t.Name, Rec: g, Test: OutlierTest})
+			}
+		}
+		if len(recs) == 0 {
+			continue
+		}
+		nt := &Taxon{Name: t.Name, Recs: recs}
+		nd.Ls = append(nd.Ls, nt)
+		nd.Names[strings.ToLower(nt.Name)] = nt
+	}
+	return nd, iss
+}
+
+// outliers separates the records at a distance from the centroid greater
+// than the median distance plus k times the scaled median absolute
+// deviation.
+func outliers(recs []GeoRef, k float64) (in, out []GeoRef) {
+	lon, lat, ok := centroid(recs)
+	if !ok {
+		return recs, nil
+	}
+	dist := make([]float64, len(recs))
+	for i, g := range recs {
+		dist[i] = Distance(lon, lat, g.Lon, g.Lat)
+	}
+	med := median(dist)
+	dev := make([]float64, len(dist))
+	for i, v := range dist {
+		dev[i] = math.Abs(v - med)
+	}
+	// 1.4826 scales the median absolute deviation to be comparable
+	// with the standard deviation of a normal distribution.
+	mad := 1.4826 * median(dev)
+	if mad == 0 {
+		return recs, nil
+	}
+	max := med + (k * mad)
+	for i, g := range recs {
+		if dist[i] > max {
+			out = append(out, g)
+			continue
+		}
+		in = append(in, g)
+	}
+	return in, out
+}
+
+// centroid returns the geographic centroid of a set of records. If the
+// centroid is undefined (e.g. with antipodal points) it returns false.
+func centroid(recs []GeoRef) (lon, lat float64, ok bool) {
+	var x, y, z float64
+	for _, g := range recs {
+		la := g.Lat * math.Pi / 180
+		lo := g.Lon * math.Pi / 180
+		x += math.Cos(la) * math.Cos(lo)
+		y += math.Cos(la) * math.Sin(lo)
+		z += math.Sin(la)
+	}
+	n := math.Sqrt(x*x + y*y + z*z)
+	if n < 1e-9 {
+		return 0, 0, false
+	}
+	lat = math.Asin(z/n) * 180 / math.Pi
+	lon = math.Atan2(y, x) * 180 / math.Pi
+	return lon, lat, true
+}
+
+// median returns the median of a set of values. The values are sorted in
+// place.
+func median(v []float64) float64 {
+	sort.Float64s(v)
+	n := len(v)
+	if n%2 == 1 {
+		return v[n/2]
+	}
+	return (v[n/2-1] + v[n/2]) / 2
+}
+
+// decimals returns the number of significant decimals of a coordinate.
+// Trailing zeros are not counted, as they are lost when the coordinate is
+// read (and they are not written in the records file).
+func decimals(v float64) int {
+	s := strconv.FormatFloat(v, 'f', -1, 64)
+	i := strings.IndexByte(s, '.')
+	if i < 0 {
+		return 0
+	}
+	return len(s) - i - 1
+}
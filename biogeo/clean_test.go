@@ -0,0 +1,72 @@
+// Copyright (c) 2015, J. Salvador Arias <jsalarias@csnat.unt.edu.ar>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package biogeo
+
+import "testing"
+
+func TestClean(t *testing.T) {
+	d := &DataSet{
+		Ls: []*Taxon{
+			{Name: "Aus bus", Recs: []GeoRef{
+				{Catalog: "a1", Lon: -65.21, Lat: -26.81},
+				{Catalog: "a2", Lon: -65.21, Lat: -26.81}, // duplicate
+				{Catalog: "a3", Lon: 0, Lat: 0},           // zero
+				{Catalog: "a4", Lon: -30, Lat: -30},       // equal
+				{Catalog: "a5", Lon: -64.52, Lat: -27.13},
+				{Catalog: "a6", Lon: -65.93, Lat: -26.02},
+				{Catalog: "a7", Lon: -64.87, Lat: -25.64},
+				{Catalog: "a8", Lon: -66.11, Lat: -27.45},
+				{Catalog: "a9", Lon: 120.35, Lat: 35.22}, // outlier
+				{Catalog: "a10", Lon: -65, Lat: -27.3},   // precision
+			}},
+			{Name: "Cus dus", Recs: []GeoRef{
+				{Catalog: "c1", Lon: 0, Lat: 0}, // zero
+			}},
+		},
+	}
+	opt := DefaultCleanOptions()
+	opt.Outlier = 3
+	opt.Precision = 1
+	nd, iss := Clean(d, opt)
+	want := map[string]string{
+		"a2":  DupTest,
+		"a3":  ZeroTest,
+		"a4":  EqualTest,
+		"a9":  OutlierTest,
+		"a10": PrecisionTest,
+		"c1":  ZeroTest,
+	}
+	if len(iss) != len(want) {
+		t.Errorf("clean error: expecting %d issues, found %d", len(want), len(iss))
+	}
+	for _, is := range iss {
+		if want[is.Rec.Catalog] != is.Test {
+			t.Errorf("clean error: record %s: expecting %q, found %q", is.Rec.Catalog, want[is.Rec.Catalog], is.Test)
+		}
+	}
+	if len(nd.Ls) != 1 {
+		t.Fatalf("clean error: expecting 1 taxon, found %d", len(nd.Ls))
+	}
+	if n := len(nd.Ls[0].Recs); n != 5 {
+		t.Errorf("clean error: expecting 5 records, found %d", n)
+	}
+	if n := len(d.Ls[0].Recs); n != 10 {
+		t.Errorf("clean error: original dataset modified")
+	}
+
+	// trailing zeros are not counted
+	for _, tc := range []struct {
+		v   float64
+		dec int
+	}{
+		{-34.600, 1},
+		{-34.605, 3},
+		{-65, 0},
+	} {
+		if dec := decimals(tc.v); dec != tc.dec {
+			t.Errorf("precision error: %v: expecting %d decimals, found %d", tc.v, tc.dec, dec)
+		}
+	}
+}
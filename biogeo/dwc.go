@@ -0,0 +1,421 @@
+// Copyright (c) 2015, J. Salvador Arias <jsalarias@csnat.unt.edu.ar>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package biogeo
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Darwin Core terms used to read occurrence records. Terms are compared
+// without the namespace and in lower caps.
+const (
+	dwcName    = "scientificname"
+	dwcLon     = "decimallongitude"
+	dwcLat     = "decimallatitude"
+	dwcCatalog = "catalognumber"
+	dwcOccID   = "occurrenceid"
+	dwcUncert  = "coordinateuncertaintyinmeters"
+)
+
+// metaFileName is the name of the descriptor file of a Darwin Core Archive.
+const metaFileName = "meta.xml"
+
+// ReadGBIF reads occurrence records from a GBIF simple download, or any
+// delimited text file in which the columns are named with Darwin Core terms
+// (scientificName, decimalLongitude, decimalLatitude, and optionally,
+// catalogNumber or occurrenceID, and coordinateUncertaintyInMeters). The
+// delimiter (tab or comma) is detected from the header. Records without a
+// valid georeference are ignored. Taxon names are normalized with
+// CanonicalName.
+func ReadGBIF(in io.Reader) (*DataSet, error) {
+	r := bufio.NewReader(in)
+	ln, err := r.ReadString('\n')
+	if (err != nil) && (err != io.EOF) {
+		return nil, fmt.Errorf("header (dwc): %v", err)
+	}
+	delim := '\t'
+	if !strings.ContainsRune(ln, '\t') && strings.ContainsRune(ln, ',') {
+		delim = ','
+	}
+	fr := newFieldReader(io.MultiReader(strings.NewReader(ln), r), delim, delim == ',')
+	h, err := fr.read()
+	if err != nil {
+		return nil, fmt.Errorf("header (dwc): %v", err)
+	}
+	cols := make(map[string]int)
+	for i, v := range h {
+		cols[dwcTerm(v)] = i
+	}
+	d := &DataSet{Names: make(map[string]*Taxon)}
+	if err := d.readDwC(fr, cols, nil); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// ReadArchive reads occurrence records from a Darwin Core Archive. The
+// archive can be a zip file, or a directory with the content of the
+// archive. The core (or extension) of the archive with occurrence rows is
+// read using the description of the meta.xml file. If the archive does not
+// have a meta.xml file (as in GBIF simple downloads), the first text file
+// of the archive will be read with ReadGBIF. Records without a valid
+// georeference are ignored. Taxon names are normalized with CanonicalName.
+func ReadArchive(name string) (*DataSet, error) {
+	var open func(string) (io.ReadCloser, error)
+	var files []string
+	fi, err := os.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	if fi.IsDir() {
+		ls, err := os.ReadDir(name)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range ls {
+			if !f.IsDir() {
+				files = append(files, f.Name())
+			}
+		}
+		open = func(fn string) (io.ReadCloser, error) {
+			return os.Open(filepath.Join(name, fn))
+		}
+	} else {
+		z, err := zip.OpenReader(name)
+		if err != nil {
+			return nil, fmt.Errorf("(dwc) %s: %v", name, err)
+		}
+		defer z.Close()
+		for _, f := range z.File {
+			if !strings.HasSuffix(f.Name, "/") {
+				files = append(files, f.Name)
+			}
+		}
+		open = func(fn string) (io.ReadCloser, error) {
+			return z.Open(fn)
+		}
+	}
+
+	hasMeta := false
+	for _, fn := range files {
+		if strings.ToLower(fn) == metaFileName {
+			hasMeta = true
+			break
+		}
+	}
+	if !hasMeta {
+		for _, fn := range files {
+			switch strings.ToLower(filepath.Ext(fn)) {
+			case ".txt", ".csv", ".tab", ".tsv":
+			default:
+				continue
+			}
+			f, err := open(fn)
+			if err != nil {
+				return nil, err
+			}
+			defer f.Close()
+			return ReadGBIF(f)
+		}
+		return nil, fmt.Errorf("(dwc) %s: data file not found", name)
+	}
+
+	mf, err := open(metaFileName)
+	if err != nil {
+		return nil, err
+	}
+	m, err := readMeta(mf)
+	mf.Close()
+	if err != nil {
+		return nil, err
+	}
+	f, err := open(m.Location)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fr := newFieldReader(f, m.delim(), m.Enclosed == "\"")
+	for i := 0; i < m.Ignore; i++ {
+		if _, err := fr.read(); err != nil {
+			return nil, fmt.Errorf("(dwc) %s: %v", m.Location, err)
+		}
+	}
+	cols := make(map[string]int)
+	defs := make(map[string]string)
+	for _, fd := range m.Fields {
+		t := dwcTerm(fd.Term)
+		if len(fd.Index) == 0 {
+			defs[t] = fd.Default
+			continue
+		}
+		i, err := strconv.Atoi(fd.Index)
+		if err != nil {
+			return nil, fmt.Errorf("(dwc) meta: field %s: %v", fd.Term, err)
+		}
+		cols[t] = i
+	}
+	d := &DataSet{Names: make(map[string]*Taxon)}
+	if err := d.readDwC(fr, cols, defs); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// A dwcMeta is the description of the occurrence file of a Darwin Core
+// Archive.
+type dwcMeta struct {
+	RowType  string     `xml:"rowType,attr"`
+	Delim    string     `xml:"fieldsTerminatedBy,attr"`
+	Enclosed string     `xml:"fieldsEnclosedBy,attr"`
+	Ignore   int        `xml:"ignoreHeaderLines,attr"`
+	Location string     `xml:"files>location"`
+	Fields   []dwcField `xml:"field"`
+}
+
+// A dwcField is a field description of a Darwin Core Archive.
+type dwcField struct {
+	Index   string `xml:"index,attr"`
+	Term    string `xml:"term,attr"`
+	Default string `xml:"default,attr"`
+}
+
+// readMeta reads the meta.xml file of a Darwin Core Archive, and returns
+// the description of the occurrence file.
+func readMeta(in io.Reader) (*dwcMeta, error) {
+	var a struct {
+		Core []dwcMeta `xml:"core"`
+		Ext  []dwcMeta `xml:"extension"`
+	}
+	if err := xml.NewDecoder(in).Decode(&a); err != nil {
+		return nil, fmt.Errorf("(dwc) meta: %v", err)
+	}
+	for _, m := range append(a.Core, a.Ext...) {
+		if !strings.HasSuffix(strings.ToLower(m.RowType), "occurrence") {
+			continue
+		}
+		if len(m.Location) == 0 {
+			return nil, errors.New("(dwc) meta: undefined occurrence file")
+		}
+		return &m, nil
+	}
+	return nil, errors.New("(dwc) meta: occurrence data not found")
+}
+
+// delim returns the field delimiter of a Darwin Core Archive file.
+func (m *dwcMeta) delim() rune {
+	switch m.Delim {
+	case "", "\\t", "\t":
+		return '\t'
+	case "\\,":
+		return ','
+	}
+	r, _ := utf8.DecodeRuneInString(m.Delim)
+	return r
+}
+
+// readDwC reads the occurrence records of a delimited file, using the
+// indicated map of Darwin Core term:column, and the map of term:default
+// value for terms without a column.
+func (d *DataSet) readDwC(fr *fieldReader, cols map[string]int, defs map[string]string) error {
+	if _, ok := cols[dwcName]; !ok {
+		if _, ok := defs[dwcName]; !ok {
+			return errors.New("header (dwc): scientificName not found")
+		}
+	}
+	for _, t := range []string{dwcLon, dwcLat} {
+		if _, ok := cols[t]; !ok {
+			return errors.New("header (dwc): decimal coordinates not found")
+		}
+	}
+	get := func(row []string, t string) string {
+		if i, ok := cols[t]; ok {
+			if i < len(row) {
+				return strings.TrimSpace(row[i])
+			}
+			return ""
+		}
+		return defs[t]
+	}
+	for i := 1; ; i++ {
+		row, err := fr.read()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return fmt.Errorf("(dwc) row %d: %v", i, err)
+		}
+		nm := CanonicalName(get(row, dwcName))
+		if len(nm) == 0 {
+			continue
+		}
+		lon, err := strconv.ParseFloat(get(row, dwcLon), 64)
+		if err != nil {
+			continue
+		}
+		lat, err := strconv.ParseFloat(get(row, dwcLat), 64)
+		if err != nil {
+			continue
+		}
+		g := GeoRef{
+			Lon:     lon,
+			Lat:     lat,
+			Catalog: get(row, dwcCatalog),
+		}
+		if len(g.Catalog) == 0 {
+			g.Catalog = get(row, dwcOccID)
+		}
+		if u, err := strconv.ParseFloat(get(row, dwcUncert), 64); (err == nil) && (u > 0) {
+			g.Uncert = u
+		}
+		if !g.IsValid() {
+			continue
+		}
+		t, ok := d.Names[strings.ToLower(nm)]
+		if !ok {
+			t = &Taxon{Name: nm}
+			d.Names[strings.ToLower(nm)] = t
+			d.Ls = append(d.Ls, t)
+		}
+		t.Recs = append(t.Recs, g)
+	}
+	return nil
+}
+
+// dwcTerm returns a Darwin Core term without its namespace (either as an
+// URI, or a prefix), and in lower caps.
+func dwcTerm(t string) string {
+	t = strings.TrimSpace(t)
+	if i := strings.LastIndexAny(t, "/:#"); i >= 0 {
+		t = t[i+1:]
+	}
+	return strings.ToLower(t)
+}
+
+// A fieldReader reads rows of a delimited file. If quoted is false, quotes
+// are not interpreted (as in most Darwin Core files), and each line is a
+// row.
+type fieldReader struct {
+	delim string
+	csv   *csv.Reader
+	sc    *bufio.Scanner
+}
+
+// newFieldReader returns a new fieldReader.
+func newFieldReader(in io.Reader, delim rune, quoted bool) *fieldReader {
+	if quoted {
+		r := csv.NewReader(in)
+		r.Comma = delim
+		r.LazyQuotes = true
+		r.FieldsPerRecord = -1
+		return &fieldReader{csv: r}
+	}
+	sc := bufio.NewScanner(in)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	return &fieldReader{delim: string(delim), sc: sc}
+}
+
+// read returns the next row.
+func (fr *fieldReader) read() ([]string, error) {
+	if fr.csv != nil {
+		return fr.csv.Read()
+	}
+	for fr.sc.Scan() {
+		ln := strings.TrimRight(fr.sc.Text(), "\r")
+		if len(ln) == 0 {
+			continue
+		}
+		return strings.Split(ln, fr.delim), nil
+	}
+	if err := fr.sc.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+// Infraspecific rank markers kept in a canonical name.
+var rankMarkers = map[string]bool{
+	"subsp.":  true,
+	"ssp.":    true,
+	"var.":    true,
+	"subvar.": true,
+	"f.":      true,
+	"forma":   true,
+}
+
+// Particles of author names that start in lower caps.
+var authorParticles = map[string]bool{
+	"d'":  true,
+	"da":  true,
+	"de":  true,
+	"del": true,
+	"der": true,
+	"du":  true,
+	"et":  true,
+	"ex":  true,
+	"in":  true,
+	"la":  true,
+	"le":  true,
+	"van": true,
+	"von": true,
+}
+
+// CanonicalName returns the canonical form of a scientific name: the genus
+// capitalized, followed by the epithets (and infraspecific rank markers) in
+// lower caps, without the authorship, and with single spaces between
+// words. For example 'puma  concolor (Linnaeus, 1771)' will be returned as
+// 'Puma concolor'.
+func CanonicalName(name string) string {
+	w := strings.Fields(name)
+	if len(w) == 0 {
+		return ""
+	}
+	if strings.ToUpper(name) == name {
+		// names in all caps
+		for i := range w {
+			w[i] = strings.ToLower(w[i])
+		}
+	}
+	cn := []string{capitalize(w[0])}
+	for i := 1; i < len(w); i++ {
+		v := w[i]
+		r, _ := utf8.DecodeRuneInString(v)
+		if !unicode.IsLower(r) || authorParticles[v] {
+			break
+		}
+		if rankMarkers[v] {
+			if i+1 >= len(w) {
+				break
+			}
+			n, _ := utf8.DecodeRuneInString(w[i+1])
+			if !unicode.IsLower(n) {
+				break
+			}
+			cn = append(cn, v, w[i+1])
+			i++
+			continue
+		}
+		cn = append(cn, v)
+	}
+	return strings.Join(cn, " ")
+}
+
+// capitalize returns a word with the first letter in upper caps, and the
+// rest in lower caps.
+func capitalize(s string) string {
+	r, n := utf8.DecodeRuneInString(s)
+	return string(unicode.ToUpper(r)) + strings.ToLower(s[n:])
+}
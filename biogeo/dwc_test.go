@@ -0,0 +1,52 @@
+// Copyright (c) 2015, J. Salvador Arias <jsalarias@csnat.unt.edu.ar>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package biogeo
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCanonicalName(t *testing.T) {
+	tests := []struct {
+		name, want string
+	}{
+		{"Puma concolor", "Puma concolor"},
+		{"puma  concolor (Linnaeus, 1771)", "Puma concolor"},
+		{"PUMA CONCOLOR", "Puma concolor"},
+		{"Lycalopex gymnocercus gymnocercus (G. Fischer, 1814)", "Lycalopex gymnocercus gymnocercus"},
+		{"Prosopis alba var. panta Griseb.", "Prosopis alba var. panta"},
+		{"Aus bus de Candolle", "Aus bus"},
+		{"", ""},
+	}
+	for _, tc := range tests {
+		if cn := CanonicalName(tc.name); cn != tc.want {
+			t.Errorf("name %q: expecting %q, found %q", tc.name, tc.want, cn)
+		}
+	}
+}
+
+func TestReadGBIF(t *testing.T) {
+	data := `scientificName,decimalLatitude,decimalLongitude,catalogNumber
+"Puma concolor (Linnaeus, 1771)",-26.8,-65.2,MACN 1
+puma concolor,-27,-64,
+Puma concolor,,,MACN 2
+Aus bus,100,10,
+`
+	d, err := ReadGBIF(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("read error: %v", err)
+	}
+	if len(d.Ls) != 1 {
+		t.Fatalf("taxa error: expecting 1 taxon, found %d", len(d.Ls))
+	}
+	tx := d.Taxon("Puma concolor")
+	if (tx == nil) || (len(tx.Recs) != 2) {
+		t.Fatalf("records error: expecting 2 records of Puma concolor")
+	}
+	if (tx.Recs[0].Lon != -65.2) || (tx.Recs[0].Lat != -26.8) || (tx.Recs[0].Catalog != "MACN 1") {
+		t.Errorf("record error: found %v", tx.Recs[0])
+	}
+}
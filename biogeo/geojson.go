@@ -0,0 +1,206 @@
+// Copyright (c) 2015, J. Salvador Arias <jsalarias@csnat.unt.edu.ar>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package biogeo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+)
+
+// A Ring is a closed line of geographic points, stored as longitude,
+// latitude pairs.
+type Ring [][2]float64
+
+// A Polygon is a geographic polygon, defined by an outer ring, and
+// optionally, one or more inner rings (holes).
+type Polygon []Ring
+
+// Contains returns true if a geographic point is inside the polygon (i.e.
+// inside the outer ring, and outside the holes). Coordinates are treated as
+// planar, so polygons that cross the antimeridian should be split.
+func (p Polygon) Contains(lon, lat float64) bool {
+	in := false
+	for _, r := range p {
+		for i, j := 0, len(r)-1; i < len(r); j, i = i, i+1 {
+			xi, yi := r[i][0], r[i][1]
+			xj, yj := r[j][0], r[j][1]
+			if (yi > lat) == (yj > lat) {
+				continue
+			}
+			if lon < (xj-xi)*(lat-yi)/(yj-yi)+xi {
+				in = !in
+			}
+		}
+	}
+	return in
+}
+
+// Bounds returns the bounding box of the polygon.
+func (p Polygon) Bounds() (minLon, minLat, maxLon, maxLat float64) {
+	minLon, minLat = math.Inf(1), math.Inf(1)
+	maxLon, maxLat = math.Inf(-1), math.Inf(-1)
+	for _, r := range p {
+		for _, pt := range r {
+			minLon = math.Min(minLon, pt[0])
+			maxLon = math.Max(maxLon, pt[0])
+			minLat = math.Min(minLat, pt[1])
+			maxLat = math.Max(maxLat, pt[1])
+		}
+	}
+	return minLon, minLat, maxLon, maxLat
+}
+
+// Name properties used by ReadGeoJSON if no property is defined, in order
+// of preference.
+var nameProps = []string{
+	"name",
+	"scientificname",
+	"binomial",
+	"sci_name",
+	"species",
+}
+
+// ReadGeoJSON reads the range polygons of a set of taxa from a GeoJSON
+// input stream. Each Feature with a Polygon or MultiPolygon geometry is
+// assigned to the taxon named in the property prop. If prop is empty, the
+// first property found of 'name', 'scientificName', 'binomial', 'sci_name'
+// or 'species' is used. Other geometries are ignored.
+func ReadGeoJSON(in io.Reader, prop string) (*DataSet, error) {
+	fs, err := readFeatures(in)
+	if err != nil {
+		return nil, err
+	}
+	d := &DataSet{Names: make(map[string]*Taxon)}
+	for i, f := range fs {
+		nm := f.name(prop)
+		if len(nm) == 0 {
+			return nil, fmt.Errorf("(geojson) feature %d: undefined name", i+1)
+		}
+		ps, err := f.Geometry.polygons()
+		if err != nil {
+			return nil, fmt.Errorf("(geojson) feature %d: %v", i+1, err)
+		}
+		if len(ps) == 0 {
+			continue
+		}
+		t, ok := d.Names[strings.ToLower(nm)]
+		if !ok {
+			t = &Taxon{Name: nm}
+			d.Names[strings.ToLower(nm)] = t
+			d.Ls = append(d.Ls, t)
+		}
+		t.Polys = append(t.Polys, ps...)
+	}
+	return d, nil
+}
+
+// ReadPolygons reads all the polygons of the features of a GeoJSON input
+// stream, regardless of its properties.
+func ReadPolygons(in io.Reader) ([]Polygon, error) {
+	fs, err := readFeatures(in)
+	if err != nil {
+		return nil, err
+	}
+	var ps []Polygon
+	for i, f := range fs {
+		fp, err := f.Geometry.polygons()
+		if err != nil {
+			return nil, fmt.Errorf("(geojson) feature %d: %v", i+1, err)
+		}
+		ps = append(ps, fp...)
+	}
+	if len(ps) == 0 {
+		return nil, errors.New("(geojson): no polygons")
+	}
+	return ps, nil
+}
+
+// readFeatures reads the features of a GeoJSON FeatureCollection.
+func readFeatures(in io.Reader) ([]geoFeature, error) {
+	var fc struct {
+		Type     string
+		Features []geoFeature
+	}
+	if err := json.NewDecoder(in).Decode(&fc); err != nil {
+		return nil, fmt.Errorf("(geojson): %v", err)
+	}
+	switch fc.Type {
+	case "FeatureCollection":
+	case "Feature":
+		return nil, errors.New("(geojson): expecting a FeatureCollection")
+	default:
+		return nil, fmt.Errorf("(geojson): unknown type %q", fc.Type)
+	}
+	return fc.Features, nil
+}
+
+// A geoFeature is a GeoJSON feature.
+type geoFeature struct {
+	Properties map[string]interface{}
+	Geometry   *geoGeometry
+}
+
+// name returns the taxon name of a feature.
+func (f *geoFeature) name(prop string) string {
+	props := make(map[string]interface{}, len(f.Properties))
+	for k, v := range f.Properties {
+		props[strings.ToLower(k)] = v
+	}
+	keys := nameProps
+	if len(prop) > 0 {
+		keys = []string{strings.ToLower(prop)}
+	}
+	for _, k := range keys {
+		if s, ok := props[k].(string); ok {
+			if nm := strings.Join(strings.Fields(s), " "); len(nm) > 0 {
+				return nm
+			}
+		}
+	}
+	return ""
+}
+
+// A geoGeometry is a GeoJSON geometry.
+type geoGeometry struct {
+	Type        string
+	Coordinates json.RawMessage
+	Geometries  []*geoGeometry
+}
+
+// polygons returns the polygons of a geometry.
+func (g *geoGeometry) polygons() ([]Polygon, error) {
+	if g == nil {
+		return nil, nil
+	}
+	switch g.Type {
+	case "Polygon":
+		var p Polygon
+		if err := json.Unmarshal(g.Coordinates, &p); err != nil {
+			return nil, err
+		}
+		return []Polygon{p}, nil
+	case "MultiPolygon":
+		var ps []Polygon
+		if err := json.Unmarshal(g.Coordinates, &ps); err != nil {
+			return nil, err
+		}
+		return ps, nil
+	case "GeometryCollection":
+		var ps []Polygon
+		for _, c := range g.Geometries {
+			cp, err := c.polygons()
+			if err != nil {
+				return nil, err
+			}
+			ps = append(ps, cp...)
+		}
+		return ps, nil
+	}
+	return nil, nil
+}
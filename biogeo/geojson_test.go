@@ -0,0 +1,47 @@
+// Copyright (c) 2015, J. Salvador Arias <jsalarias@csnat.unt.edu.ar>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package biogeo
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReadGeoJSON(t *testing.T) {
+	data := `{"type": "FeatureCollection", "features": [
+	{"type": "Feature", "properties": {"binomial": "Aus  bus"}, "geometry": {"type": "Polygon",
+		"coordinates": [[[0, 0], [10, 0], [10, 10], [0, 10], [0, 0]], [[4, 4], [6, 4], [6, 6], [4, 6], [4, 4]]]}},
+	{"type": "Feature", "properties": {"binomial": "Cus dus"}, "geometry": {"type": "MultiPolygon",
+		"coordinates": [[[[20, 0, 100], [30, 0, 100], [30, 10, 100], [20, 0, 100]]], [[[40, 0], [50, 0], [50, 10], [40, 0]]]]}},
+	{"type": "Feature", "properties": {"binomial": "Eus fus"}, "geometry": {"type": "Point", "coordinates": [0, 0]}}
+	]}`
+	d, err := ReadGeoJSON(strings.NewReader(data), "")
+	if err != nil {
+		t.Fatalf("read error: %v", err)
+	}
+	if len(d.Ls) != 2 {
+		t.Fatalf("read error: expecting 2 taxa, found %d", len(d.Ls))
+	}
+	a := d.Taxon("Aus bus")
+	if (a == nil) || (len(a.Polys) != 1) {
+		t.Fatalf("read error: expecting 1 polygon for Aus bus")
+	}
+	if c := d.Taxon("Cus dus"); (c == nil) || (len(c.Polys) != 2) {
+		t.Fatalf("read error: expecting 2 polygons for Cus dus")
+	}
+	tests := []struct {
+		lon, lat float64
+		in       bool
+	}{
+		{2, 2, true},
+		{5, 5, false}, // inside the hole
+		{11, 5, false},
+	}
+	for _, tc := range tests {
+		if in := a.Polys[0].Contains(tc.lon, tc.lat); in != tc.in {
+			t.Errorf("contains error: point %.1f %.1f: expecting %v, found %v", tc.lon, tc.lat, tc.in, in)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+// Copyright (c) 2015, J. Salvador Arias <jsalarias@csnat.unt.edu.ar>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package biogeo
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Synonyms is a synonym table, a map of a synonym (in lower caps) to the
+// accepted name of the taxon.
+type Synonyms map[string]string
+
+// ReadSynonyms reads a synonym table from an input stream in tsv format.
+// The table must have the columns 'Name' with the accepted name, and
+// 'Synonym' with the synonym.
+func ReadSynonyms(in io.Reader) (Synonyms, error) {
+	r := csv.NewReader(in)
+	r.Comma = '\t'
+
+	// leading spaces are not trimmed by the csv reader, as the tab is
+	// also a space, and empty fields will be lost; instead, names are
+	// normalized after reading each field
+
+	// reads the file header
+	h, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("header (synonyms): %v", err)
+	}
+	name := -1
+	syn := -1
+	for i, v := range h {
+		switch strings.ToLower(strings.TrimSpace(v)) {
+		case "name", "accepted", "acceptedname":
+			name = i
+		case "synonym":
+			syn = i
+		}
+	}
+	if (name < 0) || (syn < 0) {
+		return nil, errors.New("header (synonyms): incomplete header")
+	}
+
+	// reads the data
+	s := make(Synonyms)
+	for i := 1; ; i++ {
+		row, err := r.Read()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, fmt.Errorf("(synonyms) row %d: %v", i, err)
+		}
+		if lr := len(row); (lr <= name) || (lr <= syn) {
+			continue
+		}
+		nm := strings.Join(strings.Fields(row[name]), " ")
+		sn := strings.Join(strings.Fields(row[syn]), " ")
+		if (len(nm) == 0) || (len(sn) == 0) {
+			continue
+		}
+		if strings.ToLower(nm) == strings.ToLower(sn) {
+			continue
+		}
+		if a, ok := s[strings.ToLower(sn)]; ok && (strings.ToLower(a) != strings.ToLower(nm)) {
+			return nil, fmt.Errorf("(synonyms) row %d: synonym %s assigned to %s and %s", i, sn, a, nm)
+		}
+		s[strings.ToLower(sn)] = nm
+	}
+	return s, nil
+}
+
+// Accepted returns the accepted name of a name. If the name is not a
+// synonym, it returns the name.
+func (s Synonyms) Accepted(name string) string {
+	if a, ok := s[strings.ToLower(strings.Join(strings.Fields(name), " "))]; ok {
+		return a
+	}
+	return name
+}
+
+// Rename changes the names of the taxa of the dataset that are synonyms to
+// its accepted name. The data of taxa with the same accepted name are
+// merged.
+func (d *DataSet) Rename(s Synonyms) {
+	if len(s) == 0 {
+		return
+	}
+	ls := d.Ls
+	d.Ls = nil
+	d.Names = make(map[string]*Taxon, len(ls))
+	for _, t := range ls {
+		nm := s.Accepted(t.Name)
+		at, ok := d.Names[strings.ToLower(nm)]
+		if !ok {
+			t.Name = nm
+			d.Names[strings.ToLower(nm)] = t
+			d.Ls = append(d.Ls, t)
+			continue
+		}
+		at.Recs = append(at.Recs, t.Recs...)
+		at.Polys = append(at.Polys, t.Polys...)
+		at.Maps = append(at.Maps, t.Maps...)
+	}
+}
+
+// Reasons of a name match.
+const (
+	AuthorMatch = "authorship"
+	SwapMatch   = "swap"
+	DistMatch   = "distance"
+)
+
+// A Match is a proposed match of a taxon name.
+type Match struct {
+	Name   string // the matched name
+	Reason string // the reason of the match
+	Dist   int    // the edit distance between the names
+}
+
+// Suggest returns the names in a list that are likely a different spelling
+// of a name, sorted from the best to the worst match. Names are matched if
+// they are the same after the authorship is removed, if they have the same
+// words in a different order (e.g. a genus/epithet swap), or if the edit
+// distance between them is maxDist or less.
+func Suggest(name string, names []string, maxDist int) []Match {
+	ln := lowerName(name)
+	cn := canonKey(name)
+	if len(cn) == 0 {
+		return nil
+	}
+	sw := sortedWords(ln)
+	var ms []Match
+	for _, nm := range names {
+		if strings.ToLower(strings.Join(strings.Fields(nm), " ")) == strings.ToLower(strings.Join(strings.Fields(name), " ")) {
+			continue
+		}
+		lk := lowerName(nm)
+		ck := canonKey(nm)
+		if len(ck) == 0 {
+			continue
+		}
+		d := editDist(cn, ck)
+		if v := editDist(ln, lk); v < d {
+			d = v
+		}
+		switch {
+		case ck == cn:
+			ms = append(ms, Match{Name: nm, Reason: AuthorMatch, Dist: d})
+		case sortedWords(lk) == sw:
+			ms = append(ms, Match{Name: nm, Reason: SwapMatch, Dist: d})
+		case d <= maxDist:
+			ms = append(ms, Match{Name: nm, Reason: DistMatch, Dist: d})
+		}
+	}
+	sort.Sort(matches(ms))
+	return ms
+}
+
+// matches implements the sort interface for a list of matches.
+type matches []Match
+
+func (ms matches) Len() int      { return len(ms) }
+func (ms matches) Swap(i, j int) { ms[i], ms[j] = ms[j], ms[i] }
+func (ms matches) Less(i, j int) bool {
+	ri, rj := matchRank(ms[i].Reason), matchRank(ms[j].Reason)
+	if ri != rj {
+		return ri < rj
+	}
+	if ms[i].Dist != ms[j].Dist {
+		return ms[i].Dist < ms[j].Dist
+	}
+	return ms[i].Name < ms[j].Name
+}
+
+// matchRank returns the rank of a match reason.
+func matchRank(reason string) int {
+	switch reason {
+	case AuthorMatch:
+		return 0
+	case SwapMatch:
+		return 1
+	}
+	return 2
+}
+
+// lowerName returns a name in lower caps, with underscores (as used in
+// trees) replaced by spaces, and with single spaces between words.
+func lowerName(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(strings.Replace(name, "_", " ", -1)), " "))
+}
+
+// canonKey returns the canonical form of a name, in lower caps.
+func canonKey(name string) string {
+	return strings.ToLower(CanonicalName(strings.Replace(name, "_", " ", -1)))
+}
+
+// sortedWords returns the words of a name sorted.
+func sortedWords(name string) string {
+	w := strings.Fields(name)
+	sort.Strings(w)
+	return strings.Join(w, " ")
+}
+
+// editDist returns the Levenshtein distance between two strings.
+func editDist(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			c := prev[j-1]
+			if ra[i-1] != rb[j-1] {
+				c++
+			}
+			if v := prev[j] + 1; v < c {
+				c = v
+			}
+			if v := curr[j-1] + 1; v < c {
+				c = v
+			}
+			curr[j] = c
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
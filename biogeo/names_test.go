@@ -0,0 +1,83 @@
+// Copyright (c) 2015, J. Salvador Arias <jsalarias@csnat.unt.edu.ar>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package biogeo
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSynonyms(t *testing.T) {
+	data := "Name\tSynonym\r\nPuma concolor\tFelis concolor\r\nPuma concolor\tProfelis concolor\r\n"
+	s, err := ReadSynonyms(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("read error: %v", err)
+	}
+	if a := s.Accepted("felis  concolor"); a != "Puma concolor" {
+		t.Errorf("accepted error: expecting %q, found %q", "Puma concolor", a)
+	}
+	if a := s.Accepted("Aus bus"); a != "Aus bus" {
+		t.Errorf("accepted error: expecting %q, found %q", "Aus bus", a)
+	}
+	d := &DataSet{
+		Ls: []*Taxon{
+			{Name: "Puma concolor", Recs: []GeoRef{{Lon: -65, Lat: -26}}},
+			{Name: "Felis concolor", Recs: []GeoRef{{Lon: -64, Lat: -27}}},
+			{Name: "Profelis concolor", Recs: []GeoRef{{Lon: -63, Lat: -28}}},
+		},
+	}
+	d.Rename(s)
+	if len(d.Ls) != 1 {
+		t.Fatalf("rename error: expecting 1 taxon, found %d", len(d.Ls))
+	}
+	if n := len(d.Taxon("Puma concolor").Recs); n != 3 {
+		t.Errorf("rename error: expecting 3 records, found %d", n)
+	}
+
+	// an empty field in a middle column
+	data = "Name\tAuthor\tSynonym\r\nPuma concolor\t\tFelis concolor\r\nLynx rufus\tKerr\tFelis rufus\r\n"
+	s, err = ReadSynonyms(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("read error: %v", err)
+	}
+	if a := s.Accepted("Felis concolor"); a != "Puma concolor" {
+		t.Errorf("accepted error: expecting %q, found %q", "Puma concolor", a)
+	}
+	if a := s.Accepted("Felis rufus"); a != "Lynx rufus" {
+		t.Errorf("accepted error: expecting %q, found %q", "Lynx rufus", a)
+	}
+
+	bad := "Name\tSynonym\r\nPuma concolor\tFelis concolor\r\nLynx rufus\tFelis concolor\r\n"
+	if _, err := ReadSynonyms(strings.NewReader(bad)); err == nil {
+		t.Errorf("read error: expecting error on a synonym with two accepted names")
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	names := []string{
+		"Puma concolor (Linnaeus, 1771)",
+		"concolor Puma",
+		"Puma concolr",
+		"Puma yagouaroundi",
+		"Lynx rufus",
+	}
+	ms := Suggest("Puma concolor", names, 2)
+	want := []Match{
+		{Name: "Puma concolor (Linnaeus, 1771)", Reason: AuthorMatch},
+		{Name: "concolor Puma", Reason: SwapMatch},
+		{Name: "Puma concolr", Reason: DistMatch, Dist: 1},
+	}
+	if len(ms) != len(want) {
+		t.Fatalf("suggest error: expecting %d matches, found %v", len(want), ms)
+	}
+	for i, m := range ms {
+		if (m.Name != want[i].Name) || (m.Reason != want[i].Reason) {
+			t.Errorf("suggest error: match %d: expecting %v, found %v", i, want[i], m)
+		}
+	}
+	if m := ms[2]; m.Dist != 1 {
+		t.Errorf("suggest error: expecting distance 1, found %d", m.Dist)
+	}
+}
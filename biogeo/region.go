@@ -0,0 +1,179 @@
+// Copyright (c) 2015, J. Salvador Arias <jsalarias@csnat.unt.edu.ar>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package biogeo
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// A Region is a geographic area used to restrict a data set, defined by a
+// bounding box, and optionally, a set of polygons (a mask). If MinLon is
+// greater than MaxLon, the bounding box crosses the antimeridian.
+type Region struct {
+	MinLon, MinLat float64
+	MaxLon, MaxLat float64
+	Polys          []Polygon
+}
+
+// NewRegion returns a region that covers the whole Earth.
+func NewRegion() *Region {
+	return &Region{
+		MinLon: MinLon,
+		MinLat: MinLat,
+		MaxLon: MaxLon,
+		MaxLat: MaxLat,
+	}
+}
+
+// ParseBox sets the bounding box of a region from a string with the
+// minimum longitude, minimum latitude, maximum longitude, and maximum
+// latitude, separated by commas.
+func (r *Region) ParseBox(s string) error {
+	v := strings.Split(s, ",")
+	if len(v) != 4 {
+		return fmt.Errorf("bbox %q: expecting 4 values, found %d", s, len(v))
+	}
+	var b [4]float64
+	for i, x := range v {
+		f, err := strconv.ParseFloat(strings.TrimSpace(x), 64)
+		if err != nil {
+			return fmt.Errorf("bbox %q: %v", s, err)
+		}
+		b[i] = f
+	}
+	for i := 0; i < 4; i += 2 {
+		if (b[i] < MinLon) || (b[i] > MaxLon) || (b[i+1] < MinLat) || (b[i+1] > MaxLat) {
+			return fmt.Errorf("bbox %q: invalid coordinates", s)
+		}
+	}
+	if b[1] > b[3] {
+		return fmt.Errorf("bbox %q: minimum latitude greater than maximum latitude", s)
+	}
+	r.MinLon, r.MinLat, r.MaxLon, r.MaxLat = b[0], b[1], b[2], b[3]
+	return nil
+}
+
+// Contains returns true if a geographic point is inside the region.
+func (r *Region) Contains(lon, lat float64) bool {
+	if (lat < r.MinLat) || (lat > r.MaxLat) {
+		return false
+	}
+	if r.MinLon <= r.MaxLon {
+		if (lon < r.MinLon) || (lon > r.MaxLon) {
+			return false
+		}
+	} else if (lon < r.MinLon) && (lon > r.MaxLon) {
+		return false
+	}
+	if len(r.Polys) == 0 {
+		return true
+	}
+	for _, p := range r.Polys {
+		if p.Contains(lon, lat) {
+			return true
+		}
+	}
+	return false
+}
+
+// overlaps returns true if a bounding box overlaps the bounding box of the
+// region.
+func (r *Region) overlaps(minLon, minLat, maxLon, maxLat float64) bool {
+	if (maxLat < r.MinLat) || (minLat > r.MaxLat) {
+		return false
+	}
+	if r.MinLon <= r.MaxLon {
+		return (maxLon >= r.MinLon) && (minLon <= r.MaxLon)
+	}
+	return (maxLon >= r.MinLon) || (minLon <= r.MaxLon)
+}
+
+// FilterRegion returns a new data set with the records of the data set
+// inside a region. Range polygons and presence maps are kept if its
+// bounding box overlaps the region, and the region is stored in the new
+// data set, so the pixels outside the region are removed when the data set
+// is rasterized (and the taxa left without pixels are removed from the
+// raster). Taxa without data inside the region are removed.
+func (d *DataSet) FilterRegion(r *Region) *DataSet {
+	nd := &DataSet{
+		Names:  make(map[string]*Taxon),
+		Region: r,
+		Attrs:  d.Attrs,
+	}
+	for _, t := range d.Ls {
+		nt := &Taxon{Name: t.Name}
+		for _, g := range t.Recs {
+			if r.Contains(g.Lon, g.Lat) {
+				nt.Recs = append(nt.Recs, g)
+			}
+		}
+		for _, p := range t.Polys {
+			if r.overlaps(p.Bounds()) {
+				nt.Polys = append(nt.Polys, p)
+			}
+		}
+		for _, m := range t.Maps {
+			maxLon := m.MinLon + float64(m.Cols)*m.Size
+			maxLat := m.MinLat + float64(m.Rows)*m.Size
+			if r.overlaps(m.MinLon, m.MinLat, maxLon, maxLat) {
+				nt.Maps = append(nt.Maps, m)
+			}
+		}
+		if (len(nt.Recs) == 0) && (len(nt.Polys) == 0) && (len(nt.Maps) == 0) {
+			continue
+		}
+		nd.Names[strings.ToLower(nt.Name)] = nt
+		nd.Ls = append(nd.Ls, nt)
+	}
+	return nd
+}
+
+// FilterTaxa returns a new data set with the taxa of the data set in a
+// list of names.
+func (d *DataSet) FilterTaxa(names []string) *DataSet {
+	nd := &DataSet{
+		Names:  make(map[string]*Taxon),
+		Region: d.Region,
+		Attrs:  d.Attrs,
+	}
+	for _, nm := range names {
+		t := d.Names[strings.ToLower(strings.Join(strings.Fields(nm), " "))]
+		if t == nil {
+			continue
+		}
+		if _, ok := nd.Names[strings.ToLower(t.Name)]; ok {
+			continue
+		}
+		nd.Names[strings.ToLower(t.Name)] = t
+		nd.Ls = append(nd.Ls, t)
+	}
+	return nd
+}
+
+// ReadTaxa reads a list of taxon names from an input stream, with a name
+// per line. Empty lines, and lines starting with '#' are ignored.
+func ReadTaxa(in io.Reader) ([]string, error) {
+	var names []string
+	sc := bufio.NewScanner(in)
+	for sc.Scan() {
+		nm := strings.Join(strings.Fields(sc.Text()), " ")
+		if (len(nm) == 0) || (nm[0] == '#') {
+			continue
+		}
+		names = append(names, nm)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("(taxa): %v", err)
+	}
+	if len(names) == 0 {
+		return nil, errors.New("(taxa): empty list")
+	}
+	return names, nil
+}
@@ -0,0 +1,80 @@
+// Copyright (c) 2015, J. Salvador Arias <jsalarias@csnat.unt.edu.ar>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package biogeo
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFilterRegion(t *testing.T) {
+	d := &DataSet{
+		Ls: []*Taxon{
+			{Name: "a", Recs: []GeoRef{{Lon: -65, Lat: -26}, {Lon: 10, Lat: 45}}},
+			{Name: "b", Recs: []GeoRef{{Lon: 179, Lat: -20}}},
+			{Name: "c", Polys: []Polygon{{{{-70, -30}, {-60, -30}, {-60, -20}, {-70, -30}}}}},
+			{Name: "d", Polys: []Polygon{{{{10, 40}, {20, 40}, {20, 50}, {10, 40}}}}},
+		},
+	}
+	r := NewRegion()
+	if err := r.ParseBox("-80, -40, -50, -10"); err != nil {
+		t.Fatalf("bbox error: %v", err)
+	}
+	nd := d.FilterRegion(r)
+	if len(nd.Ls) != 2 {
+		t.Fatalf("filter error: expecting 2 taxa, found %d", len(nd.Ls))
+	}
+	if a := nd.Taxon("a"); (a == nil) || (len(a.Recs) != 1) {
+		t.Errorf("filter error: expecting 1 record of a")
+	}
+	if nd.Taxon("c") == nil {
+		t.Errorf("filter error: expecting polygon of c")
+	}
+	if len(d.Taxon("a").Recs) != 2 {
+		t.Errorf("filter error: original data set modified")
+	}
+
+	// a box that crosses the antimeridian
+	if err := r.ParseBox("170,-40,-170,0"); err != nil {
+		t.Fatalf("bbox error: %v", err)
+	}
+	nd = d.FilterRegion(r)
+	if (len(nd.Ls) != 1) || (nd.Ls[0].Name != "b") {
+		t.Errorf("filter error: expecting taxon b")
+	}
+
+	// a mask
+	r = NewRegion()
+	r.Polys = []Polygon{{{{0, 30}, {30, 30}, {30, 60}, {0, 60}, {0, 30}}}}
+	if !r.Contains(10, 45) || r.Contains(-65, -26) {
+		t.Errorf("mask error: wrong points inside the mask")
+	}
+
+	for _, b := range []string{"1,2,3", "-200,0,10,10", "0,10,10,0"} {
+		if err := r.ParseBox(b); err == nil {
+			t.Errorf("bbox error: expecting error on %q", b)
+		}
+	}
+}
+
+func TestFilterTaxa(t *testing.T) {
+	d := &DataSet{Names: make(map[string]*Taxon)}
+	for _, nm := range []string{"Aus bus", "Aus cus", "Dus eus"} {
+		tx := &Taxon{Name: nm}
+		d.Names[strings.ToLower(nm)] = tx
+		d.Ls = append(d.Ls, tx)
+	}
+	names, err := ReadTaxa(strings.NewReader("# study taxa\naus  bus\n\nDus eus\nXus yus\n"))
+	if err != nil {
+		t.Fatalf("read error: %v", err)
+	}
+	nd := d.FilterTaxa(names)
+	if len(nd.Ls) != 2 {
+		t.Fatalf("filter error: expecting 2 taxa, found %d", len(nd.Ls))
+	}
+	if nd.Taxon("Aus cus") != nil {
+		t.Errorf("filter error: unexpected taxon Aus cus")
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright (c) 2015, J. Salvador Arias <jsalarias@csnat.unt.edu.ar>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package bitfield
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// Raster sizes (in occupied pixels) used in the benchmarks. The larger ones
+// correspond to datasets rasterized at 0.5 and 0.1 degrees.
+var benchSizes = []struct {
+	name string
+	bits int
+}{
+	{"1k", 1000},
+	{"5k", 5000},
+	{"50k", 50000},
+}
+
+// benchFields returns two random bitfields with the indicated number of
+// bits.
+func benchFields(n int) (Bitfield, Bitfield) {
+	rnd := rand.New(rand.NewSource(1))
+	f := New(n)
+	b := New(n)
+	for i := 0; i < n/4; i++ {
+		f.PutOn(rnd.Intn(n))
+		b.PutOn(rnd.Intn(n))
+	}
+	return f, b
+}
+
+// legacyField is the previous 16-bit, lookup table based, implementation of
+// the bitfield, used as a reference in the benchmarks.
+type legacyField []uint16
+
+var legacyCount [65536]int
+
+func init() {
+	for i := range legacyCount {
+		c := 0
+		for j := uint(0); j < 16; j++ {
+			if (i & (1 << j)) != 0 {
+				c++
+			}
+		}
+		legacyCount[i] = c
+	}
+}
+
+// toLegacy returns a copy of f as a legacy bitfield.
+func toLegacy(f Bitfield) legacyField {
+	l := make(legacyField, len(f)*4)
+	for i, x := range f {
+		for j := 0; j < 4; j++ {
+			l[(i*4)+j] = uint16(x >> (uint(j) * 16))
+		}
+	}
+	return l
+}
+
+func (f legacyField) count() int {
+	c := 0
+	for _, x := range f {
+		c += legacyCount[x]
+	}
+	return c
+}
+
+func (f legacyField) common(b legacyField) int {
+	c := 0
+	for i, x := range b {
+		c += legacyCount[f[i]&x]
+	}
+	return c
+}
+
+func TestLegacyAgreement(t *testing.T) {
+	for _, s := range benchSizes {
+		f, b := benchFields(s.bits)
+		lf, lb := toLegacy(f), toLegacy(b)
+		if f.Count() != lf.count() {
+			t.Errorf("%s: Count error: expecting %d, found %d", s.name, lf.count(), f.Count())
+		}
+		if f.Common(b) != lf.common(lb) {
+			t.Errorf("%s: Common error: expecting %d, found %d", s.name, lf.common(lb), f.Common(b))
+		}
+	}
+}
+
+func BenchmarkCount(b *testing.B) {
+	for _, s := range benchSizes {
+		f, _ := benchFields(s.bits)
+		b.Run(s.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				f.Count()
+			}
+		})
+	}
+}
+
+func BenchmarkCountLegacy(b *testing.B) {
+	for _, s := range benchSizes {
+		f, _ := benchFields(s.bits)
+		lf := toLegacy(f)
+		b.Run(s.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				lf.count()
+			}
+		})
+	}
+}
+
+func BenchmarkCommon(b *testing.B) {
+	for _, s := range benchSizes {
+		f, o := benchFields(s.bits)
+		b.Run(s.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				f.Common(o)
+			}
+		})
+	}
+}
+
+func BenchmarkCommonLegacy(b *testing.B) {
+	for _, s := range benchSizes {
+		f, o := benchFields(s.bits)
+		lf, lo := toLegacy(f), toLegacy(o)
+		b.Run(s.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				lf.common(lo)
+			}
+		})
+	}
+}
+
+func BenchmarkUnion(b *testing.B) {
+	for _, s := range benchSizes {
+		f, o := benchFields(s.bits)
+		b.Run(s.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				f.Union(o)
+			}
+		})
+	}
+}
@@ -2,61 +2,187 @@
 // All rights reserved.
 // Distributed under BSD2 license that can be found in the LICENSE file.
 
+// Package bitfield implements sets of bits, either as a dense field of
+// 64-bit words, or as a compressed sparse bitfield.
 package bitfield
 
+import "math/bits"
+
 // A Bitfield is a field of bits.
-type Bitfield []uint16
+type Bitfield []uint64
 
 // BitsPerField is the number of bits in each field.
-const BitsPerField = 16
-
-// bitCount stores the amount of bits in a singe field element.
-var bitCount [65536]int
-
-func init() {
-	// set bitCount
-	for i := range bitCount {
-		c := 0
-		for j := uint(0); j < BitsPerField; j++ {
-			bit := 1 << j
-			if (i & bit) != 0 {
-				c++
-			}
-		}
-		bitCount[i] = c
-	}
+const BitsPerField = 64
+
+// Fields returns the number of fields required to store n bits.
+func Fields(n int) int {
+	return (n + BitsPerField - 1) / BitsPerField
+}
+
+// New returns a new bitfield with room for n bits.
+func New(n int) Bitfield {
+	return make(Bitfield, Fields(n))
 }
 
 // IsOn returns true if the indicated bit is on in the bitfield.
 func (f Bitfield) IsOn(b int) bool {
 	i := b / BitsPerField
-	s := uint16(b) % BitsPerField
-	if (f[i] & (1 << s)) == 0 {
+	s := uint(b) % BitsPerField
+	return (f[i] & (1 << s)) != 0
+}
+
+// has is like IsOn, but returns false if the bit is outside the bitfield.
+func (f Bitfield) has(b int) bool {
+	if i := b / BitsPerField; i >= len(f) {
 		return false
 	}
-	return true
+	return f.IsOn(b)
 }
 
 // PutOn sets a bit as on.
 func (f Bitfield) PutOn(b int) {
 	i := b / BitsPerField
-	s := uint16(b) % BitsPerField
+	s := uint(b) % BitsPerField
 	f[i] |= 1 << s
 }
 
+// PutOff sets a bit as off.
+func (f Bitfield) PutOff(b int) {
+	i := b / BitsPerField
+	s := uint(b) % BitsPerField
+	f[i] &^= 1 << s
+}
+
+// flip changes the state of a bit.
+func (f Bitfield) flip(b int) {
+	i := b / BitsPerField
+	s := uint(b) % BitsPerField
+	f[i] ^= 1 << s
+}
+
+// Clone returns a new copy of f.
+func (f Bitfield) Clone() Bitfield {
+	cp := make(Bitfield, len(f))
+	copy(cp, f)
+	return cp
+}
+
+// Copy sets the content of f as equal to b.
+func (f Bitfield) Copy(b Set) {
+	switch x := b.(type) {
+	case Bitfield:
+		copy(f, x)
+	case *Sparse:
+		f.Reset()
+		x.ForEach(f.PutOn)
+	}
+}
+
+// IsEmpty returns true if no bit of f is on.
+func (f Bitfield) IsEmpty() bool {
+	for _, x := range f {
+		if x != 0 {
+			return false
+		}
+	}
+	return true
+}
+
 // Union adds the content of bitfield b into f.
-func (f Bitfield) Union(b Bitfield) {
-	for i, x := range b {
-		f[i] |= x
+func (f Bitfield) Union(b Set) {
+	switch x := b.(type) {
+	case Bitfield:
+		for i, w := range x {
+			f[i] |= w
+		}
+	case *Sparse:
+		x.ForEach(f.PutOn)
 	}
 }
 
+// Intersect keeps in f only the bits that are also on in b.
+func (f Bitfield) Intersect(b Set) {
+	switch x := b.(type) {
+	case Bitfield:
+		for i, w := range x {
+			f[i] &= w
+		}
+	case *Sparse:
+		f.ForEach(func(b int) {
+			if !x.IsOn(b) {
+				f.PutOff(b)
+			}
+		})
+	}
+}
+
+// Difference removes from f all the bits that are on in b.
+func (f Bitfield) Difference(b Set) {
+	switch x := b.(type) {
+	case Bitfield:
+		for i, w := range x {
+			f[i] &^= w
+		}
+	case *Sparse:
+		x.ForEach(f.PutOff)
+	}
+}
+
+// SymmetricDifference keeps in f only the bits that are on either in f or
+// in b, but not in both.
+func (f Bitfield) SymmetricDifference(b Set) {
+	switch x := b.(type) {
+	case Bitfield:
+		for i, w := range x {
+			f[i] ^= w
+		}
+	case *Sparse:
+		x.ForEach(f.flip)
+	}
+}
+
+// Or returns a new bitfield with the union of a and b.
+func Or(a, b Bitfield) Bitfield {
+	f := a.Clone()
+	f.Union(b)
+	return f
+}
+
+// And returns a new bitfield with the intersection of a and b.
+func And(a, b Bitfield) Bitfield {
+	f := a.Clone()
+	f.Intersect(b)
+	return f
+}
+
+// AndNot returns a new bitfield with the bits of a that are not in b.
+func AndNot(a, b Bitfield) Bitfield {
+	f := a.Clone()
+	f.Difference(b)
+	return f
+}
+
+// Xor returns a new bitfield with the symmetric difference of a and b.
+func Xor(a, b Bitfield) Bitfield {
+	f := a.Clone()
+	f.SymmetricDifference(b)
+	return f
+}
+
 // Common returns the number of common on bits between f and b.
-func (f Bitfield) Common(b Bitfield) int {
+func (f Bitfield) Common(b Set) int {
 	c := 0
-	for i, x := range b {
-		j := f[i] & x
-		c += bitCount[j]
+	switch x := b.(type) {
+	case Bitfield:
+		for i, w := range x {
+			c += bits.OnesCount64(f[i] & w)
+		}
+	case *Sparse:
+		x.ForEach(func(b int) {
+			if f.has(b) {
+				c++
+			}
+		})
 	}
 	return c
 }
@@ -65,7 +191,7 @@ func (f Bitfield) Common(b Bitfield) int {
 func (f Bitfield) Count() int {
 	c := 0
 	for _, x := range f {
-		c += bitCount[x]
+		c += bits.OnesCount64(x)
 	}
 	return c
 }
@@ -78,11 +204,64 @@ func (f Bitfield) Reset() {
 }
 
 // Equal returns true if all bits on both bitfields are equal.
-func (f Bitfield) Equal(b Bitfield) bool {
-	for i, x := range b {
-		if f[i] != x {
-			return false
+func (f Bitfield) Equal(b Set) bool {
+	switch x := b.(type) {
+	case Bitfield:
+		for i, w := range x {
+			if f[i] != w {
+				return false
+			}
 		}
+		return true
+	case *Sparse:
+		return x.Equal(f)
 	}
-	return true
+	return false
+}
+
+// Subset returns true if all on bits of f are also on in b.
+func (f Bitfield) Subset(b Set) bool {
+	switch x := b.(type) {
+	case Bitfield:
+		for i, w := range x {
+			if (f[i] &^ w) != 0 {
+				return false
+			}
+		}
+		return true
+	case *Sparse:
+		return x.Superset(f)
+	}
+	return false
+}
+
+// Superset returns true if all on bits of b are also on in f.
+func (f Bitfield) Superset(b Set) bool {
+	switch x := b.(type) {
+	case Bitfield:
+		return x.Subset(f)
+	case *Sparse:
+		return x.Subset(f)
+	}
+	return false
+}
+
+// ForEach calls fn for each on bit of f, in increasing order.
+func (f Bitfield) ForEach(fn func(b int)) {
+	for i, x := range f {
+		for x != 0 {
+			s := bits.TrailingZeros64(x)
+			fn((i * BitsPerField) + s)
+			x &= x - 1
+		}
+	}
+}
+
+// Bits returns the list of on bits of f, in increasing order.
+func (f Bitfield) Bits() []int {
+	ls := make([]int, 0, f.Count())
+	f.ForEach(func(b int) {
+		ls = append(ls, b)
+	})
+	return ls
 }
@@ -7,16 +7,38 @@ package bitfield
 import "testing"
 
 func TestBitCount(t *testing.T) {
-	mp := map[int]int{
-		0:     0,
-		1:     1,
-		67:    3,
-		101:   4,
-		38729: 8,
+	mp := map[uint64]int{
+		0:                  0,
+		1:                  1,
+		67:                 3,
+		101:                4,
+		38729:              8,
+		38729 << 48:        8,
+		0xFFFFFFFFFFFFFFFF: 64,
 	}
 	for i, v := range mp {
-		if bitCount[i] != v {
-			t.Errorf("bitCount error: expecting %d, found %d", v, bitCount[i])
+		f := Bitfield{i}
+		if f.Count() != v {
+			t.Errorf("Count error: expecting %d, found %d", v, f.Count())
+		}
+	}
+}
+
+func TestFields(t *testing.T) {
+	mp := map[int]int{
+		0:   0,
+		1:   1,
+		64:  1,
+		65:  2,
+		128: 2,
+		129: 3,
+	}
+	for n, v := range mp {
+		if Fields(n) != v {
+			t.Errorf("Fields error: expecting %d, found %d", v, Fields(n))
+		}
+		if len(New(n)) != v {
+			t.Errorf("New error: expecting %d, found %d", v, len(New(n)))
 		}
 	}
 }
@@ -24,7 +46,7 @@ func TestBitCount(t *testing.T) {
 func TestBitfieldOps(t *testing.T) {
 	f := make(Bitfield, 2)
 	b := Bitfield{
-		101,
+		101 | (73 << 16),
 		73,
 	}
 
@@ -37,35 +59,122 @@ func TestBitfieldOps(t *testing.T) {
 		22,
 		19,
 		16,
+		64,
 	}
 	for _, i := range bt {
 		f.PutOn(i)
 	}
-	if f[1] != 38729 {
-		t.Errorf("PutOn error: expecting %d, found %d", 38729, f[1])
+	if f[0] != 38729<<16 {
+		t.Errorf("PutOn error: expecting %d, found %d", uint64(38729<<16), f[0])
+	}
+	if f[1] != 1 {
+		t.Errorf("PutOn error: expecting %d, found %d", 1, f[1])
 	}
 	for _, i := range bt {
 		if !f.IsOn(i) {
-			t.Errorf("IsOn error: expecting %d, found %d", 38729, f[1])
+			t.Errorf("IsOn error: bit %d expected on", i)
 		}
 	}
+	if f.IsOn(0) || f.IsOn(65) {
+		t.Errorf("IsOn error: bits %d and %d expected off", 0, 65)
+	}
 	if f.Count() != len(bt) {
-		t.Errorf("Count error: expecting %d, found %d", len(bt), f.Count)
+		t.Errorf("Count error: expecting %d, found %d", len(bt), f.Count())
 	}
-	if f.Common(b) != 3 {
-		t.Errorf("Common error: expecting %d, found %d", 3, f.Common(b))
+	if f.Common(b) != 4 {
+		t.Errorf("Common error: expecting %d, found %d", 4, f.Common(b))
 	}
 	f.Union(b)
-	if f[0] != b[0] {
-		t.Errorf("Union error: expecting %d, found %d", b[0], f[0])
+	if f[0] != (38729<<16)|101 {
+		t.Errorf("Union error: expecting %d, found %d", uint64((38729<<16)|101), f[0])
 	}
-	if f[1] != 38729 {
-		t.Errorf("Union error: expecting %d, found %d", 38729, f[1])
+	if f[1] != 73 {
+		t.Errorf("Union error: expecting %d, found %d", 73, f[1])
+	}
+	cp := make(Bitfield, 2)
+	copy(cp, f)
+	if !cp.Equal(f) {
+		t.Errorf("Equal error: copy should be equal")
 	}
 	f.Reset()
 	for _, x := range f {
 		if x != 0 {
-			t.Errorf("Union error: expecting %d, found %d", 0, x)
+			t.Errorf("Reset error: expecting %d, found %d", 0, x)
+		}
+	}
+	if cp.Equal(f) {
+		t.Errorf("Equal error: reseted bitfield should be different")
+	}
+}
+
+func TestSetOps(t *testing.T) {
+	a := New(130)
+	b := New(130)
+	for _, i := range []int{1, 5, 64, 100, 129} {
+		a.PutOn(i)
+	}
+	for _, i := range []int{5, 64, 70} {
+		b.PutOn(i)
+	}
+
+	tests := []struct {
+		name string
+		f    Bitfield
+		want []int
+	}{
+		{"Or", Or(a, b), []int{1, 5, 64, 70, 100, 129}},
+		{"And", And(a, b), []int{5, 64}},
+		{"AndNot", AndNot(a, b), []int{1, 100, 129}},
+		{"Xor", Xor(a, b), []int{1, 70, 100, 129}},
+	}
+	for _, tc := range tests {
+		got := tc.f.Bits()
+		if len(got) != len(tc.want) {
+			t.Errorf("%s error: expecting %v, found %v", tc.name, tc.want, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != tc.want[i] {
+				t.Errorf("%s error: expecting %v, found %v", tc.name, tc.want, got)
+				break
+			}
+		}
+	}
+	if a.Count() != 5 {
+		t.Errorf("allocating operations should not modify the operands")
+	}
+
+	c := a.Clone()
+	c.Intersect(b)
+	if !c.Equal(And(a, b)) {
+		t.Errorf("Intersect error: expecting %v, found %v", And(a, b).Bits(), c.Bits())
+	}
+	if !c.Subset(a) || !c.Subset(b) || !a.Superset(c) {
+		t.Errorf("Subset error: intersection should be a subset of both operands")
+	}
+	if a.Subset(b) || b.Superset(a) {
+		t.Errorf("Subset error: %v is not a subset of %v", a.Bits(), b.Bits())
+	}
+	c.Difference(a)
+	if !c.IsEmpty() {
+		t.Errorf("Difference error: expecting empty, found %v", c.Bits())
+	}
+	c.SymmetricDifference(b)
+	if !c.Equal(b) {
+		t.Errorf("SymmetricDifference error: expecting %v, found %v", b.Bits(), c.Bits())
+	}
+	c.PutOff(64)
+	if c.IsOn(64) || c.Count() != 2 {
+		t.Errorf("PutOff error: bit %d expected off", 64)
+	}
+	n := 0
+	a.ForEach(func(b int) {
+		if !a.IsOn(b) {
+			t.Errorf("ForEach error: bit %d is off", b)
 		}
+		n++
+	})
+	if n != a.Count() {
+		t.Errorf("ForEach error: expecting %d bits, found %d", a.Count(), n)
 	}
 }
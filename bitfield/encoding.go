@@ -0,0 +1,239 @@
+// Copyright (c) 2015, J. Salvador Arias <jsalarias@csnat.unt.edu.ar>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package bitfield
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Binary encoding.
+//
+// The binary encoding of a set starts with a byte that indicates the
+// implementation ('d' for a Bitfield, 's' for a Sparse). A Bitfield is then
+// stored as the number of words (as an uvarint), followed by each word in
+// little endian order. A Sparse is stored as the number of containers
+// (as an uvarint), and for each container its key and its number of bits
+// (both as uvarints), followed by the sorted values (as 2 byte little endian
+// integers) if the container stores 4096 or less bits, or the 1024 words of
+// the bitmap (in little endian order) otherwise.
+//
+// The text encoding is the base64 encoding of the binary encoding. As the
+// text encoding is used by encoding/json, sets are stored as JSON strings.
+
+// Encoding kinds.
+const (
+	denseKind  = 'd'
+	sparseKind = 's'
+)
+
+// ErrInvalidData is returned when decoding a malformed bitfield.
+var ErrInvalidData = errors.New("bitfield: invalid encoded data")
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface.
+func (f Bitfield) MarshalBinary() ([]byte, error) {
+	data := make([]byte, 0, 1+binary.MaxVarintLen64+(len(f)*8))
+	data = append(data, denseKind)
+	data = binary.AppendUvarint(data, uint64(len(f)))
+	for _, x := range f {
+		data = binary.LittleEndian.AppendUint64(data, x)
+	}
+	return data, nil
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface.
+func (f *Bitfield) UnmarshalBinary(data []byte) error {
+	if (len(data) == 0) || (data[0] != denseKind) {
+		return ErrInvalidData
+	}
+	data = data[1:]
+	ln, n := binary.Uvarint(data)
+	if n <= 0 {
+		return ErrInvalidData
+	}
+	data = data[n:]
+	if (ln > uint64(len(data))/8) || (uint64(len(data)) != ln*8) {
+		return ErrInvalidData
+	}
+	nf := make(Bitfield, ln)
+	for i := range nf {
+		nf[i] = binary.LittleEndian.Uint64(data[i*8:])
+	}
+	*f = nf
+	return nil
+}
+
+// MarshalText implements the encoding.TextMarshaler interface.
+func (f Bitfield) MarshalText() ([]byte, error) {
+	data, err := f.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return encodeText(data), nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.
+func (f *Bitfield) UnmarshalText(text []byte) error {
+	data, err := decodeText(text)
+	if err != nil {
+		return err
+	}
+	return f.UnmarshalBinary(data)
+}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface.
+func (s *Sparse) MarshalBinary() ([]byte, error) {
+	data := []byte{sparseKind}
+	data = binary.AppendUvarint(data, uint64(len(s.cs)))
+	for i := range s.cs {
+		c := &s.cs[i]
+		data = binary.AppendUvarint(data, uint64(c.key))
+		data = binary.AppendUvarint(data, uint64(c.n))
+		if c.bmp != nil {
+			for _, x := range c.bmp {
+				data = binary.LittleEndian.AppendUint64(data, x)
+			}
+			continue
+		}
+		for _, v := range c.arr {
+			data = binary.LittleEndian.AppendUint16(data, v)
+		}
+	}
+	return data, nil
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface.
+func (s *Sparse) UnmarshalBinary(data []byte) error {
+	if (len(data) == 0) || (data[0] != sparseKind) {
+		return ErrInvalidData
+	}
+	data = data[1:]
+	ln, n := binary.Uvarint(data)
+	if n <= 0 {
+		return ErrInvalidData
+	}
+	data = data[n:]
+	var cs []container
+	prev := -1
+	for i := uint64(0); i < ln; i++ {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return ErrInvalidData
+		}
+		data = data[n:]
+		card, n := binary.Uvarint(data)
+		if (n <= 0) || (card == 0) || (card > containerBits) {
+			return ErrInvalidData
+		}
+		data = data[n:]
+		if int(key) <= prev {
+			return fmt.Errorf("bitfield: container %d: unsorted key", i)
+		}
+		prev = int(key)
+		c := container{key: int(key), n: int(card)}
+		if card > arrayMax {
+			if len(data) < bitmapWords*8 {
+				return ErrInvalidData
+			}
+			c.bmp = make([]uint64, bitmapWords)
+			for j := range c.bmp {
+				c.bmp[j] = binary.LittleEndian.Uint64(data[j*8:])
+			}
+			data = data[bitmapWords*8:]
+			c.count()
+			if uint64(c.n) != card {
+				return fmt.Errorf("bitfield: container %d: invalid number of bits", i)
+			}
+		} else {
+			if uint64(len(data)) < card*2 {
+				return ErrInvalidData
+			}
+			c.arr = make([]uint16, card)
+			for j := range c.arr {
+				c.arr[j] = binary.LittleEndian.Uint16(data[j*2:])
+				if (j > 0) && (c.arr[j] <= c.arr[j-1]) {
+					return fmt.Errorf("bitfield: container %d: unsorted values", i)
+				}
+			}
+			data = data[card*2:]
+		}
+		cs = append(cs, c)
+	}
+	if len(data) != 0 {
+		return ErrInvalidData
+	}
+	s.cs = cs
+	return nil
+}
+
+// MarshalText implements the encoding.TextMarshaler interface.
+func (s *Sparse) MarshalText() ([]byte, error) {
+	data, err := s.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return encodeText(data), nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.
+func (s *Sparse) UnmarshalText(text []byte) error {
+	data, err := decodeText(text)
+	if err != nil {
+		return err
+	}
+	return s.UnmarshalBinary(data)
+}
+
+// Unmarshal decodes a set stored in binary format, returning a Bitfield or
+// a Sparse according to the encoded data.
+func Unmarshal(data []byte) (Set, error) {
+	if len(data) == 0 {
+		return nil, ErrInvalidData
+	}
+	switch data[0] {
+	case denseKind:
+		var f Bitfield
+		if err := f.UnmarshalBinary(data); err != nil {
+			return nil, err
+		}
+		return f, nil
+	case sparseKind:
+		s := NewSparse()
+		if err := s.UnmarshalBinary(data); err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+	return nil, ErrInvalidData
+}
+
+// UnmarshalText decodes a set stored in text format, returning a Bitfield
+// or a Sparse according to the encoded data.
+func UnmarshalText(text []byte) (Set, error) {
+	data, err := decodeText(text)
+	if err != nil {
+		return nil, err
+	}
+	return Unmarshal(data)
+}
+
+// encodeText returns the text encoding of binary data.
+func encodeText(data []byte) []byte {
+	text := make([]byte, base64.StdEncoding.EncodedLen(len(data)))
+	base64.StdEncoding.Encode(text, data)
+	return text
+}
+
+// decodeText returns the binary data of a text encoding.
+func decodeText(text []byte) ([]byte, error) {
+	data := make([]byte, base64.StdEncoding.DecodedLen(len(text)))
+	n, err := base64.StdEncoding.Decode(data, text)
+	if err != nil {
+		return nil, fmt.Errorf("bitfield: %v", err)
+	}
+	return data[:n], nil
+}
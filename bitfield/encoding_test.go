@@ -0,0 +1,139 @@
+// Copyright (c) 2015, J. Salvador Arias <jsalarias@csnat.unt.edu.ar>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package bitfield
+
+import (
+	"encoding/json"
+	"math/rand"
+	"testing"
+)
+
+func TestBitfieldEncoding(t *testing.T) {
+	rnd := rand.New(rand.NewSource(4))
+	f, _ := randomSets(rnd, true)
+
+	data, err := f.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary error: %v", err)
+	}
+	var bin Bitfield
+	if err := bin.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary error: %v", err)
+	}
+	if (len(bin) != len(f)) || !bin.Equal(f) {
+		t.Errorf("binary round-trip error: bitfields are different")
+	}
+
+	text, err := f.MarshalText()
+	if err != nil {
+		t.Fatalf("MarshalText error: %v", err)
+	}
+	var txt Bitfield
+	if err := txt.UnmarshalText(text); err != nil {
+		t.Fatalf("UnmarshalText error: %v", err)
+	}
+	if (len(txt) != len(f)) || !txt.Equal(f) {
+		t.Errorf("text round-trip error: bitfields are different")
+	}
+
+	if err := bin.UnmarshalBinary(data[:len(data)-1]); err == nil {
+		t.Errorf("UnmarshalBinary error: expecting error on truncated data")
+	}
+	if err := bin.UnmarshalText([]byte("not base64!")); err == nil {
+		t.Errorf("UnmarshalText error: expecting error on invalid text")
+	}
+}
+
+func TestSparseEncoding(t *testing.T) {
+	rnd := rand.New(rand.NewSource(5))
+	_, s := randomSets(rnd, true)
+
+	data, err := s.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary error: %v", err)
+	}
+	bin := NewSparse()
+	if err := bin.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary error: %v", err)
+	}
+	if !bin.Equal(s) {
+		t.Errorf("binary round-trip error: bitfields are different")
+	}
+
+	text, err := s.MarshalText()
+	if err != nil {
+		t.Fatalf("MarshalText error: %v", err)
+	}
+	txt := NewSparse()
+	if err := txt.UnmarshalText(text); err != nil {
+		t.Fatalf("UnmarshalText error: %v", err)
+	}
+	if !txt.Equal(s) {
+		t.Errorf("text round-trip error: bitfields are different")
+	}
+
+	if err := bin.UnmarshalBinary(data[:len(data)-1]); err == nil {
+		t.Errorf("UnmarshalBinary error: expecting error on truncated data")
+	}
+}
+
+func TestUnmarshalSet(t *testing.T) {
+	rnd := rand.New(rand.NewSource(6))
+	f, s := randomSets(rnd, false)
+	for _, v := range []Set{f, s} {
+		text, err := v.(interface{ MarshalText() ([]byte, error) }).MarshalText()
+		if err != nil {
+			t.Fatalf("MarshalText error: %v", err)
+		}
+		u, err := UnmarshalText(text)
+		if err != nil {
+			t.Fatalf("UnmarshalText error: %v", err)
+		}
+		switch v.(type) {
+		case Bitfield:
+			if _, ok := u.(Bitfield); !ok {
+				t.Errorf("UnmarshalText error: expecting a Bitfield, found %T", u)
+			}
+		case *Sparse:
+			if _, ok := u.(*Sparse); !ok {
+				t.Errorf("UnmarshalText error: expecting a Sparse, found %T", u)
+			}
+		}
+		if !u.Equal(v) {
+			t.Errorf("UnmarshalText error: sets are different")
+		}
+	}
+	if _, err := Unmarshal([]byte{'x', 0}); err == nil {
+		t.Errorf("Unmarshal error: expecting error on unknown kind")
+	}
+}
+
+func TestJSONEncoding(t *testing.T) {
+	type recons struct {
+		Node string
+		Obs  Bitfield
+		Fill *Sparse
+	}
+	rnd := rand.New(rand.NewSource(7))
+	f, s := randomSets(rnd, false)
+	in := recons{Node: "n1", Obs: f, Fill: s}
+	data, err := json.Marshal(in)
+	if err != nil {
+		t.Fatalf("json.Marshal error: %v", err)
+	}
+	var out recons
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatalf("json.Unmarshal error: %v", err)
+	}
+	if out.Node != in.Node {
+		t.Errorf("json round-trip error: expecting %q, found %q", in.Node, out.Node)
+	}
+	if !out.Obs.Equal(f) || (len(out.Obs) != len(f)) {
+		t.Errorf("json round-trip error: bitfields are different")
+	}
+	if (out.Fill == nil) || !out.Fill.Equal(s) {
+		t.Errorf("json round-trip error: sparse bitfields are different")
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright (c) 2015, J. Salvador Arias <jsalarias@csnat.unt.edu.ar>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package bitfield
+
+import "encoding"
+
+// A Set is a set of bits. It is implemented by the dense Bitfield, and by
+// the compressed Sparse bitfield. Operations between sets of different
+// implementations are allowed, but they are slower than operations between
+// sets of the same kind.
+type Set interface {
+	// IsOn returns true if the indicated bit is on.
+	IsOn(b int) bool
+	// PutOn sets a bit as on.
+	PutOn(b int)
+	// PutOff sets a bit as off.
+	PutOff(b int)
+	// Count returns the number of on bits.
+	Count() int
+	// IsEmpty returns true if no bit is on.
+	IsEmpty() bool
+	// Reset put in zero (off) all bits.
+	Reset()
+	// ForEach calls fn for each on bit, in increasing order.
+	ForEach(fn func(b int))
+	// Bits returns the list of on bits, in increasing order.
+	Bits() []int
+
+	// Copy sets the content of the set as equal to b.
+	Copy(b Set)
+	// Union adds the content of b.
+	Union(b Set)
+	// Intersect keeps only the bits that are also on in b.
+	Intersect(b Set)
+	// Difference removes all the bits that are on in b.
+	Difference(b Set)
+	// SymmetricDifference keeps only the bits that are on either in the
+	// set or in b, but not in both.
+	SymmetricDifference(b Set)
+	// Common returns the number of common on bits with b.
+	Common(b Set) int
+	// Equal returns true if the on bits are the same as in b.
+	Equal(b Set) bool
+	// Subset returns true if all on bits are also on in b.
+	Subset(b Set) bool
+	// Superset returns true if all on bits of b are also on.
+	Superset(b Set) bool
+
+	// Sets can be stored in binary and text formats, and read back with
+	// Unmarshal and UnmarshalText.
+	encoding.BinaryMarshaler
+	encoding.TextMarshaler
+}
+
+// Clone returns a new copy of the set s, using the same implementation.
+func Clone(s Set) Set {
+	switch x := s.(type) {
+	case Bitfield:
+		return x.Clone()
+	case *Sparse:
+		return x.Clone()
+	}
+	panic("bitfield: unknown set implementation")
+}
@@ -0,0 +1,661 @@
+// Copyright (c) 2015, J. Salvador Arias <jsalarias@csnat.unt.edu.ar>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package bitfield
+
+import (
+	"math/bits"
+	"sort"
+)
+
+// Container limits of a sparse bitfield.
+const (
+	containerBits = 1 << 16                      // bits in a container
+	bitmapWords   = containerBits / BitsPerField // words in a bitmap
+	arrayMax      = 4096                         // max size of an array
+)
+
+// A container stores the bits of a sparse bitfield that share the same
+// high bits (the key). If the container has few bits, they are stored as a
+// sorted array, otherwise they are stored as a bitmap.
+type container struct {
+	key int
+	n   int      // number of on bits
+	arr []uint16 // sorted values, if bmp is nil
+	bmp []uint64 // bitmap
+}
+
+// A Sparse is a compressed bitfield, in which bits are grouped in blocks of
+// 65536 bits, and only blocks with on bits are stored. It is much smaller
+// than a Bitfield when the fraction of on bits is low.
+type Sparse struct {
+	cs []container // sorted by key
+}
+
+// NewSparse returns a new empty sparse bitfield.
+func NewSparse() *Sparse {
+	return &Sparse{}
+}
+
+// split returns the container key and the low bits of a bit.
+func split(b int) (int, uint16) {
+	return b >> 16, uint16(b & 0xFFFF)
+}
+
+// find returns the position of the container with the given key, and true
+// if the container exists.
+func (s *Sparse) find(key int) (int, bool) {
+	i := sort.Search(len(s.cs), func(i int) bool {
+		return s.cs[i].key >= key
+	})
+	return i, (i < len(s.cs)) && (s.cs[i].key == key)
+}
+
+// IsOn returns true if the indicated bit is on in the bitfield.
+func (s *Sparse) IsOn(b int) bool {
+	k, v := split(b)
+	i, ok := s.find(k)
+	if !ok {
+		return false
+	}
+	return s.cs[i].contains(v)
+}
+
+// PutOn sets a bit as on.
+func (s *Sparse) PutOn(b int) {
+	k, v := split(b)
+	i, ok := s.find(k)
+	if !ok {
+		s.cs = append(s.cs, container{})
+		copy(s.cs[i+1:], s.cs[i:])
+		s.cs[i] = container{key: k}
+	}
+	s.cs[i].add(v)
+}
+
+// PutOff sets a bit as off.
+func (s *Sparse) PutOff(b int) {
+	k, v := split(b)
+	i, ok := s.find(k)
+	if !ok {
+		return
+	}
+	s.cs[i].remove(v)
+	if s.cs[i].n == 0 {
+		s.cs = append(s.cs[:i], s.cs[i+1:]...)
+	}
+}
+
+// flip changes the state of a bit.
+func (s *Sparse) flip(b int) {
+	if s.IsOn(b) {
+		s.PutOff(b)
+		return
+	}
+	s.PutOn(b)
+}
+
+// Clone returns a new copy of s.
+func (s *Sparse) Clone() *Sparse {
+	cp := &Sparse{cs: make([]container, len(s.cs))}
+	for i := range s.cs {
+		cp.cs[i] = s.cs[i].clone()
+	}
+	return cp
+}
+
+// Copy sets the content of s as equal to b.
+func (s *Sparse) Copy(b Set) {
+	switch x := b.(type) {
+	case *Sparse:
+		if x == s {
+			return
+		}
+		s.cs = s.cs[:0]
+		for i := range x.cs {
+			s.cs = append(s.cs, x.cs[i].clone())
+		}
+	case Bitfield:
+		s.Reset()
+		for i := 0; i < len(x); i += bitmapWords {
+			end := i + bitmapWords
+			if end > len(x) {
+				end = len(x)
+			}
+			c := container{key: i / bitmapWords, bmp: make([]uint64, bitmapWords)}
+			copy(c.bmp, x[i:end])
+			c.count()
+			if c.n == 0 {
+				continue
+			}
+			c.normalize()
+			s.cs = append(s.cs, c)
+		}
+	}
+}
+
+// Count returns the number of on bits in the bitfield.
+func (s *Sparse) Count() int {
+	c := 0
+	for i := range s.cs {
+		c += s.cs[i].n
+	}
+	return c
+}
+
+// IsEmpty returns true if no bit of s is on.
+func (s *Sparse) IsEmpty() bool {
+	return len(s.cs) == 0
+}
+
+// Reset put in zero (off) all bits of s.
+func (s *Sparse) Reset() {
+	s.cs = s.cs[:0]
+}
+
+// ForEach calls fn for each on bit of s, in increasing order.
+func (s *Sparse) ForEach(fn func(b int)) {
+	for i := range s.cs {
+		base := s.cs[i].key << 16
+		s.cs[i].forEach(func(v uint16) {
+			fn(base | int(v))
+		})
+	}
+}
+
+// Bits returns the list of on bits of s, in increasing order.
+func (s *Sparse) Bits() []int {
+	ls := make([]int, 0, s.Count())
+	s.ForEach(func(b int) {
+		ls = append(ls, b)
+	})
+	return ls
+}
+
+// Union adds the content of bitfield b into s.
+func (s *Sparse) Union(b Set) {
+	switch x := b.(type) {
+	case *Sparse:
+		cs := make([]container, 0, len(s.cs)+len(x.cs))
+		i, j := 0, 0
+		for (i < len(s.cs)) || (j < len(x.cs)) {
+			switch {
+			case j == len(x.cs), (i < len(s.cs)) && (s.cs[i].key < x.cs[j].key):
+				cs = append(cs, s.cs[i])
+				i++
+			case i == len(s.cs), x.cs[j].key < s.cs[i].key:
+				cs = append(cs, x.cs[j].clone())
+				j++
+			default:
+				s.cs[i].union(&x.cs[j])
+				cs = append(cs, s.cs[i])
+				i++
+				j++
+			}
+		}
+		s.cs = cs
+	case Bitfield:
+		x.ForEach(s.PutOn)
+	}
+}
+
+// Intersect keeps in s only the bits that are also on in b.
+func (s *Sparse) Intersect(b Set) {
+	switch x := b.(type) {
+	case *Sparse:
+		cs := s.cs[:0]
+		for i := range s.cs {
+			j, ok := x.find(s.cs[i].key)
+			if !ok {
+				continue
+			}
+			s.cs[i].intersect(&x.cs[j])
+			if s.cs[i].n == 0 {
+				continue
+			}
+			cs = append(cs, s.cs[i])
+		}
+		s.cs = cs
+	case Bitfield:
+		for _, v := range s.Bits() {
+			if !x.has(v) {
+				s.PutOff(v)
+			}
+		}
+	}
+}
+
+// Difference removes from s all the bits that are on in b.
+func (s *Sparse) Difference(b Set) {
+	switch x := b.(type) {
+	case *Sparse:
+		cs := s.cs[:0]
+		for i := range s.cs {
+			if j, ok := x.find(s.cs[i].key); ok {
+				s.cs[i].difference(&x.cs[j])
+				if s.cs[i].n == 0 {
+					continue
+				}
+			}
+			cs = append(cs, s.cs[i])
+		}
+		s.cs = cs
+	case Bitfield:
+		for _, v := range s.Bits() {
+			if x.has(v) {
+				s.PutOff(v)
+			}
+		}
+	}
+}
+
+// SymmetricDifference keeps in s only the bits that are on either in s or
+// in b, but not in both.
+func (s *Sparse) SymmetricDifference(b Set) {
+	switch x := b.(type) {
+	case *Sparse:
+		cs := make([]container, 0, len(s.cs)+len(x.cs))
+		i, j := 0, 0
+		for (i < len(s.cs)) || (j < len(x.cs)) {
+			switch {
+			case j == len(x.cs), (i < len(s.cs)) && (s.cs[i].key < x.cs[j].key):
+				cs = append(cs, s.cs[i])
+				i++
+			case i == len(s.cs), x.cs[j].key < s.cs[i].key:
+				cs = append(cs, x.cs[j].clone())
+				j++
+			default:
+				s.cs[i].xor(&x.cs[j])
+				if s.cs[i].n > 0 {
+					cs = append(cs, s.cs[i])
+				}
+				i++
+				j++
+			}
+		}
+		s.cs = cs
+	case Bitfield:
+		x.ForEach(s.flip)
+	}
+}
+
+// Common returns the number of common on bits between s and b.
+func (s *Sparse) Common(b Set) int {
+	c := 0
+	switch x := b.(type) {
+	case *Sparse:
+		for i := range s.cs {
+			if j, ok := x.find(s.cs[i].key); ok {
+				c += s.cs[i].common(&x.cs[j])
+			}
+		}
+	case Bitfield:
+		s.ForEach(func(b int) {
+			if x.has(b) {
+				c++
+			}
+		})
+	}
+	return c
+}
+
+// Equal returns true if all bits on both bitfields are equal.
+func (s *Sparse) Equal(b Set) bool {
+	switch x := b.(type) {
+	case *Sparse:
+		if len(s.cs) != len(x.cs) {
+			return false
+		}
+		for i := range s.cs {
+			if !s.cs[i].equal(&x.cs[i]) {
+				return false
+			}
+		}
+		return true
+	case Bitfield:
+		return (s.Count() == x.Count()) && s.Subset(x)
+	}
+	return false
+}
+
+// Subset returns true if all on bits of s are also on in b.
+func (s *Sparse) Subset(b Set) bool {
+	switch x := b.(type) {
+	case *Sparse:
+		for i := range s.cs {
+			j, ok := x.find(s.cs[i].key)
+			if !ok {
+				return false
+			}
+			if !s.cs[i].subset(&x.cs[j]) {
+				return false
+			}
+		}
+		return true
+	case Bitfield:
+		sub := true
+		s.ForEach(func(b int) {
+			if !x.has(b) {
+				sub = false
+			}
+		})
+		return sub
+	}
+	return false
+}
+
+// Superset returns true if all on bits of b are also on in s.
+func (s *Sparse) Superset(b Set) bool {
+	switch x := b.(type) {
+	case *Sparse:
+		return x.Subset(s)
+	case Bitfield:
+		sub := true
+		x.ForEach(func(b int) {
+			if !s.IsOn(b) {
+				sub = false
+			}
+		})
+		return sub
+	}
+	return false
+}
+
+// contains returns true if v is on in the container.
+func (c *container) contains(v uint16) bool {
+	if c.bmp != nil {
+		return (c.bmp[v/BitsPerField] & (1 << (v % BitsPerField))) != 0
+	}
+	i := sort.Search(len(c.arr), func(i int) bool {
+		return c.arr[i] >= v
+	})
+	return (i < len(c.arr)) && (c.arr[i] == v)
+}
+
+// add sets v as on in the container.
+func (c *container) add(v uint16) {
+	if c.bmp != nil {
+		w := &c.bmp[v/BitsPerField]
+		m := uint64(1) << (v % BitsPerField)
+		if (*w & m) == 0 {
+			*w |= m
+			c.n++
+		}
+		return
+	}
+	i := sort.Search(len(c.arr), func(i int) bool {
+		return c.arr[i] >= v
+	})
+	if (i < len(c.arr)) && (c.arr[i] == v) {
+		return
+	}
+	c.arr = append(c.arr, 0)
+	copy(c.arr[i+1:], c.arr[i:])
+	c.arr[i] = v
+	c.n++
+	c.normalize()
+}
+
+// remove sets v as off in the container.
+func (c *container) remove(v uint16) {
+	if c.bmp != nil {
+		w := &c.bmp[v/BitsPerField]
+		m := uint64(1) << (v % BitsPerField)
+		if (*w & m) != 0 {
+			*w &^= m
+			c.n--
+			c.normalize()
+		}
+		return
+	}
+	i := sort.Search(len(c.arr), func(i int) bool {
+		return c.arr[i] >= v
+	})
+	if (i < len(c.arr)) && (c.arr[i] == v) {
+		c.arr = append(c.arr[:i], c.arr[i+1:]...)
+		c.n--
+	}
+}
+
+// forEach calls fn for each on value of the container.
+func (c *container) forEach(fn func(v uint16)) {
+	if c.bmp == nil {
+		for _, v := range c.arr {
+			fn(v)
+		}
+		return
+	}
+	for i, x := range c.bmp {
+		for x != 0 {
+			s := bits.TrailingZeros64(x)
+			fn(uint16((i * BitsPerField) + s))
+			x &= x - 1
+		}
+	}
+}
+
+// clone returns a copy of the container.
+func (c *container) clone() container {
+	cp := container{key: c.key, n: c.n}
+	if c.bmp != nil {
+		cp.bmp = make([]uint64, bitmapWords)
+		copy(cp.bmp, c.bmp)
+		return cp
+	}
+	cp.arr = make([]uint16, len(c.arr))
+	copy(cp.arr, c.arr)
+	return cp
+}
+
+// count updates the number of on bits of a bitmap container.
+func (c *container) count() {
+	c.n = 0
+	for _, x := range c.bmp {
+		c.n += bits.OnesCount64(x)
+	}
+}
+
+// toBitmap sets the container as a bitmap.
+func (c *container) toBitmap() {
+	if c.bmp != nil {
+		return
+	}
+	c.bmp = make([]uint64, bitmapWords)
+	for _, v := range c.arr {
+		c.bmp[v/BitsPerField] |= 1 << (v % BitsPerField)
+	}
+	c.arr = nil
+}
+
+// normalize sets the container representation according to the number of
+// on bits.
+func (c *container) normalize() {
+	if (c.bmp == nil) && (c.n > arrayMax) {
+		c.toBitmap()
+		return
+	}
+	if (c.bmp != nil) && (c.n <= arrayMax) {
+		arr := make([]uint16, 0, c.n)
+		c.forEach(func(v uint16) {
+			arr = append(arr, v)
+		})
+		c.arr = arr
+		c.bmp = nil
+	}
+}
+
+// union adds the content of container o into c.
+func (c *container) union(o *container) {
+	if (c.bmp == nil) && (o.bmp == nil) {
+		arr := make([]uint16, 0, len(c.arr)+len(o.arr))
+		i, j := 0, 0
+		for (i < len(c.arr)) && (j < len(o.arr)) {
+			switch {
+			case c.arr[i] < o.arr[j]:
+				arr = append(arr, c.arr[i])
+				i++
+			case o.arr[j] < c.arr[i]:
+				arr = append(arr, o.arr[j])
+				j++
+			default:
+				arr = append(arr, c.arr[i])
+				i++
+				j++
+			}
+		}
+		arr = append(arr, c.arr[i:]...)
+		arr = append(arr, o.arr[j:]...)
+		c.arr = arr
+		c.n = len(arr)
+		c.normalize()
+		return
+	}
+	c.toBitmap()
+	if o.bmp == nil {
+		for _, v := range o.arr {
+			c.bmp[v/BitsPerField] |= 1 << (v % BitsPerField)
+		}
+	} else {
+		for i, x := range o.bmp {
+			c.bmp[i] |= x
+		}
+	}
+	c.count()
+}
+
+// intersect keeps in c only the values that are also on in o.
+func (c *container) intersect(o *container) {
+	if (c.bmp != nil) && (o.bmp != nil) {
+		for i, x := range o.bmp {
+			c.bmp[i] &= x
+		}
+		c.count()
+		c.normalize()
+		return
+	}
+	src, other := c, o
+	if c.bmp != nil {
+		src, other = o, c
+	}
+	arr := make([]uint16, 0, len(src.arr))
+	for _, v := range src.arr {
+		if other.contains(v) {
+			arr = append(arr, v)
+		}
+	}
+	c.arr = arr
+	c.bmp = nil
+	c.n = len(arr)
+}
+
+// difference removes from c all the values that are on in o.
+func (c *container) difference(o *container) {
+	if c.bmp == nil {
+		arr := c.arr[:0]
+		for _, v := range c.arr {
+			if !o.contains(v) {
+				arr = append(arr, v)
+			}
+		}
+		c.arr = arr
+		c.n = len(arr)
+		return
+	}
+	if o.bmp == nil {
+		for _, v := range o.arr {
+			c.bmp[v/BitsPerField] &^= 1 << (v % BitsPerField)
+		}
+	} else {
+		for i, x := range o.bmp {
+			c.bmp[i] &^= x
+		}
+	}
+	c.count()
+	c.normalize()
+}
+
+// xor keeps in c only the values that are on either in c or in o, but not
+// in both.
+func (c *container) xor(o *container) {
+	c.toBitmap()
+	if o.bmp == nil {
+		for _, v := range o.arr {
+			c.bmp[v/BitsPerField] ^= 1 << (v % BitsPerField)
+		}
+	} else {
+		for i, x := range o.bmp {
+			c.bmp[i] ^= x
+		}
+	}
+	c.count()
+	c.normalize()
+}
+
+// common returns the number of common on values between c and o.
+func (c *container) common(o *container) int {
+	n := 0
+	if (c.bmp != nil) && (o.bmp != nil) {
+		for i, x := range o.bmp {
+			n += bits.OnesCount64(c.bmp[i] & x)
+		}
+		return n
+	}
+	src, other := c, o
+	if c.bmp != nil {
+		src, other = o, c
+	}
+	for _, v := range src.arr {
+		if other.contains(v) {
+			n++
+		}
+	}
+	return n
+}
+
+// equal returns true if both containers have the same values.
+func (c *container) equal(o *container) bool {
+	if (c.key != o.key) || (c.n != o.n) {
+		return false
+	}
+	// as containers are normalized, both have the same representation
+	if c.bmp != nil {
+		for i, x := range o.bmp {
+			if c.bmp[i] != x {
+				return false
+			}
+		}
+		return true
+	}
+	for i, v := range o.arr {
+		if c.arr[i] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// subset returns true if all on values of c are also on in o.
+func (c *container) subset(o *container) bool {
+	if c.n > o.n {
+		return false
+	}
+	if (c.bmp != nil) && (o.bmp != nil) {
+		for i, x := range o.bmp {
+			if (c.bmp[i] &^ x) != 0 {
+				return false
+			}
+		}
+		return true
+	}
+	if c.bmp != nil {
+		// c is larger than any array container
+		return false
+	}
+	for _, v := range c.arr {
+		if !o.contains(v) {
+			return false
+		}
+	}
+	return true
+}
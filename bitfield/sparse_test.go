@@ -0,0 +1,159 @@
+// Copyright (c) 2015, J. Salvador Arias <jsalarias@csnat.unt.edu.ar>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package bitfield
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// sparseSize is the number of bits used in sparse tests, it spans several
+// containers.
+const sparseSize = 5 * containerBits
+
+// randomSets returns a dense and a sparse set with the same on bits. If
+// dense is true, the last container will be filled above the array limit.
+func randomSets(rnd *rand.Rand, dense bool) (Bitfield, *Sparse) {
+	f := New(sparseSize)
+	s := NewSparse()
+	for i := 0; i < 3000; i++ {
+		b := rnd.Intn(sparseSize)
+		f.PutOn(b)
+		s.PutOn(b)
+	}
+	if dense {
+		base := 4 * containerBits
+		for i := 0; i < 2*arrayMax; i++ {
+			b := base + rnd.Intn(containerBits)
+			f.PutOn(b)
+			s.PutOn(b)
+		}
+	}
+	return f, s
+}
+
+// sameBits returns true if a dense and a sparse set have the same on bits.
+func sameBits(f Bitfield, s *Sparse) bool {
+	fb, sb := f.Bits(), s.Bits()
+	if len(fb) != len(sb) {
+		return false
+	}
+	for i := range fb {
+		if fb[i] != sb[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSparseBits(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	f, s := randomSets(rnd, true)
+	if !sameBits(f, s) {
+		t.Fatalf("PutOn error: sparse and dense sets are different")
+	}
+	if s.Count() != f.Count() {
+		t.Errorf("Count error: expecting %d, found %d", f.Count(), s.Count())
+	}
+	for i := 0; i < 1000; i++ {
+		b := rnd.Intn(sparseSize)
+		if s.IsOn(b) != f.IsOn(b) {
+			t.Errorf("IsOn error: bit %d: expecting %v, found %v", b, f.IsOn(b), s.IsOn(b))
+		}
+	}
+	for _, b := range f.Bits() {
+		if rnd.Intn(2) == 0 {
+			continue
+		}
+		f.PutOff(b)
+		s.PutOff(b)
+	}
+	if !sameBits(f, s) {
+		t.Errorf("PutOff error: sparse and dense sets are different")
+	}
+	for i := range s.cs {
+		c := &s.cs[i]
+		if (c.bmp != nil) && (c.n <= arrayMax) {
+			t.Errorf("normalize error: container %d with %d bits stored as bitmap", c.key, c.n)
+		}
+		if (c.bmp == nil) && (c.n > arrayMax) {
+			t.Errorf("normalize error: container %d with %d bits stored as array", c.key, c.n)
+		}
+	}
+	s.Reset()
+	if !s.IsEmpty() || (s.Count() != 0) {
+		t.Errorf("Reset error: expecting empty set")
+	}
+}
+
+func TestSparseOps(t *testing.T) {
+	rnd := rand.New(rand.NewSource(2))
+	ops := []struct {
+		name string
+		fn   func(a, b Set)
+	}{
+		{"Union", func(a, b Set) { a.Union(b) }},
+		{"Intersect", func(a, b Set) { a.Intersect(b) }},
+		{"Difference", func(a, b Set) { a.Difference(b) }},
+		{"SymmetricDifference", func(a, b Set) { a.SymmetricDifference(b) }},
+	}
+	for _, op := range ops {
+		for _, dense := range []bool{false, true} {
+			fa, sa := randomSets(rnd, dense)
+			fb, sb := randomSets(rnd, !dense)
+			if fa.Common(fb) != sa.Common(sb) {
+				t.Errorf("Common error: expecting %d, found %d", fa.Common(fb), sa.Common(sb))
+			}
+			if fa.Common(sb) != sa.Common(fb) {
+				t.Errorf("Common error (mixed): expecting %d, found %d", fa.Common(fb), sa.Common(fb))
+			}
+
+			mixed := sa.Clone()
+			op.fn(fa, fb)
+			op.fn(sa, sb)
+			op.fn(mixed, fb)
+			if !sameBits(fa, sa) {
+				t.Errorf("%s error: sparse and dense sets are different", op.name)
+			}
+			if !sameBits(fa, mixed) {
+				t.Errorf("%s error (mixed): sparse and dense sets are different", op.name)
+			}
+			if !sa.Equal(fa) || !fa.Equal(sa) || !sa.Equal(mixed) {
+				t.Errorf("%s error: Equal should be true", op.name)
+			}
+		}
+	}
+}
+
+func TestSparseSubset(t *testing.T) {
+	rnd := rand.New(rand.NewSource(3))
+	f, s := randomSets(rnd, true)
+	sub := s.Clone()
+	for _, b := range sub.Bits() {
+		if rnd.Intn(3) == 0 {
+			sub.PutOff(b)
+		}
+	}
+	if !sub.Subset(s) || !s.Superset(sub) || !sub.Subset(f) || !f.Superset(sub) {
+		t.Errorf("Subset error: expecting a subset")
+	}
+	if s.Subset(sub) || sub.Superset(s) || f.Subset(sub) {
+		t.Errorf("Subset error: expecting a not subset")
+	}
+
+	cp := NewSparse()
+	cp.Copy(f)
+	if !sameBits(f, cp) {
+		t.Errorf("Copy error: sparse and dense sets are different")
+	}
+	d := New(sparseSize)
+	d.Copy(sub)
+	if !sameBits(d, sub) {
+		t.Errorf("Copy error: sparse and dense sets are different")
+	}
+	if !Clone(sub).Equal(d) {
+		t.Errorf("Clone error: sets should be equal")
+	}
+}
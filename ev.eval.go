@@ -5,6 +5,7 @@
 package main
 
 import (
+	"bufio"
 	"encoding/csv"
 	"fmt"
 	"os"
@@ -12,19 +13,26 @@ import (
 
 	"github.com/js-arias/evs/cmdapp"
 	"github.com/js-arias/evs/events"
-	"github.com/js-arias/evs/raster"
 )
 
 var evEval = &cmdapp.Command{
 	Run: evEvalRun,
-	UsageLine: `ev.eval [-b|--brlen] [-c|--columns number] [-f|--fill number]
+	UsageLine: `ev.eval [-b|--brlen] [--bbox box] [-c|--columns number]
+	[-f|--fill number] [--fillDist number] [--grid name] [--maps file]
+	[--mask file] [--maxUncert number] [--ranges file]
+	[--rangesName name] [--raster file] [--taxa file] [--uncertObs]
 	[-i|--input file] [--found number] [--point number] [--symp number]
-	[--vic number] [-z|--size number] [-sympSize number]`,
+	[--vic number] [--strata file] [-z|--size number]
+	[-sympSize number]`,
 	Short: "evaluate four event reconstructions",
 	Long: `
 Ev.eval reads a reconstruction in tsv from the standard input, and for a given
 data and tree, will print the cost of that reconstruction.
 
+If the reconstruction includes the parameters used to build it (as in the
+output of ev.flip), the reconstruction will be read using these parameters,
+unless they are explicitly set with the options.
+
 Options are:
 
     -b
@@ -35,6 +43,11 @@ Options are:
       upweight the cost of the size (i.e. cost = (range-size / sizeParam) *
       len), so having a large size will be costly on longer branches.
 
+    --bbox box
+      If set, only the data inside the indicated bounding box will be used.
+      The box is defined as 'minLon,minLat,maxLon,maxLat'. If minLon is
+      greater than maxLon, the box crosses the antimeridian.
+
     -c number
     --column number
       Set the number of columns in the raster. Default = 360 (i.e. a pixel
@@ -44,6 +57,68 @@ Options are:
     --fill number
       Set the number of pixels to fill around an observed pixel. Default = 2.
 
+    --fillDist number
+      If set, the fill will include all pixels with a center at the
+      indicated distance (in km) or less from a record, instead of a fixed
+      number of pixels. The distance is the great circle distance, so it
+      means the same at any latitude.
+
+    --grid name
+      Set the type of grid used for the raster. Valid values are:
+        equirect   an equirectangular grid in which each pixel has the same
+                   size in degrees.
+        equalarea  a cylindrical equal-area grid in which each pixel has
+                   the same area.
+        hex        a global grid of hexagons on an icosahedron, in which
+                   pixels have about the same area and shape, and the
+                   distance between neighbour pixels is about 360 / columns
+                   degrees. The fill is done by rings of neighbour pixels.
+      Default = equirect.
+
+    --maps file
+      Reads presence maps of the terminals from the ESRI ASCII grid files
+      listed in the indicated manifest file. The manifest is a tab
+      delimited file with the columns 'Name' (the name of the taxon),
+      'File' (the grid file, relative to the manifest), and optionally,
+      'Threshold' (the minimum value of an occupied cell; by default,
+      0.5). The pixels occupied in the maps are used as observed pixels of
+      the taxon, together with the pixels of the records (if any).
+
+    --mask file
+      If set, only the data inside the polygons of the indicated GeoJSON
+      file will be used.
+
+    --maxUncert number
+      If set, the records with a coordinate uncertainty greater than the
+      indicated value (in meters) will be ignored.
+
+    --ranges file
+      Reads range polygons of the terminals from the indicated GeoJSON
+      file. Each Polygon or MultiPolygon feature is assigned to the taxon
+      named by the 'name' property (or 'scientificName', 'binomial',
+      'sci_name' or 'species'). The pixels with a center inside the
+      polygons are used as observed pixels of the taxon, together with the
+      pixels of the records (if any).
+
+    --rangesName name
+      Sets the property of the features of the ranges file used as the
+      name of the taxon. By default, the first property found of 'name',
+      'scientificName', 'binomial', 'sci_name' or 'species' is used.
+
+    --raster file
+      Reads the raster from the indicated file (as created with r.make),
+      instead of rasterizing the records file. If set, the other raster
+      options are ignored.
+
+    --taxa file
+      If set, only the taxa listed in the indicated file (a name per line)
+      will be used.
+
+    --uncertObs
+      If set, the pixels that intersect the uncertainty circle of a record
+      will be used as observed pixels. By default, they are only used as
+      filled pixels.
+
     -i file
     --input file
       Reads from an input file instead of standard input.
@@ -59,6 +134,21 @@ Options are:
       Sets the cost of a given type of event. Event costs should be greather
       than 0. Default = 1.
 
+    --strata file
+      If set, the event costs will be stratified in time, using the time
+      slices of the indicated file. The file is a tab delimited file with
+      the columns 'Start' (the age of the beginning of the slice), 'End'
+      (the age of the end of the slice), and optionally, 'Name', 'Vic',
+      'Symp', 'Point' and 'Found' (the cost of each event in the slice).
+      The costs of the events of a node are the costs of the slice that
+      includes the age of the node (as defined in the 'trees.tab' file,
+      see tr.age). The nodes outside any slice, or an empty cost, use the
+      costs set with --found, --point, --symp and --vic. A node with the
+      age of the start of the oldest slice (e.g. the root of a tree scaled
+      with tr.age --root to that age) is included in that slice. All the
+      trees must be dated (i.e. with an 'Age' column, or scaled to an
+      absolute time with tr.age --root).
+
     -z number
     --size number
       If set, the indicated the value of the ancestral_range_size / number
@@ -72,6 +162,7 @@ Options are:
 
 func init() {
 	setRasterFlags(evEval)
+	evEval.Flag.StringVar(&rasFile, "raster", "", "")
 	setEventFlags(evEval)
 	evEval.Flag.StringVar(&inFile, "input", "", "")
 	evEval.Flag.StringVar(&inFile, "i", "", "")
@@ -80,13 +171,29 @@ func init() {
 }
 
 func evEvalRun(c *cmdapp.Command, args []string) {
-	if (VicCost <= 0) || (SympCost <= 0) || (PointCost <= 0) || (FoundCost <= 0) {
+	f := os.Stdin
+	if len(inFile) > 0 {
+		var err error
+		f, err = os.Open(inFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
+			os.Exit(1)
+		}
+		defer f.Close()
+	}
+	in := bufio.NewReader(f)
+	p, err := events.ReadParams(in)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
+		os.Exit(1)
+	}
+	p = recParams(c, p)
+	if (p.VicC <= 0) || (p.SympC <= 0) || (p.PointC <= 0) || (p.FoundC <= 0) {
 		fmt.Fprintf(os.Stderr, "%s: event costs should be greater than 0\n", c.Name())
 		os.Exit(1)
 	}
 	o := os.Stdout
 	if len(outFile) > 0 {
-		var err error
 		o, err = os.Create(outFile)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
@@ -94,31 +201,25 @@ func evEvalRun(c *cmdapp.Command, args []string) {
 		}
 		defer o.Close()
 	}
-	d, err := loadData()
+	r, err := loadRaster()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
 		os.Exit(1)
 	}
-	r := raster.Rasterize(d, numCols, numFill)
 	ts, err := loadTrees()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
 		os.Exit(1)
 	}
-	f := os.Stdin
-	if len(inFile) > 0 {
-		f, err = os.Open(inFile)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
-			os.Exit(1)
-		}
-		defer f.Close()
-	}
-	recs, err := events.Read(f, r, ts, szExtra, sympSize, brlen)
+	recs, err := events.Read(in, r, ts, p)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
 		os.Exit(1)
 	}
+	if err := setStrata(recs); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
+		os.Exit(1)
+	}
 	w := csv.NewWriter(o)
 	w.Comma = '\t'
 	w.UseCRLF = true
@@ -129,10 +230,6 @@ func evEvalRun(c *cmdapp.Command, args []string) {
 		os.Exit(1)
 	}
 	for _, rc := range recs {
-		rc.SetVicCost(VicCost)
-		rc.SetSympCost(SympCost)
-		rc.SetFoundCost(FoundCost)
-		rc.SetPointCost(PointCost)
 		ev := rc.Evaluate()
 		row := []string{
 			rc.Tree.ID,
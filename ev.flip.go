@@ -11,26 +11,40 @@ import (
 
 	"github.com/js-arias/evs/cmdapp"
 	"github.com/js-arias/evs/events"
-	"github.com/js-arias/evs/raster"
 )
 
 var evFlip = &cmdapp.Command{
 	Run: evFlipRun,
-	UsageLine: `ev.flip [-b|--brlen] [-c|--columns number] [-f|--fill number]
-	[-m|--random number] [--found number] [--point number] [--symp number]
-	[--vic number] [-o|--output file] [-p|--procs number]
-	[-r|--replicates number] [-v|--verbose] [-z|--size number]
-	[-sympSize number]`,
+	UsageLine: `ev.flip [-b|--brlen] [--check] [--bbox box] [-c|--columns number]
+	[-f|--fill number] [--fillDist number] [--grid name] [--maps file]
+	[--mask file] [--maxUncert number] [--ranges file]
+	[--rangesName name] [--raster file] [--taxa file] [--uncertObs]
+	[-m|--random number] [--found number] [--point number]
+	[--symp number] [--vic number] [--strata file] [-o|--output file]
+	[-p|--procs number] [-r|--replicates number] [-v|--verbose]
+	[-z|--size number] [-sympSize number]`,
 	Short: "flip search with four events",
 	Long: `
 Ev.flip searches with the flipping algorithm for the most parsimonious
 biogeographic history using the geographically explicit event model.
 
 The answer will be send to the standard output with the following columns:
-	Tree	Tree identifier
-	Node	Node identifier
-	Event	Event identifier (using a single letter)
-	Set	Identifier of the assigned set
+	Tree		Tree identifier
+	Node		Node identifier
+	Event		Event identifier (using a single letter)
+	Set		Identifier of the assigned set
+	Resolution	Order of the descendants of a polytomy
+
+A node with more than two descendants with data (a polytomy) is evaluated
+as a nested series of binary events: the first two descendants in the
+resolution are the descendants of the first nested node, and each following
+descendant is the sister of the previous nested node. Nested nodes are
+identified by the ID of the polytomy and its position in the series (e.g.
+'5.1'). The resolution is searched together with the events.
+
+The output starts with a block of lines (starting with '#') that stores the
+event costs and raster options used in the search, so ev.eval, ev.map and
+ev.tree will use the same parameters by default.
 
 Options are:
 
@@ -42,6 +56,16 @@ Options are:
       upweight the cost of the size (i.e. cost = (range-size / sizeParam) *
       len), so having a large size will be costly on longer branches.
 
+    --check
+      If set, before the search, the names of the terminals will be
+      checked (as in tx.check), and the search will fail if there are
+      terminals without data.
+
+    --bbox box
+      If set, only the data inside the indicated bounding box will be used.
+      The box is defined as 'minLon,minLat,maxLon,maxLat'. If minLon is
+      greater than maxLon, the box crosses the antimeridian.
+
     -c number
     --column number
       Set the number of columns in the raster. Default = 360 (i.e. a pixel
@@ -51,6 +75,70 @@ Options are:
     --fill number
       Set the number of pixels to fill around an observed pixel. Default = 2.
 
+    --fillDist number
+      If set, the fill will include all pixels with a center at the
+      indicated distance (in km) or less from a record, instead of a fixed
+      number of pixels. The distance is the great circle distance, so it
+      means the same at any latitude.
+
+    --grid name
+      Set the type of grid used for the raster. Valid values are:
+        equirect   an equirectangular grid in which each pixel has the same
+                   size in degrees.
+        equalarea  a cylindrical equal-area grid in which each pixel has
+                   the same area.
+        hex        a global grid of hexagons on an icosahedron, in which
+                   pixels have about the same area and shape, and the
+                   distance between neighbour pixels is about 360 / columns
+                   degrees. The fill is done by rings of neighbour pixels.
+      Default = equirect.
+
+    --maps file
+      Reads presence maps of the terminals from the ESRI ASCII grid files
+      listed in the indicated manifest file. The manifest is a tab
+      delimited file with the columns 'Name' (the name of the taxon),
+      'File' (the grid file, relative to the manifest), and optionally,
+      'Threshold' (the minimum value of an occupied cell; by default,
+      0.5). The pixels occupied in the maps are used as observed pixels of
+      the taxon, together with the pixels of the records (if any).
+
+    --mask file
+      If set, only the data inside the polygons of the indicated GeoJSON
+      file will be used.
+
+    --maxUncert number
+      If set, the records with a coordinate uncertainty greater than the
+      indicated value (in meters) will be ignored.
+
+    --ranges file
+      Reads range polygons of the terminals from the indicated GeoJSON
+      file. Each Polygon or MultiPolygon feature is assigned to the taxon
+      named by the 'name' property (or 'scientificName', 'binomial',
+      'sci_name' or 'species'). The pixels with a center inside the
+      polygons are used as observed pixels of the taxon, together with the
+      pixels of the records (if any).
+
+    --rangesName name
+      Sets the property of the features of the ranges file used as the
+      name of the taxon. By default, the first property found of 'name',
+      'scientificName', 'binomial', 'sci_name' or 'species' is used.
+
+    --raster file
+      Reads the raster from the indicated file (as created with r.make),
+      instead of rasterizing the records file. If set, the other raster
+      options are ignored. The name of the file is stored with the
+      parameters of the reconstruction, so ev.eval, ev.map, ev.time and
+      ev.tree read the same raster file.
+
+    --taxa file
+      If set, only the taxa listed in the indicated file (a name per line)
+      will be used.
+
+    --uncertObs
+      If set, the pixels that intersect the uncertainty circle of a record
+      will be used as observed pixels. By default, they are only used as
+      filled pixels.
+
     -m number
     --random number
       Set the probability (as percentage) of randomly modifying a node in the
@@ -63,6 +151,21 @@ Options are:
       Sets the cost of a given type of event. Event costs should be greater
       than 0. Default = 1.
 
+    --strata file
+      If set, the event costs will be stratified in time, using the time
+      slices of the indicated file. The file is a tab delimited file with
+      the columns 'Start' (the age of the beginning of the slice), 'End'
+      (the age of the end of the slice), and optionally, 'Name', 'Vic',
+      'Symp', 'Point' and 'Found' (the cost of each event in the slice).
+      The costs of the events of a node are the costs of the slice that
+      includes the age of the node (as defined in the 'trees.tab' file,
+      see tr.age). The nodes outside any slice, or an empty cost, use the
+      costs set with --found, --point, --symp and --vic. A node with the
+      age of the start of the oldest slice (e.g. the root of a tree scaled
+      with tr.age --root to that age) is included in that slice. All the
+      trees must be dated (i.e. with an 'Age' column, or scaled to an
+      absolute time with tr.age --root).
+
     -o file
     --output file
       Set the output file, instead of the standard output.
@@ -104,6 +207,8 @@ var (
 	SympCost  float64 // --symp
 	PointCost float64 // --point
 	FoundCost float64 // --found
+	strataFl  string  // --strata
+	chkNames  bool    // --check
 )
 
 func setEventFlags(c *cmdapp.Command) {
@@ -114,12 +219,15 @@ func setEventFlags(c *cmdapp.Command) {
 	c.Flag.Float64Var(&SympCost, "symp", 1, "")
 	c.Flag.Float64Var(&PointCost, "point", 1, "")
 	c.Flag.Float64Var(&FoundCost, "found", 1, "")
+	c.Flag.StringVar(&strataFl, "strata", "", "")
 	c.Flag.BoolVar(&brlen, "brlen", false, "")
 	c.Flag.BoolVar(&brlen, "b", false, "")
 }
 
 func init() {
 	setRasterFlags(evFlip)
+	evFlip.Flag.StringVar(&rasFile, "raster", "", "")
+	evFlip.Flag.BoolVar(&chkNames, "check", false, "")
 	setEventFlags(evFlip)
 	evFlip.Flag.StringVar(&outFile, "output", "", "")
 	evFlip.Flag.StringVar(&outFile, "o", "", "")
@@ -148,17 +256,27 @@ func evFlipRun(c *cmdapp.Command, args []string) {
 		}
 		defer o.Close()
 	}
-	d, err := loadData()
+	st, err := loadStrata()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
+		os.Exit(1)
+	}
+	r, err := loadRaster()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
 		os.Exit(1)
 	}
-	r := raster.Rasterize(d, numCols, numFill)
 	ts, err := loadTrees()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
 		os.Exit(1)
 	}
+	if chkNames {
+		if err := checkTerms(ts, r); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
+			os.Exit(1)
+		}
+	}
 	best := make(chan []*events.Recons)
 	if numReps <= 0 {
 		numReps = 100
@@ -173,6 +291,11 @@ func evFlipRun(c *cmdapp.Command, args []string) {
 		or.SetSympCost(SympCost)
 		or.SetFoundCost(FoundCost)
 		or.SetPointCost(PointCost)
+		if err := or.SetStrata(st); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
+			os.Exit(1)
+		}
+		or.StrataFile = strataFl
 		go doFlip(or, out)
 		go getBestFlip(or, out, best)
 	}
@@ -232,13 +355,14 @@ func doFlip(or *events.Recons, out chan []*events.Recons) {
 					nodes = append(nodes, i)
 				}
 			}
+			polys := r.Polytomies()
 			evs := events.Events()
 			for i := 0; i < numReps; i++ {
 				if i > 0 {
 					r.Copy(or)
 				}
 				r.Randomize(numRand, evs)
-				flipRecons(r, nodes, evs)
+				flipRecons(r, nodes, polys, evs)
 				if r.Cost() < best[0].Cost() {
 					if verbose {
 						fmt.Printf("Replicate %s.%d.%d: %.3f [best so far]\n", r.Tree.ID, px, i, r.Cost())
@@ -276,8 +400,10 @@ func doFlip(or *events.Recons, out chan []*events.Recons) {
 	}
 }
 
-// flipRecons permorms the flip algorithm on list of nodes an events.
-func flipRecons(r *events.Recons, nodes, evs []int) float64 {
+// flipRecons permorms the flip algorithm on list of nodes an events. When
+// no event improves the reconstruction, it tries to improve the resolution
+// of the polytomies.
+func flipRecons(r *events.Recons, nodes, polys, evs []int) float64 {
 	best := r.Cost()
 	for doAgain := true; doAgain; {
 		doAgain = false
@@ -302,8 +428,34 @@ func flipRecons(r *events.Recons, nodes, evs []int) float64 {
 			r.Rec[n].Flag = prev
 			r.DownPass(n)
 		}
+		if !doAgain && swapResolution(r, polys) {
+			best = r.Cost()
+			doAgain = true
+		}
 	}
 	return r.Cost()
 }
 
+// swapResolution tries to improve the reconstruction swapping pairs of
+// descendants in the resolution of the polytomies. It returns true if the
+// cost was improved.
+func swapResolution(r *events.Recons, polys []int) bool {
+	best := r.Cost()
+	for _, p := range polys {
+		ord := r.Resolution(p)
+		for i := 0; i < len(ord)-1; i++ {
+			for j := i + 1; j < len(ord); j++ {
+				ord[i], ord[j] = ord[j], ord[i]
+				r.SetResolution(p, ord)
+				if r.Cost() < best {
+					return true
+				}
+				ord[i], ord[j] = ord[j], ord[i]
+			}
+		}
+		r.SetResolution(p, ord)
+	}
+	return false
+}
+
 //
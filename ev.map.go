@@ -5,6 +5,7 @@
 package main
 
 import (
+	"bufio"
 	"fmt"
 	"image"
 	"image/color"
@@ -23,23 +24,122 @@ import (
 )
 
 var evMap = &cmdapp.Command{
-	Run:       evMapRun,
-	UsageLine: `ev.map [-i|--input file] [-s|--size number] [<imagemap>]`,
-	Short:     "print reconstructions in a map",
+	Run: evMapRun,
+	UsageLine: `ev.map [--bbox box] [-c|--columns number] [-f|--fill number]
+	[--fillDist number] [--grid name] [--maps file] [--mask file]
+	[--maxUncert number] [--ranges file] [--rangesName name]
+	[--raster file] [--taxa file] [--uncertObs] [-i|--input file]
+	[--period name] [--periods file] [-s|--size number] [<imagemap>]`,
+	Short: "print reconstructions in a map",
 	Long: `
 Ev.map reads a reconstruction and export it as png files. Each node is printed
 as a single image, with the name referring to the tree-ID, node-ID and
 reconstruction-ID. An svg file containing the tree with all node IDs is also
-produced to aid the node identification.
+produced to aid the node identification. If the option --period is set,
+only the nodes with an age inside the indicated geological period are
+printed.
 
-The image will be cropped to match the geography of the dataset.
+The image will be cropped to match the geography of the dataset. The
+terminals with range polygons (--ranges) or presence maps (--maps) are
+drawn as the observed pixels of the raster, and the records (if any) are
+drawn on top of them.
+
+If the reconstruction includes the parameters used to build it (as in the
+output of ev.flip), the reconstruction will be read using these parameters,
+unless they are explicitly set with the options.
 
 Options are:
 
+    --bbox box
+      If set, only the data inside the indicated bounding box will be used.
+      The box is defined as 'minLon,minLat,maxLon,maxLat'. If minLon is
+      greater than maxLon, the box crosses the antimeridian.
+
+    -c number
+    --column number
+      Set the number of columns in the raster. Default = 360 (i.e. a pixel
+      grid with 1x1 degrees.
+
+    -f number
+    --fill number
+      Set the number of pixels to fill around an observed pixel. Default = 2.
+
+    --fillDist number
+      If set, the fill will include all pixels with a center at the
+      indicated distance (in km) or less from a record, instead of a fixed
+      number of pixels. The distance is the great circle distance, so it
+      means the same at any latitude.
+
+    --grid name
+      Set the type of grid used for the raster. Valid values are:
+        equirect   an equirectangular grid in which each pixel has the same
+                   size in degrees.
+        equalarea  a cylindrical equal-area grid in which each pixel has
+                   the same area.
+        hex        a global grid of hexagons on an icosahedron, in which
+                   pixels have about the same area and shape, and the
+                   distance between neighbour pixels is about 360 / columns
+                   degrees. The fill is done by rings of neighbour pixels.
+      Default = equirect.
+
+    --maps file
+      Reads presence maps of the terminals from the ESRI ASCII grid files
+      listed in the indicated manifest file. The manifest is a tab
+      delimited file with the columns 'Name' (the name of the taxon),
+      'File' (the grid file, relative to the manifest), and optionally,
+      'Threshold' (the minimum value of an occupied cell; by default,
+      0.5). The pixels occupied in the maps are used as observed pixels of
+      the taxon, together with the pixels of the records (if any).
+
+    --mask file
+      If set, only the data inside the polygons of the indicated GeoJSON
+      file will be used.
+
+    --maxUncert number
+      If set, the records with a coordinate uncertainty greater than the
+      indicated value (in meters) will be ignored.
+
+    --ranges file
+      Reads range polygons of the terminals from the indicated GeoJSON
+      file. Each Polygon or MultiPolygon feature is assigned to the taxon
+      named by the 'name' property (or 'scientificName', 'binomial',
+      'sci_name' or 'species'). The pixels with a center inside the
+      polygons are used as observed pixels of the taxon, together with the
+      pixels of the records (if any).
+
+    --rangesName name
+      Sets the property of the features of the ranges file used as the
+      name of the taxon. By default, the first property found of 'name',
+      'scientificName', 'binomial', 'sci_name' or 'species' is used.
+
+    --raster file
+      Reads the raster from the indicated file (as created with r.make),
+      instead of rasterizing the records file. If set, the other raster
+      options are ignored.
+
+    --taxa file
+      If set, only the taxa listed in the indicated file (a name per line)
+      will be used.
+
+    --uncertObs
+      If set, the pixels that intersect the uncertainty circle of a record
+      will be used as observed pixels. By default, they are only used as
+      filled pixels.
+
     -i file
     --input file
       Reads from an input file instead of standard input.
-      
+
+    --period name
+      If set, only the nodes with an age inside the indicated period will
+      be printed. The trees must be dated (i.e. with an 'Age' column in
+      the 'trees.tab' file, or scaled with tr.age --root).
+
+    --periods file
+      Reads the geological time scale used with --period from the
+      indicated file (with the columns 'Name', 'Start' and 'End'). By
+      default, the periods of the Phanerozoic, in million years, are used.
+
     -s number
     --size number
       Sets the size of each record in the ouput map. Default = 2
@@ -53,43 +153,80 @@ Options are:
 var recSize int
 
 func init() {
+	setRasterFlags(evMap)
+	evMap.Flag.StringVar(&rasFile, "raster", "", "")
 	evMap.Flag.StringVar(&inFile, "input", "", "")
 	evMap.Flag.StringVar(&inFile, "i", "", "")
+	evMap.Flag.StringVar(&periodName, "period", "", "")
+	evMap.Flag.StringVar(&periodsFile, "periods", "", "")
 	evMap.Flag.IntVar(&recSize, "size", 2, "")
 	evMap.Flag.IntVar(&recSize, "s", 2, "")
 }
 
 func evMapRun(c *cmdapp.Command, args []string) {
-	d, err := loadData()
+	var err error
+	f := os.Stdin
+	if len(inFile) > 0 {
+		f, err = os.Open(inFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
+			os.Exit(1)
+		}
+		defer f.Close()
+	}
+	in := bufio.NewReader(f)
+	p, err := events.ReadParams(in)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
+		os.Exit(1)
+	}
+	p = recParams(c, p)
+	syn, err := loadSynonyms()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
+		os.Exit(1)
+	}
+	d, err := rasterData()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
+		os.Exit(1)
+	}
+	r, err := loadRaster()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
 		os.Exit(1)
 	}
-	r := raster.Rasterize(d, numCols, numFill)
 	ts, err := loadTrees()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
 		os.Exit(1)
 	}
-	f := os.Stdin
-	if len(inFile) > 0 {
-		f, err = os.Open(inFile)
-		if err != nil {
+	recs, err := events.Read(in, r, ts, p)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
+		os.Exit(1)
+	}
+	if recSize < 1 {
+		recSize = 2
+	}
+	if len(periodName) > 0 {
+		if err := checkDated(recs); err != nil {
 			fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
 			os.Exit(1)
 		}
-		defer f.Close()
 	}
-	recs, err := events.Read(f, r, ts, szExtra, sympSize, true)
+	ps, err := loadPeriods()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
 		os.Exit(1)
 	}
-	if recSize < 1 {
-		recSize = 2
+	inPeriod, err := periodFilter(ps)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
+		os.Exit(1)
 	}
 
-	err = treesvg.SVG(ts, nil, 0, 0, false)
+	err = treesvg.SVG(ts, nil, 0, 0, false, nil)
 
 	// determines the boudaries of the geography
 	minLat := float64(biogeo.MaxLat)
@@ -111,6 +248,20 @@ func evMapRun(c *cmdapp.Command, args []string) {
 				maxLon = g.Lon
 			}
 		}
+		for _, cl := range obsCells(r, tx) {
+			if cl.MinLat < minLat {
+				minLat = cl.MinLat
+			}
+			if cl.MaxLat > maxLat {
+				maxLat = cl.MaxLat
+			}
+			if cl.MinLon < minLon {
+				minLon = cl.MinLon
+			}
+			if cl.MaxLon > maxLon {
+				maxLon = cl.MaxLon
+			}
+		}
 	}
 	maxLat += 10
 	if maxLat > biogeo.MaxLat {
@@ -164,6 +315,9 @@ func evMapRun(c *cmdapp.Command, args []string) {
 				if rc.Rec[i].Node.First == nil {
 					continue
 				}
+				if !inPeriod(rc.Rec[i].Node.Age) {
+					continue
+				}
 				ln++
 			}
 		}
@@ -190,18 +344,11 @@ func evMapRun(c *cmdapp.Command, args []string) {
 				if rc.Rec[i].Node.First == nil {
 					continue
 				}
-				dest := <-imgPump
-				e := "noev"
-				switch rc.Rec[i].Flag {
-				case events.Vic:
-					e = "vic"
-				case events.SympU, events.SympL, events.SympR:
-					e = "symp"
-				case events.PointL, events.PointR:
-					e = "point"
-				case events.FoundL, events.FoundR:
-					e = "found"
+				if !inPeriod(rc.Rec[i].Node.Age) {
+					continue
 				}
+				dest := <-imgPump
+				e := events.EventName(rc.Rec[i].Flag)
 				for j := range rc.Rec {
 					if rc.Rec[j].Node.First != nil {
 						continue
@@ -209,7 +356,7 @@ func evMapRun(c *cmdapp.Command, args []string) {
 					if len(rc.Rec[j].Node.Term) == 0 {
 						continue
 					}
-					tx := d.Taxon(rc.Rec[j].Node.Term)
+					tx := d.Taxon(syn.Accepted(rc.Rec[j].Node.Term))
 					if tx == nil {
 						continue
 					}
@@ -217,6 +364,17 @@ func evMapRun(c *cmdapp.Command, args []string) {
 					if !ok {
 						continue
 					}
+					for _, cl := range obsCells(r, tx) {
+						x0 := int((180+cl.MinLon)*scaleX) - originX
+						x1 := int((180+cl.MaxLon)*scaleX) - originX
+						y0 := int((90-cl.MaxLat)*scaleY) - originY
+						y1 := int((90-cl.MinLat)*scaleY) - originY
+						for x := x0; x <= x1; x++ {
+							for y := y0; y <= y1; y++ {
+								dest.Set(x, y, cr)
+							}
+						}
+					}
 					for _, g := range tx.Recs {
 						c := int((180+g.Lon)*scaleX) - originX
 						r := int((90-g.Lat)*scaleY) - originY
@@ -253,38 +411,52 @@ func evMapRun(c *cmdapp.Command, args []string) {
 	}
 }
 
+// obsCells returns the observed pixels of a taxon with range polygons or
+// presence maps. Taxa with only records are drawn by its records, so it
+// returns nil for them.
+func obsCells(r *raster.Raster, tx *biogeo.Taxon) []raster.Cell {
+	if (len(tx.Polys) == 0) && (len(tx.Maps) == 0) {
+		return nil
+	}
+	rt := r.Taxon(tx.Name)
+	if rt == nil {
+		return nil
+	}
+	return r.Cells(rt.Obs)
+}
+
 func eventColor(rc *events.Recons, i, j int) (color.RGBA64, bool) {
-	n := rc.Rec[j].Node
-	for anc := n.Anc; anc != nil; anc = anc.Anc {
-		j = anc.Index
+	n := j
+	for anc := rc.Anc(n); anc >= 0; anc = rc.Anc(anc) {
+		j = anc
 		switch rc.Rec[j].Flag {
 		case events.Vic:
 			if j == i {
-				if rc.Rec[i].SetL == n.Index {
+				if rc.Rec[i].SetL == n {
 					return color.RGBA64{0xFFFF, 0, 0, 0xFFFF}, true
-				} else if rc.Rec[i].SetR == n.Index {
+				} else if rc.Rec[i].SetR == n {
 					return color.RGBA64{0, 0, 0xFFFF, 0xFFFF}, true
 				} else {
 					return color.RGBA64{}, false
 				}
 			}
 		case events.SympL:
-			if rc.Rec[j].SetL != n.Index {
+			if rc.Rec[j].SetL != n {
 				return color.RGBA64{}, false
 			}
 		case events.PointR, events.FoundR:
-			if rc.Rec[j].SetL != n.Index {
+			if rc.Rec[j].SetL != n {
 				if j == i {
 					return color.RGBA64{0xFFFF, 0xFFFF, 0xFFFF, 0xFFFF}, true
 				}
 				return color.RGBA64{}, false
 			}
 		case events.SympR:
-			if rc.Rec[j].SetR != n.Index {
+			if rc.Rec[j].SetR != n {
 				return color.RGBA64{}, false
 			}
 		case events.PointL, events.FoundL:
-			if rc.Rec[j].SetR != n.Index {
+			if rc.Rec[j].SetR != n {
 				if j == i {
 					return color.RGBA64{0xFFFF, 0xFFFF, 0xFFFF, 0xFFFF}, true
 				}
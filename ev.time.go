@@ -0,0 +1,292 @@
+// Copyright (c) 2015, J. Salvador Arias <jsalarias@csnat.unt.edu.ar>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/js-arias/evs/cmdapp"
+	"github.com/js-arias/evs/events"
+	"github.com/js-arias/evs/tree"
+)
+
+var evTime = &cmdapp.Command{
+	Run: evTimeRun,
+	UsageLine: `ev.time [--bbox box] [-c|--columns number] [-f|--fill number]
+	[--fillDist number] [--grid name] [--maps file] [--mask file]
+	[--maxUncert number] [--ranges file] [--rangesName name]
+	[--raster file] [--taxa file] [--uncertObs] [-i|--input file]
+	[--period name] [--periods file]`,
+	Short: "prints the ages of the events",
+	Long: `
+Ev.time reads a reconstruction and prints the age of the event of each
+internal node, and the geological period that includes that age.
+
+The ages of the nodes are taken from the 'trees.tab' file. If the file
+includes an 'Age' column, the ages are the ages of the file, otherwise,
+they are calculated from the branch lengths (the age of the node is the
+distance to the most distant terminal). Periods are only assigned to the
+nodes of dated trees (i.e. with an 'Age' column, or scaled to an absolute
+time with tr.age --root).
+
+The output is a tab table with the following columns:
+	Tree	Tree identifier
+	ID	Reconstruction identifier
+	Node	Node identifier
+	Event	The event of the node ('vic', 'symp', 'point', 'found' or
+		'noev')
+	Age	The age of the node
+	Period	The period that includes the age of the node
+
+If the reconstruction includes the parameters used to build it (as in the
+output of ev.flip), the reconstruction will be read using these parameters,
+unless they are explicitly set with the options.
+
+Options are:
+
+    --bbox box
+      If set, only the data inside the indicated bounding box will be used.
+      The box is defined as 'minLon,minLat,maxLon,maxLat'. If minLon is
+      greater than maxLon, the box crosses the antimeridian.
+
+    -c number
+    --column number
+      Set the number of columns in the raster. Default = 360 (i.e. a pixel
+      grid with 1x1 degrees.
+
+    -f number
+    --fill number
+      Set the number of pixels to fill around an observed pixel. Default = 2.
+
+    --fillDist number
+      If set, the fill will include all pixels with a center at the
+      indicated distance (in km) or less from a record, instead of a fixed
+      number of pixels. The distance is the great circle distance, so it
+      means the same at any latitude.
+
+    --grid name
+      Set the type of grid used for the raster. Valid values are:
+        equirect   an equirectangular grid in which each pixel has the same
+                   size in degrees.
+        equalarea  a cylindrical equal-area grid in which each pixel has
+                   the same area.
+        hex        a global grid of hexagons on an icosahedron, in which
+                   pixels have about the same area and shape, and the
+                   distance between neighbour pixels is about 360 / columns
+                   degrees. The fill is done by rings of neighbour pixels.
+      Default = equirect.
+
+    --maps file
+      Reads presence maps of the terminals from the ESRI ASCII grid files
+      listed in the indicated manifest file. The manifest is a tab
+      delimited file with the columns 'Name' (the name of the taxon),
+      'File' (the grid file, relative to the manifest), and optionally,
+      'Threshold' (the minimum value of an occupied cell; by default,
+      0.5). The pixels occupied in the maps are used as observed pixels of
+      the taxon, together with the pixels of the records (if any).
+
+    --mask file
+      If set, only the data inside the polygons of the indicated GeoJSON
+      file will be used.
+
+    --maxUncert number
+      If set, the records with a coordinate uncertainty greater than the
+      indicated value (in meters) will be ignored.
+
+    --ranges file
+      Reads range polygons of the terminals from the indicated GeoJSON
+      file. Each Polygon or MultiPolygon feature is assigned to the taxon
+      named by the 'name' property (or 'scientificName', 'binomial',
+      'sci_name' or 'species'). The pixels with a center inside the
+      polygons are used as observed pixels of the taxon, together with the
+      pixels of the records (if any).
+
+    --rangesName name
+      Sets the property of the features of the ranges file used as the
+      name of the taxon. By default, the first property found of 'name',
+      'scientificName', 'binomial', 'sci_name' or 'species' is used.
+
+    --raster file
+      Reads the raster from the indicated file (as created with r.make),
+      instead of rasterizing the records file. If set, the other raster
+      options are ignored.
+
+    --taxa file
+      If set, only the taxa listed in the indicated file (a name per line)
+      will be used.
+
+    --uncertObs
+      If set, the pixels that intersect the uncertainty circle of a record
+      will be used as observed pixels. By default, they are only used as
+      filled pixels.
+
+    -i file
+    --input file
+      Reads from an input file instead of standard input.
+
+    --period name
+      If set, only the nodes with an age inside the indicated period will
+      be printed. All the trees must be dated.
+
+    --periods file
+      Reads the geological time scale from the indicated file. The file is
+      a tab delimited file with the columns 'Name' (the name of the
+      period), 'Start' (the age of the beginning of the period), 'End' (the
+      age of the end of the period), and optionally, 'Color' (the color
+      used to draw the period). By default, the periods of the
+      Phanerozoic, in million years, are used.
+	`,
+}
+
+var (
+	periodName  string // --period
+	periodsFile string // --periods
+)
+
+func init() {
+	setRasterFlags(evTime)
+	evTime.Flag.StringVar(&rasFile, "raster", "", "")
+	evTime.Flag.StringVar(&inFile, "input", "", "")
+	evTime.Flag.StringVar(&inFile, "i", "", "")
+	evTime.Flag.StringVar(&periodName, "period", "", "")
+	evTime.Flag.StringVar(&periodsFile, "periods", "", "")
+}
+
+func evTimeRun(c *cmdapp.Command, args []string) {
+	ps, err := loadPeriods()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
+		os.Exit(1)
+	}
+	inPeriod, err := periodFilter(ps)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
+		os.Exit(1)
+	}
+	f := os.Stdin
+	if len(inFile) > 0 {
+		f, err = os.Open(inFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
+			os.Exit(1)
+		}
+		defer f.Close()
+	}
+	in := bufio.NewReader(f)
+	p, err := events.ReadParams(in)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
+		os.Exit(1)
+	}
+	p = recParams(c, p)
+	r, err := loadRaster()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
+		os.Exit(1)
+	}
+	ts, err := loadTrees()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
+		os.Exit(1)
+	}
+	recs, err := events.Read(in, r, ts, p)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
+		os.Exit(1)
+	}
+	if len(periodName) > 0 {
+		if err := checkDated(recs); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
+			os.Exit(1)
+		}
+	}
+
+	w := csv.NewWriter(os.Stdout)
+	w.Comma = '\t'
+	w.UseCRLF = true
+	defer w.Flush()
+	if err := w.Write([]string{"Tree", "ID", "Node", "Event", "Age", "Period"}); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
+		os.Exit(1)
+	}
+	for _, rc := range recs {
+		for i := range rc.Rec {
+			n := rc.Rec[i].Node
+			if n.First == nil {
+				continue
+			}
+			if !inPeriod(n.Age) {
+				continue
+			}
+			pn := ""
+			if rc.Tree.Dated {
+				if per := tree.PeriodOf(ps, n.Age); per != nil {
+					pn = per.Name
+				}
+			}
+			row := []string{
+				rc.Tree.ID,
+				rc.ID,
+				n.ID,
+				events.EventName(rc.Rec[i].Flag),
+				strconv.FormatFloat(n.Age, 'f', 6, 64),
+				pn,
+			}
+			if err := w.Write(row); err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
+				os.Exit(1)
+			}
+		}
+	}
+}
+
+// loadPeriods returns the time scale of the periods file, or the default
+// time scale if no file is given.
+func loadPeriods() ([]tree.Period, error) {
+	if len(periodsFile) == 0 {
+		return tree.Periods, nil
+	}
+	f, err := os.Open(periodsFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return tree.ReadPeriods(f)
+}
+
+// checkDated returns an error if the tree of a reconstruction is not
+// dated, as the ages of its nodes are not absolute ages.
+func checkDated(recs []*events.Recons) error {
+	for _, rc := range recs {
+		if !rc.Tree.Dated {
+			return fmt.Errorf("tree %s: not dated (use tr.age --root to set the age of the root)", rc.Tree.ID)
+		}
+	}
+	return nil
+}
+
+// periodFilter returns a function that returns true if an age is inside
+// the period set with the --period flag. If the flag is not set, all ages
+// are accepted.
+func periodFilter(ps []tree.Period) (func(age float64) bool, error) {
+	if len(periodName) == 0 {
+		return func(float64) bool { return true }, nil
+	}
+	for i := range ps {
+		if !strings.EqualFold(ps[i].Name, strings.TrimSpace(periodName)) {
+			continue
+		}
+		p := ps[i]
+		return func(age float64) bool {
+			return (age >= p.End) && (age < p.Start)
+		}, nil
+	}
+	return nil, fmt.Errorf("period %s not found", periodName)
+}
@@ -5,32 +5,154 @@
 package main
 
 import (
+	"bufio"
 	"fmt"
 	"os"
 
 	"github.com/js-arias/evs/cmdapp"
 	"github.com/js-arias/evs/events"
-	"github.com/js-arias/evs/raster"
+	"github.com/js-arias/evs/tree"
 	"github.com/js-arias/evs/treesvg"
 )
 
 var evTree = &cmdapp.Command{
-	Run:       evTreeRun,
-	UsageLine: `ev.tree [-i|--input file] [--stepX number] [--stepY number]`,
-	Short:     "exports a tree reconstruction",
+	Run: evTreeRun,
+	UsageLine: `ev.tree [--bbox box] [-c|--columns number] [-f|--fill number]
+	[--fillDist number] [--grid name] [--maps file] [--mask file]
+	[--maxUncert number] [--ranges file] [--rangesName name]
+	[--raster file] [--taxa file] [--uncertObs] [-i|--input file]
+	[--color] [--nexus] [-o|--output file] [--periods file]
+	[--stepX number] [--stepY number]`,
+	Short: "exports a tree reconstruction",
 	Long: `
 Ev.tree exports a tree reconstruction into a svg file. In that file, black
 filled squares represent nodes with vicariance, white squares full sympatry,
 white circles punctual sympatry (the branch with the circle is the punctual
 descendant), and white triangle founder event (the branch with the triangle is
-the founder descendant).
+the founder descendant). If the option --color is set, the vertical line of
+each internal node is drawn with the color of the geological period that
+includes the age of the node.
+
+If the option --nexus is set, the reconstructions are written as the TREES
+block of a NEXUS file, instead of svg files. Each node is annotated with
+the event ('event', with the same codes used in the reconstruction file),
+the descendant that defines the ancestral range ('set'), the order of the
+descendants of a polytomy ('resolution'), the number of observed pixels of
+the range ('range_cells'), the cost of the node without the cost of its
+descendants ('cost'), and if the tree is dated (i.e. the 'trees.tab' file
+has an 'Age' column), the age of the node ('age'). A polytomy is evaluated
+as a nested series of binary events: the nested events are annotated as a
+list of node IDs and events ('nested', e.g. '5.1:v'), with the cost of each
+nested event ('nested_cost'), and the event and the cost of the polytomy
+are the ones of the last event of the series. These annotations can be
+displayed with FigTree and other tree viewers. In the svg file, only the
+last event of a polytomy is drawn.
+
+If the reconstruction includes the parameters used to build it (as in the
+output of ev.flip), the reconstruction will be read using these parameters,
+unless they are explicitly set with the options.
 
 Options are:
 
+    --bbox box
+      If set, only the data inside the indicated bounding box will be used.
+      The box is defined as 'minLon,minLat,maxLon,maxLat'. If minLon is
+      greater than maxLon, the box crosses the antimeridian.
+
+    -c number
+    --column number
+      Set the number of columns in the raster. Default = 360 (i.e. a pixel
+      grid with 1x1 degrees.
+
+    -f number
+    --fill number
+      Set the number of pixels to fill around an observed pixel. Default = 2.
+
+    --fillDist number
+      If set, the fill will include all pixels with a center at the
+      indicated distance (in km) or less from a record, instead of a fixed
+      number of pixels. The distance is the great circle distance, so it
+      means the same at any latitude.
+
+    --grid name
+      Set the type of grid used for the raster. Valid values are:
+        equirect   an equirectangular grid in which each pixel has the same
+                   size in degrees.
+        equalarea  a cylindrical equal-area grid in which each pixel has
+                   the same area.
+        hex        a global grid of hexagons on an icosahedron, in which
+                   pixels have about the same area and shape, and the
+                   distance between neighbour pixels is about 360 / columns
+                   degrees. The fill is done by rings of neighbour pixels.
+      Default = equirect.
+
+    --maps file
+      Reads presence maps of the terminals from the ESRI ASCII grid files
+      listed in the indicated manifest file. The manifest is a tab
+      delimited file with the columns 'Name' (the name of the taxon),
+      'File' (the grid file, relative to the manifest), and optionally,
+      'Threshold' (the minimum value of an occupied cell; by default,
+      0.5). The pixels occupied in the maps are used as observed pixels of
+      the taxon, together with the pixels of the records (if any).
+
+    --mask file
+      If set, only the data inside the polygons of the indicated GeoJSON
+      file will be used.
+
+    --maxUncert number
+      If set, the records with a coordinate uncertainty greater than the
+      indicated value (in meters) will be ignored.
+
+    --ranges file
+      Reads range polygons of the terminals from the indicated GeoJSON
+      file. Each Polygon or MultiPolygon feature is assigned to the taxon
+      named by the 'name' property (or 'scientificName', 'binomial',
+      'sci_name' or 'species'). The pixels with a center inside the
+      polygons are used as observed pixels of the taxon, together with the
+      pixels of the records (if any).
+
+    --rangesName name
+      Sets the property of the features of the ranges file used as the
+      name of the taxon. By default, the first property found of 'name',
+      'scientificName', 'binomial', 'sci_name' or 'species' is used.
+
+    --raster file
+      Reads the raster from the indicated file (as created with r.make),
+      instead of rasterizing the records file. If set, the other raster
+      options are ignored.
+
+    --taxa file
+      If set, only the taxa listed in the indicated file (a name per line)
+      will be used.
+
+    --uncertObs
+      If set, the pixels that intersect the uncertainty circle of a record
+      will be used as observed pixels. By default, they are only used as
+      filled pixels.
+
     -i file
     --input file
       Reads from an input file instead of standard input.
 
+    --color
+      If set, the nodes will be colored by the geological period that
+      includes the age of the node. The trees must be dated (i.e. with an
+      'Age' column in the 'trees.tab' file, or scaled with tr.age --root).
+
+    --nexus
+      If set, the reconstructions will be written in NEXUS format.
+
+    -o file
+    --output file
+      If defined, the NEXUS output will be written in the indicated file,
+      instead of the standard output.
+
+    --periods file
+      Reads the geological time scale used with --color from the indicated
+      file. The file is a tab delimited file with the columns 'Name',
+      'Start', 'End' and 'Color'. By default, the periods of the
+      Phanerozoic, in million years, are used.
+
     --stepX number
     --stepY number
       Sets the separation between branches of the tree.
@@ -38,44 +160,91 @@ Options are:
 }
 
 var (
-	stepX int
-	stepY int
+	stepX     int
+	stepY     int
+	colorTree bool // --color
 )
 
 func init() {
+	setRasterFlags(evTree)
+	evTree.Flag.StringVar(&rasFile, "raster", "", "")
 	evTree.Flag.StringVar(&inFile, "input", "", "")
 	evTree.Flag.StringVar(&inFile, "i", "", "")
+	evTree.Flag.BoolVar(&colorTree, "color", false, "")
+	evTree.Flag.BoolVar(&nexusOut, "nexus", false, "")
+	evTree.Flag.StringVar(&outFile, "output", "", "")
+	evTree.Flag.StringVar(&outFile, "o", "", "")
+	evTree.Flag.StringVar(&periodsFile, "periods", "", "")
 	evTree.Flag.IntVar(&stepX, "stepX", 0, "")
 	evTree.Flag.IntVar(&stepY, "stepY", 0, "")
 }
 
 func evTreeRun(c *cmdapp.Command, args []string) {
-	d, err := loadData()
+	f := os.Stdin
+	if len(inFile) > 0 {
+		var err error
+		f, err = os.Open(inFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
+			os.Exit(1)
+		}
+		defer f.Close()
+	}
+	in := bufio.NewReader(f)
+	p, err := events.ReadParams(in)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
+		os.Exit(1)
+	}
+	p = recParams(c, p)
+	r, err := loadRaster()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
 		os.Exit(1)
 	}
-	r := raster.Rasterize(d, numCols, numFill)
 	ts, err := loadTrees()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
 		os.Exit(1)
 	}
-	f := os.Stdin
-	if len(inFile) > 0 {
-		f, err = os.Open(inFile)
-		if err != nil {
+	recs, err := events.Read(in, r, ts, p)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
+		os.Exit(1)
+	}
+	if err := setStrata(recs); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
+		os.Exit(1)
+	}
+	if nexusOut {
+		o := os.Stdout
+		if len(outFile) > 0 {
+			o, err = os.Create(outFile)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
+				os.Exit(1)
+			}
+			defer o.Close()
+		}
+		if err := events.WriteNexus(o, recs); err != nil {
 			fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
 			os.Exit(1)
 		}
-		defer f.Close()
+		return
 	}
-	recs, err := events.Read(f, r, ts, szExtra, sympSize, true)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
-		os.Exit(1)
+	var ps []tree.Period
+	if colorTree {
+		if err := checkDated(recs); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
+			os.Exit(1)
+		}
+		ps, err = loadPeriods()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
+			os.Exit(1)
+		}
 	}
-	err = treesvg.SVG(ts, recs, stepX, stepY, true)
+	err = treesvg.SVG(ts, recs, stepX, stepY, true, ps)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
 		os.Exit(1)
@@ -5,11 +5,13 @@
 package events
 
 import (
+	"bufio"
 	"encoding/csv"
 	"errors"
 	"fmt"
 	"io"
 	"math/rand"
+	"strconv"
 	"strings"
 
 	"github.com/js-arias/evs/bitfield"
@@ -48,12 +50,15 @@ const infinityCost = 10000000
 // A Node is a reconstruction of a node.
 type Node struct {
 	Node *tree.Node
-	Fill bitfield.Bitfield
-	Obs  bitfield.Bitfield
+	Fill bitfield.Set
+	Obs  bitfield.Set
 	SetL int
 	SetR int
 	Cost float64
 	Flag int
+
+	// Nest are the nested nodes used to resolve a polytomy
+	Nest []int
 }
 
 // A Recons is a reconstruction of a given raster in a particular tree.
@@ -72,11 +77,23 @@ type Recons struct {
 	SympC    float64
 	PointC   float64
 	FoundC   float64
+
+	// Strata are the time slices of a stratified cost model, and
+	// StrataFile the file from which they were read
+	Strata     []Stratum
+	StrataFile string
 }
 
 // OR creates an OR reconstruction based on raster and tree data. If scaled is
 // true, then the cost at each node will be scaled by the ancestral
 // distribution.
+//
+// A node with more than two descendants with data (a polytomy) is evaluated
+// as a nested series of binary events. Each nested node is added to the
+// reconstruction after the nodes of the tree, and it is identified by the
+// ID of the polytomy and the position in the series (e.g. '5.1'). The
+// order of the descendants in the series (the resolution) is part of the
+// reconstruction, and can be changed with SetResolution.
 func OR(r *raster.Raster, t *tree.Tree, size, sympSize float64, useLen bool) *Recons {
 	or := &Recons{
 		ID:       "or",
@@ -94,8 +111,8 @@ func OR(r *raster.Raster, t *tree.Tree, size, sympSize float64, useLen bool) *Re
 	for i := len(t.Nodes) - 1; i >= 0; i-- {
 		n := t.Nodes[i]
 		or.Rec[i].Node = n
-		or.Rec[i].Obs = make(bitfield.Bitfield, r.Fields)
-		or.Rec[i].Fill = make(bitfield.Bitfield, r.Fields)
+		or.Rec[i].Obs = r.NewSet()
+		or.Rec[i].Fill = r.NewSet()
 		or.Rec[i].SetL = -1
 		or.Rec[i].SetR = -1
 		if len(n.Term) > 0 {
@@ -103,8 +120,8 @@ func OR(r *raster.Raster, t *tree.Tree, size, sympSize float64, useLen bool) *Re
 			if tx == nil {
 				continue
 			}
-			copy(or.Rec[i].Obs, tx.Obs)
-			copy(or.Rec[i].Fill, tx.Fill)
+			or.Rec[i].Obs.Copy(tx.Obs)
+			or.Rec[i].Fill.Copy(tx.Fill)
 			if or.Size > 0 {
 				cost := float64(or.Rec[i].Obs.Count()-1) / or.Size
 				if or.UseLen {
@@ -114,8 +131,7 @@ func OR(r *raster.Raster, t *tree.Tree, size, sympSize float64, useLen bool) *Re
 			}
 			continue
 		}
-		var setL, setR *tree.Node
-		numDesc := 0
+		var ds []*tree.Node
 		for desc := n.First; desc != nil; desc = desc.Sister {
 			or.Rec[i].Obs.Union(or.Rec[desc.Index].Obs)
 			or.Rec[i].Fill.Union(or.Rec[desc.Index].Fill)
@@ -123,44 +139,163 @@ func OR(r *raster.Raster, t *tree.Tree, size, sympSize float64, useLen bool) *Re
 			if or.Rec[desc.Index].Obs.Count() == 0 {
 				continue
 			}
-			if setL == nil {
-				setL = desc
-			} else if setR == nil {
-				setR = desc
-			}
-			numDesc++
+			ds = append(ds, desc)
 		}
-		if numDesc != 2 {
+		if len(ds) < 2 {
 			continue
 		}
-		or.Rec[i].SetL = setL.Index
-		or.Rec[i].SetR = setR.Index
-		cv := or.vicariance(i)
-		cs := or.sympatry(i)
-		if or.Size > 0 {
-			csz := (float64(or.Rec[i].Obs.Count()-1) / or.Size)
-			if or.UseLen {
-				csz *= n.Len
+
+		// nested nodes of a polytomy
+		setL := ds[0].Index
+		if len(ds) > 2 {
+			ln := ds[0].Len
+			for _, d := range ds {
+				if d.Len < ln {
+					ln = d.Len
+				}
+			}
+			for j, d := range ds[1 : len(ds)-1] {
+				v := len(or.Rec)
+				// nested nodes are not part of the tree, its
+				// first descendant is set, so they are taken
+				// as internal nodes.
+				vn := &tree.Node{
+					Index: v,
+					ID:    n.ID + "." + strconv.Itoa(j+1),
+					Anc:   n,
+					First: n.First,
+					Len:   ln,
+					Age:   n.Age,
+				}
+				or.Rec = append(or.Rec, Node{
+					Node: vn,
+					Obs:  r.NewSet(),
+					Fill: r.NewSet(),
+					SetL: setL,
+					SetR: d.Index,
+				})
+				or.Rec[i].Nest = append(or.Rec[i].Nest, v)
+				or.initNode(v)
+				setL = v
 			}
-			cs += csz
-			cv += csz
-		}
-		if cv < cs {
-			or.Rec[i].Flag = Vic
-			or.Rec[i].Cost += cv
-		} else {
-			or.Rec[i].Flag = SympU
-			or.Rec[i].Cost += cs
 		}
+		or.Rec[i].SetL = setL
+		or.Rec[i].SetR = ds[len(ds)-1].Index
+		or.initNode(i)
 	}
 	return or
 }
 
+// initNode sets the initial reconstruction of a node with two descendants
+// with data, using the event (vicariance or full sympatry) with the lowest
+// cost.
+func (r *Recons) initNode(n int) {
+	setL, setR := r.Rec[n].SetL, r.Rec[n].SetR
+	r.Rec[n].Obs.Copy(r.Rec[setL].Obs)
+	r.Rec[n].Obs.Union(r.Rec[setR].Obs)
+	r.Rec[n].Fill.Copy(r.Rec[setL].Fill)
+	r.Rec[n].Fill.Union(r.Rec[setR].Fill)
+	r.Rec[n].Cost = r.Rec[setL].Cost + r.Rec[setR].Cost
+	cv := r.vicariance(n)
+	cs := r.sympatry(n)
+	if r.Size > 0 {
+		csz := (float64(r.Rec[n].Obs.Count()-1) / r.Size)
+		if r.UseLen {
+			csz *= r.Rec[n].Node.Len
+		}
+		cs += csz
+		cv += csz
+	}
+	if cv < cs {
+		r.Rec[n].Flag = Vic
+		r.Rec[n].Cost += cv
+	} else {
+		r.Rec[n].Flag = SympU
+		r.Rec[n].Cost += cs
+	}
+}
+
+// Anc returns the index of the ancestor of node n, taking into account
+// the nested nodes of the polytomies, or -1 if n is the root.
+func (r *Recons) Anc(n int) int {
+	v := r.Rec[n].Node
+	if v.Anc == nil {
+		return -1
+	}
+	a := v.Anc.Index
+	nest := r.Rec[a].Nest
+	if n >= len(r.Tree.Nodes) {
+		// a nested node
+		for j, x := range nest[:len(nest)-1] {
+			if x == n {
+				return nest[j+1]
+			}
+		}
+		return a
+	}
+	for _, x := range nest {
+		if (r.Rec[x].SetL == n) || (r.Rec[x].SetR == n) {
+			return x
+		}
+	}
+	return a
+}
+
+// Polytomies returns the nodes that are resolved as a nested series of
+// binary events.
+func (r *Recons) Polytomies() []int {
+	var ps []int
+	for i := range r.Rec {
+		if len(r.Rec[i].Nest) > 0 {
+			ps = append(ps, i)
+		}
+	}
+	return ps
+}
+
+// Resolution returns the descendants of a polytomy in the order of its
+// nested events: the first two descendants are the descendants of the
+// first nested node, and each following descendant is the sister of the
+// previous nested node. It returns nil if n is not a polytomy.
+func (r *Recons) Resolution(n int) []int {
+	nest := r.Rec[n].Nest
+	if len(nest) == 0 {
+		return nil
+	}
+	ord := []int{r.Rec[nest[0]].SetL}
+	for _, v := range nest {
+		ord = append(ord, r.Rec[v].SetR)
+	}
+	return append(ord, r.Rec[n].SetR)
+}
+
+// SetResolution sets the order of the descendants of a polytomy, and
+// updates the reconstruction. The order must be a permutation of the
+// order returned by Resolution.
+func (r *Recons) SetResolution(n int, ord []int) {
+	nest := r.Rec[n].Nest
+	r.Rec[nest[0]].SetL = ord[0]
+	for j, v := range nest {
+		r.Rec[v].SetR = ord[j+1]
+	}
+	r.Rec[n].SetR = ord[len(ord)-1]
+	r.DownPass(nest[0])
+}
+
 // Read reads a reconstruction from one or most trees in tsv format from an
-// input stream.
-func Read(in io.Reader, ras *raster.Raster, ts []*tree.Tree, size, sympSize float64, useLen bool) ([]*Recons, error) {
+// input stream. The reconstructions will use the parameters p. If p is nil,
+// it will use the parameters stored in the input stream.
+func Read(in io.Reader, ras *raster.Raster, ts []*tree.Tree, p *Params) ([]*Recons, error) {
 	var recs []*Recons
-	r := csv.NewReader(in)
+	br := bufio.NewReader(in)
+	stored, err := ReadParams(br)
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		p = stored
+	}
+	r := csv.NewReader(br)
 	r.Comma = '\t'
 	r.TrimLeadingSpace = true
 
@@ -174,6 +309,7 @@ func Read(in io.Reader, ras *raster.Raster, ts []*tree.Tree, size, sympSize floa
 	node := -1
 	eventF := -1
 	set := -1
+	res := -1
 	for i, v := range h {
 		switch strings.ToLower(v) {
 		case "id":
@@ -186,6 +322,8 @@ func Read(in io.Reader, ras *raster.Raster, ts []*tree.Tree, size, sympSize floa
 			eventF = i
 		case "set":
 			set = i
+		case "resolution":
+			res = i
 		}
 	}
 	if (ID < 0) || (treeF < 0) || (node < 0) || (eventF < 0) || (set < 0) {
@@ -223,15 +361,17 @@ func Read(in io.Reader, ras *raster.Raster, ts []*tree.Tree, size, sympSize floa
 			}
 			prev = row[treeF]
 			id = row[ID]
-			nr = OR(ras, t, size, sympSize, useLen)
+			nr = OR(ras, t, p.Size, p.SympSize, p.UseLen)
 			nr.ID = row[ID]
 			recs = append(recs, nr)
 		}
-		n := -1
-		for j, v := range t.Nodes {
-			if v.ID == row[node] {
-				n = j
-				break
+		n := nr.nodeIndex(row[node])
+		if n < 0 {
+			return nil, fmt.Errorf("(recons) row %d: node %s (tree %s) not found", i, row[node], t.ID)
+		}
+		if (res >= 0) && (len(row) > res) && (len(row[res]) > 0) {
+			if err := nr.readResolution(n, row[res]); err != nil {
+				return nil, fmt.Errorf("(recons) row %d: node %s (tree %s): %v", i, row[node], t.ID, err)
 			}
 		}
 		if (nr.Rec[n].SetL == -1) || (row[eventF] == "*") {
@@ -247,28 +387,28 @@ func Read(in io.Reader, ras *raster.Raster, ts []*tree.Tree, size, sympSize floa
 			if row[set] == "*" {
 				break
 			}
-			if t.Nodes[setL].ID == row[set] {
+			if nr.Rec[setL].Node.ID == row[set] {
 				event = SympL
-			} else if t.Nodes[setR].ID == row[set] {
+			} else if nr.Rec[setR].Node.ID == row[set] {
 				event = SympR
 			} else {
 				continue
 			}
 		case "p":
-			if t.Nodes[setL].ID == row[set] {
+			if nr.Rec[setL].Node.ID == row[set] {
 				event = PointR
-			} else if t.Nodes[setR].ID == row[set] {
+			} else if nr.Rec[setR].Node.ID == row[set] {
 				event = PointL
 			} else {
-				return nil, fmt.Errorf("(recons) row %d: invalid set for node %s (tree %s)", i, t.Nodes[n].ID, t.ID)
+				return nil, fmt.Errorf("(recons) row %d: invalid set for node %s (tree %s)", i, row[node], t.ID)
 			}
 		case "f":
-			if t.Nodes[setL].ID == row[set] {
+			if nr.Rec[setL].Node.ID == row[set] {
 				event = FoundR
-			} else if t.Nodes[setR].ID == row[set] {
+			} else if nr.Rec[setR].Node.ID == row[set] {
 				event = FoundL
 			} else {
-				return nil, fmt.Errorf("(recons) row %d: invalid set for node %s (tree %s)", i, t.Nodes[n].ID, t.ID)
+				return nil, fmt.Errorf("(recons) row %d: invalid set for node %s (tree %s)", i, row[node], t.ID)
 			}
 		default:
 			return nil, fmt.Errorf("(recons) row %d: unknown event %s", i, row[eventF])
@@ -276,9 +416,53 @@ func Read(in io.Reader, ras *raster.Raster, ts []*tree.Tree, size, sympSize floa
 		nr.Rec[n].Flag = event
 		nr.DownPass(n)
 	}
+	for _, rc := range recs {
+		rc.SetVicCost(p.VicC)
+		rc.SetSympCost(p.SympC)
+		rc.SetPointCost(p.PointC)
+		rc.SetFoundCost(p.FoundC)
+	}
 	return recs, nil
 }
 
+// nodeIndex returns the index of the node with a given ID, or -1 if there
+// is no node with that ID.
+func (r *Recons) nodeIndex(id string) int {
+	for i := range r.Rec {
+		if r.Rec[i].Node.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// readResolution sets the resolution of a polytomy from a list of node
+// IDs separated by commas.
+func (r *Recons) readResolution(n int, s string) error {
+	prev := r.Resolution(n)
+	if prev == nil {
+		return errors.New("resolution of a node that is not a polytomy")
+	}
+	in := make(map[int]bool)
+	for _, d := range prev {
+		in[d] = true
+	}
+	var ord []int
+	for _, id := range strings.Split(s, ",") {
+		d := r.nodeIndex(strings.TrimSpace(id))
+		if (d < 0) || !in[d] {
+			return fmt.Errorf("invalid resolution descendant %s", id)
+		}
+		in[d] = false
+		ord = append(ord, d)
+	}
+	if len(ord) != len(prev) {
+		return fmt.Errorf("resolution with %d descendants, expecting %d", len(ord), len(prev))
+	}
+	r.SetResolution(n, ord)
+	return nil
+}
+
 // Cost returns the cost of a given reconstruction.
 func (r *Recons) Cost() float64 {
 	return r.Rec[0].Cost
@@ -298,17 +482,19 @@ func (r *Recons) MakeCopy() *Recons {
 		FoundC:   r.FoundC,
 		PointC:   r.PointC,
 		SympSize: r.SympSize,
+
+		Strata:     r.Strata,
+		StrataFile: r.StrataFile,
 	}
 	for i := range r.Rec {
 		cp.Rec[i].Node = r.Rec[i].Node
-		cp.Rec[i].Obs = make(bitfield.Bitfield, cp.Raster.Fields)
-		cp.Rec[i].Fill = make(bitfield.Bitfield, cp.Raster.Fields)
-		copy(cp.Rec[i].Obs, r.Rec[i].Obs)
-		copy(cp.Rec[i].Fill, r.Rec[i].Fill)
+		cp.Rec[i].Obs = bitfield.Clone(r.Rec[i].Obs)
+		cp.Rec[i].Fill = bitfield.Clone(r.Rec[i].Fill)
 		cp.Rec[i].SetL = r.Rec[i].SetL
 		cp.Rec[i].SetR = r.Rec[i].SetR
 		cp.Rec[i].Cost = r.Rec[i].Cost
 		cp.Rec[i].Flag = r.Rec[i].Flag
+		cp.Rec[i].Nest = r.Rec[i].Nest
 	}
 	return cp
 }
@@ -376,6 +562,11 @@ func (r *Recons) IsDiff(cp *Recons) bool {
 			continue
 		}
 
+		// the resolution of a polytomy
+		if (r.Rec[i].SetL != cp.Rec[i].SetL) || (r.Rec[i].SetR != cp.Rec[i].SetR) {
+			return true
+		}
+
 		// All sympatry events are really the same kind of event
 		// so we must test the content of the node, rather than
 		// the raw event
@@ -416,6 +607,17 @@ func (r *Recons) Randomize(prob int, evs []int) {
 		r.Rec[i].Flag = evs[j]
 		r.DownPass(i)
 	}
+	for _, p := range r.Polytomies() {
+		if rand.Intn(100) > prob {
+			continue
+		}
+		ord := r.Resolution(p)
+		for i := range ord {
+			j := rand.Intn(i + 1)
+			ord[i], ord[j] = ord[j], ord[i]
+		}
+		r.SetResolution(p, ord)
+	}
 }
 
 // Copy copies the content of cp into reconstruction r.
@@ -434,10 +636,12 @@ func (r *Recons) Copy(cp *Recons) {
 	r.FoundC = cp.FoundC
 	r.PointC = cp.PointC
 	r.SympSize = cp.SympSize
+	r.Strata = cp.Strata
+	r.StrataFile = cp.StrataFile
 
 	for i := range cp.Rec {
-		copy(r.Rec[i].Obs, cp.Rec[i].Obs)
-		copy(r.Rec[i].Fill, cp.Rec[i].Fill)
+		r.Rec[i].Obs.Copy(cp.Rec[i].Obs)
+		r.Rec[i].Fill.Copy(cp.Rec[i].Fill)
 		r.Rec[i].SetL = cp.Rec[i].SetL
 		r.Rec[i].SetR = cp.Rec[i].SetR
 		r.Rec[i].Cost = cp.Rec[i].Cost
@@ -446,14 +650,21 @@ func (r *Recons) Copy(cp *Recons) {
 }
 
 // Write writes a reconstruction in csv format on a given output stream. If
-// header is false, no header will be printed.
+// header is false, no header will be printed. The header includes the
+// parameters of the reconstruction. The resolution of each polytomy is
+// written as the list of the IDs of its descendants, separated by commas.
 func (r *Recons) Write(out io.Writer, header bool) error {
+	if header {
+		if err := r.Params().Write(out); err != nil {
+			return err
+		}
+	}
 	w := csv.NewWriter(out)
 	w.Comma = '\t'
 	w.UseCRLF = true
 	defer w.Flush()
 	if header {
-		err := w.Write([]string{"Tree", "ID", "Node", "Event", "Set"})
+		err := w.Write([]string{"Tree", "ID", "Node", "Event", "Set", "Resolution"})
 		if err != nil {
 			return err
 		}
@@ -462,25 +673,11 @@ func (r *Recons) Write(out io.Writer, header bool) error {
 		if r.Rec[i].Node.First == nil {
 			continue
 		}
-		e := "*"
-		switch r.Rec[i].Flag {
-		case Vic:
-			e = "v"
-		case SympU, SympL, SympR:
-			e = "s"
-		case PointL, PointR:
-			e = "p"
-		case FoundL, FoundR:
-			e = "f"
-		}
-		dv := "*"
-		switch r.Rec[i].Flag {
-		case SympL, PointR, FoundR:
-			dv = r.Rec[r.Rec[i].SetL].Node.ID
-		case SympR, PointL, FoundL:
-			dv = r.Rec[r.Rec[i].SetR].Node.ID
-		}
-		err := w.Write([]string{r.Tree.ID, r.ID, r.Rec[i].Node.ID, e, dv})
+		var res []string
+		for _, d := range r.Resolution(i) {
+			res = append(res, r.Rec[d].Node.ID)
+		}
+		err := w.Write([]string{r.Tree.ID, r.ID, r.Rec[i].Node.ID, eventCode(r.Rec[i].Flag), r.setID(i), strings.Join(res, ",")})
 		if err != nil {
 			return err
 		}
@@ -488,10 +685,57 @@ func (r *Recons) Write(out io.Writer, header bool) error {
 	return nil
 }
 
+// eventCode returns the code used to write an event: 'v' for vicariance,
+// 's' for sympatry, 'p' for punctual sympatry, 'f' for founder event, and
+// '*' for undefined events.
+func eventCode(flag int) string {
+	switch flag {
+	case Vic:
+		return "v"
+	case SympU, SympL, SympR:
+		return "s"
+	case PointL, PointR:
+		return "p"
+	case FoundL, FoundR:
+		return "f"
+	}
+	return "*"
+}
+
+// EventName returns the name of the event of a flag: 'vic' (vicariance),
+// 'symp' (sympatry), 'point' (punctual sympatry), 'found' (founder event),
+// or 'noev' if there is no event.
+func EventName(flag int) string {
+	switch flag {
+	case Vic:
+		return "vic"
+	case SympU, SympL, SympR:
+		return "symp"
+	case PointL, PointR:
+		return "point"
+	case FoundL, FoundR:
+		return "found"
+	}
+	return "noev"
+}
+
+// setID returns the identifier of the descendant that defines the
+// ancestral range of node n (in a partial sympatry, a punctual sympatry or
+// a founder event), or '*' if there is no such descendant.
+func (r *Recons) setID(n int) string {
+	switch r.Rec[n].Flag {
+	case SympL, PointR, FoundR:
+		return r.Rec[r.Rec[n].SetL].Node.ID
+	case SympR, PointL, FoundL:
+		return r.Rec[r.Rec[n].SetR].Node.ID
+	}
+	return "*"
+}
+
 // DownPass optimize the path from node n to root.
 func (r *Recons) DownPass(n int) float64 {
-	for v := r.Rec[n].Node; v != nil; v = v.Anc {
-		r.optimize(v.Index)
+	for v := n; v >= 0; v = r.Anc(v) {
+		r.optimize(v)
 	}
 	return r.Rec[0].Cost
 }
@@ -523,47 +767,47 @@ func (r *Recons) optimize(n int) {
 	cost := r.Rec[setL].Cost + r.Rec[setR].Cost
 	switch r.Rec[n].Flag {
 	case Vic:
-		copy(r.Rec[n].Obs, r.Rec[setL].Obs)
-		copy(r.Rec[n].Fill, r.Rec[setL].Fill)
+		r.Rec[n].Obs.Copy(r.Rec[setL].Obs)
+		r.Rec[n].Fill.Copy(r.Rec[setL].Fill)
 		r.Rec[n].Obs.Union(r.Rec[setR].Obs)
 		r.Rec[n].Fill.Union(r.Rec[setR].Fill)
 		cost += r.vicariance(n)
 	case SympU:
-		copy(r.Rec[n].Obs, r.Rec[setL].Obs)
-		copy(r.Rec[n].Fill, r.Rec[setL].Fill)
+		r.Rec[n].Obs.Copy(r.Rec[setL].Obs)
+		r.Rec[n].Fill.Copy(r.Rec[setL].Fill)
 		r.Rec[n].Obs.Union(r.Rec[setR].Obs)
 		r.Rec[n].Fill.Union(r.Rec[setR].Fill)
 		cost += r.sympatry(n)
 	case SympL:
 		// In left sympatry, the ancestor is equal to left descendant
-		copy(r.Rec[n].Obs, r.Rec[setL].Obs)
-		copy(r.Rec[n].Fill, r.Rec[setL].Fill)
+		r.Rec[n].Obs.Copy(r.Rec[setL].Obs)
+		r.Rec[n].Fill.Copy(r.Rec[setL].Fill)
 		cost += r.sympatry(n)
 	case SympR:
 		// In right sumpatry, the ancestor is equal to rigth
 		// descendant
-		copy(r.Rec[n].Obs, r.Rec[setR].Obs)
-		copy(r.Rec[n].Fill, r.Rec[setR].Fill)
+		r.Rec[n].Obs.Copy(r.Rec[setR].Obs)
+		r.Rec[n].Fill.Copy(r.Rec[setR].Fill)
 		cost += r.sympatry(n)
 	case PointL:
 		// setL is a point inside a setR-exact ancestor
-		copy(r.Rec[n].Obs, r.Rec[setR].Obs)
-		copy(r.Rec[n].Fill, r.Rec[setR].Fill)
+		r.Rec[n].Obs.Copy(r.Rec[setR].Obs)
+		r.Rec[n].Fill.Copy(r.Rec[setR].Fill)
 		cost += r.point(n, setL)
 	case PointR:
 		// setR is a point inside a set setL-exact ancestor
-		copy(r.Rec[n].Obs, r.Rec[setL].Obs)
-		copy(r.Rec[n].Fill, r.Rec[setL].Fill)
+		r.Rec[n].Obs.Copy(r.Rec[setL].Obs)
+		r.Rec[n].Fill.Copy(r.Rec[setL].Fill)
 		cost += r.point(n, setR)
 	case FoundL:
 		// setL is a founder outside a setR-exact ancestor
-		copy(r.Rec[n].Obs, r.Rec[setR].Obs)
-		copy(r.Rec[n].Fill, r.Rec[setR].Fill)
+		r.Rec[n].Obs.Copy(r.Rec[setR].Obs)
+		r.Rec[n].Fill.Copy(r.Rec[setR].Fill)
 		cost += r.founder(n, setL)
 	case FoundR:
 		// setR is a founder outside a setL-exact ancestor
-		copy(r.Rec[n].Obs, r.Rec[setL].Obs)
-		copy(r.Rec[n].Fill, r.Rec[setL].Fill)
+		r.Rec[n].Obs.Copy(r.Rec[setL].Obs)
+		r.Rec[n].Fill.Copy(r.Rec[setL].Fill)
 		cost += r.founder(n, setR)
 	}
 	if r.Size > 0 {
@@ -591,7 +835,7 @@ func (r *Recons) founder(n, f int) float64 {
 	if r.UseLen {
 		cost = cost / r.Rec[f].Node.Len
 	}
-	return cost + r.FoundC
+	return cost + r.foundCost(n)
 }
 
 // point calculates the cost of a point sympatry event in which one of the
@@ -609,7 +853,7 @@ func (r *Recons) point(n, p int) float64 {
 	if r.UseLen {
 		cost = cost / r.Rec[p].Node.Len
 	}
-	return cost + r.PointC
+	return cost + r.pointCost(n)
 }
 
 // sympatry calculates the cost of full sympatry.
@@ -638,7 +882,7 @@ func (r *Recons) sympatry(n int) float64 {
 		extra = float64(r.Rec[n].Obs.Count()) / r.SympSize
 	}
 
-	return costL + costR + r.SympC + extra
+	return costL + costR + r.sympCost(n) + extra
 }
 
 // vicariance calculates the cost of a disjunct set.
@@ -675,7 +919,7 @@ func (r *Recons) vicariance(n int) float64 {
 		costR = costR / r.Rec[setR].Node.Len
 	}
 
-	return costL + costR + r.VicC
+	return costL + costR + r.vicCost(n)
 }
 
 // Eval store the evaluation of a given reconstruction.
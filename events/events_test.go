@@ -0,0 +1,114 @@
+// Copyright (c) 2015, J. Salvador Arias <jsalarias@csnat.unt.edu.ar>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package events
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/js-arias/evs/biogeo"
+	"github.com/js-arias/evs/raster"
+	"github.com/js-arias/evs/tree"
+)
+
+func testRaster() *raster.Raster {
+	d := &biogeo.DataSet{
+		Ls: []*biogeo.Taxon{
+			{Name: "a", Recs: []biogeo.GeoRef{{Lon: -65.5, Lat: -26.5}, {Lon: -64.5, Lat: -27.5}}},
+			{Name: "b", Recs: []biogeo.GeoRef{{Lon: -65.5, Lat: -26.5}}},
+			{Name: "c", Recs: []biogeo.GeoRef{{Lon: -60.5, Lat: -30.5}}},
+			{Name: "d", Recs: []biogeo.GeoRef{{Lon: -50.5, Lat: -20.5}, {Lon: -51.5, Lat: -20.5}}},
+			{Name: "e", Recs: []biogeo.GeoRef{{Lon: 20.5, Lat: 0.5}}},
+		},
+	}
+	return raster.RasterizeGrid(d, raster.NewEquirect(360), 1)
+}
+
+func readTree(t *testing.T, s string) *tree.Tree {
+	tr, err := tree.ReadParenthetic(strings.NewReader(s), "t1")
+	if err != nil {
+		t.Fatalf("read error: %v", err)
+	}
+	return tr
+}
+
+func TestPolytomy(t *testing.T) {
+	ras := testRaster()
+	tr := readTree(t, "((a,b,c,d),e);")
+	or := OR(ras, tr, 0, 0, false)
+	if len(or.Rec) != len(tr.Nodes)+2 {
+		t.Fatalf("polytomy error: expecting %d nodes, found %d", len(tr.Nodes)+2, len(or.Rec))
+	}
+	ps := or.Polytomies()
+	if len(ps) != 1 {
+		t.Fatalf("polytomy error: expecting 1 polytomy, found %d", len(ps))
+	}
+	p := ps[0]
+	if id := or.Rec[or.Anc(2)].Node.ID; id != "1.1" {
+		t.Errorf("ancestor error: expecting 1.1, found %s", id)
+	}
+
+	// a polytomy is evaluated as a nested series of binary events
+	for _, ord := range [][]int{{2, 3, 4, 5}, {5, 4, 3, 2}, {3, 5, 2, 4}} {
+		or.SetResolution(p, ord)
+		var terms []string
+		for _, d := range ord {
+			terms = append(terms, tr.Nodes[d].Term)
+		}
+		bt := readTree(t, "(((("+terms[0]+","+terms[1]+"),"+terms[2]+"),"+terms[3]+"),e);")
+		bin := OR(ras, bt, 0, 0, false)
+		for i := range bin.Rec {
+			if bin.Rec[i].Node.First == nil {
+				continue
+			}
+			// copies the events of the binary tree
+			j := i
+			switch bin.Rec[i].Node.ID {
+			case "3":
+				j = or.Rec[p].Nest[0]
+			case "2":
+				j = or.Rec[p].Nest[1]
+			case "1":
+				j = p
+			}
+			or.Rec[j].Flag = bin.Rec[i].Flag
+			or.DownPass(j)
+		}
+		if or.Cost() != bin.Cost() {
+			t.Errorf("cost error: resolution %v: expecting %.3f, found %.3f", ord, bin.Cost(), or.Cost())
+		}
+	}
+
+	// the resolution is stored in the output
+	var buf bytes.Buffer
+	if err := or.Write(&buf, true); err != nil {
+		t.Fatalf("write error: %v", err)
+	}
+	recs, err := Read(&buf, ras, []*tree.Tree{tr}, nil)
+	if err != nil {
+		t.Fatalf("read error: %v", err)
+	}
+	nr := recs[0]
+	if got, want := nr.Resolution(p), or.Resolution(p); (len(got) != len(want)) || (got[0] != want[0]) || (got[3] != want[3]) {
+		t.Errorf("read error: expecting resolution %v, found %v", want, got)
+	}
+	if nr.Cost() != or.Cost() {
+		t.Errorf("read error: expecting cost %.3f, found %.3f", or.Cost(), nr.Cost())
+	}
+
+	// the cost of each nested event is annotated only once
+	var sum float64
+	for i := range or.Rec {
+		sum += or.nodeCost(i)
+	}
+	if math.Abs(sum-or.Cost()) > 1e-6 {
+		t.Errorf("node cost error: expecting %.3f, found %.3f", or.Cost(), sum)
+	}
+	if nw := or.Newick(); !strings.Contains(nw, "nested={1.1:") || !strings.Contains(nw, "nested_cost={") {
+		t.Errorf("newick error: nested events not found in %q", nw)
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright (c) 2015, J. Salvador Arias <jsalarias@csnat.unt.edu.ar>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package events
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/js-arias/evs/tree"
+)
+
+// WriteNexus writes one or more reconstructions as the TREES block of a
+// NEXUS file, in which each tree is identified by the tree and the
+// reconstruction IDs (separated by a dot). Each node is annotated (in the
+// extended Newick format used by FigTree) with the following values:
+//
+//	event		the event of an internal node (as in Write)
+//	set		the descendant that defines the ancestral range (if any)
+//	resolution	the order of the descendants of a polytomy (if any)
+//	nested		the nested events of a polytomy (if any), as the ID of
+//			each nested node and its event (e.g. '5.1:v')
+//	nested_cost	the cost of each nested event of a polytomy
+//	range_cells	the number of observed pixels of the node range
+//	cost		the cost of the node, without the cost of its
+//			descendants (in a polytomy, only the cost of the last
+//			event of the nested series)
+//	age		the age of the node (only if the tree is dated)
+func WriteNexus(out io.Writer, recs []*Recons) error {
+	if _, err := fmt.Fprintf(out, "#NEXUS\r\n\r\nbegin trees;\r\n"); err != nil {
+		return err
+	}
+	for _, r := range recs {
+		id := tree.Label(r.Tree.ID + "." + r.ID)
+		if _, err := fmt.Fprintf(out, "\ttree %s = [&R] %s\r\n", id, r.Newick()); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(out, "end;\r\n")
+	return err
+}
+
+// Newick returns the tree of a reconstruction in extended Newick format,
+// with the node annotations described in WriteNexus.
+func (r *Recons) Newick() string {
+	return r.Tree.Newick(func(n *tree.Node) string {
+		s := "&"
+		if n.First != nil {
+			s += "event=" + eventCode(r.Rec[n.Index].Flag)
+			if set := r.setID(n.Index); set != "*" {
+				s += ",set=" + tree.Label(set)
+			}
+			if res := r.Resolution(n.Index); res != nil {
+				ids := make([]string, 0, len(res))
+				for _, d := range res {
+					ids = append(ids, tree.Label(r.Rec[d].Node.ID))
+				}
+				s += ",resolution={" + strings.Join(ids, ",") + "}"
+			}
+			if nest := r.Rec[n.Index].Nest; len(nest) > 0 {
+				evs := make([]string, 0, len(nest))
+				costs := make([]string, 0, len(nest))
+				for _, v := range nest {
+					evs = append(evs, tree.Label(r.Rec[v].Node.ID)+":"+eventCode(r.Rec[v].Flag))
+					costs = append(costs, strconv.FormatFloat(r.nodeCost(v), 'g', 6, 64))
+				}
+				s += ",nested={" + strings.Join(evs, ",") + "}"
+				s += ",nested_cost={" + strings.Join(costs, ",") + "}"
+			}
+			s += ","
+		}
+		s += "range_cells=" + strconv.Itoa(r.Rec[n.Index].Obs.Count())
+		s += ",cost=" + strconv.FormatFloat(r.nodeCost(n.Index), 'g', 6, 64)
+		if r.Tree.Dated {
+			s += ",age=" + strconv.FormatFloat(n.Age, 'g', 6, 64)
+		}
+		return s
+	})
+}
+
+// nodeCost returns the cost of node n, without the cost of its
+// descendants. In a polytomy, the descendants are the nodes of the last
+// event of the nested series, so the cost of each nested node is only
+// counted once.
+func (r *Recons) nodeCost(n int) float64 {
+	c := r.Rec[n].Cost
+	if (r.Rec[n].SetL != -1) && (r.Rec[n].Flag != Undef) {
+		c -= r.Rec[r.Rec[n].SetL].Cost + r.Rec[r.Rec[n].SetR].Cost
+	} else {
+		for d := r.Rec[n].Node.First; d != nil; d = d.Sister {
+			c -= r.Rec[d.Index].Cost
+		}
+	}
+	// ignores rounding errors
+	if math.Abs(c) < 1e-9 {
+		return 0
+	}
+	return c
+}
@@ -0,0 +1,233 @@
+// Copyright (c) 2015, J. Salvador Arias <jsalarias@csnat.unt.edu.ar>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package events
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/js-arias/evs/raster"
+)
+
+// Params are the parameters used to build a reconstruction: the costs of
+// the events, and the settings of the raster.
+//
+// The parameters are stored at the start of a reconstruction file, as a
+// block of comment lines (starting with '#') of the form 'key: value'.
+type Params struct {
+	// event costs
+	Size     float64 // -z|--size
+	SympSize float64 // --sympSize
+	UseLen   bool    // -b|--brlen
+	VicC     float64 // --vic
+	SympC    float64 // --symp
+	PointC   float64 // --point
+	FoundC   float64 // --found
+	Strata   string  // --strata
+
+	// raster settings
+	Raster   string  // --raster
+	Grid     string  // --grid
+	Cols     int     // -c|--columns
+	Fill     int     // -f|--fill
+	FillDist float64 // --fillDist
+	Ranges   string  // --ranges
+	Maps     string  // --maps
+	BBox     string  // --bbox
+	Mask     string  // --mask
+	Taxa     string  // --taxa
+
+	// property of the taxon names in the ranges file
+	RangesName string // --rangesName
+
+	// uncertainty of the records
+	UncertObs bool    // --uncertObs
+	MaxUncert float64 // --maxUncert
+}
+
+// DefaultParams returns the default parameters of a reconstruction.
+func DefaultParams() *Params {
+	return &Params{
+		VicC:   1,
+		SympC:  1,
+		PointC: 1,
+		FoundC: 1,
+		Grid:   raster.EquirectGrid,
+		Cols:   360,
+		Fill:   2,
+	}
+}
+
+// Params returns the parameters of the reconstruction.
+func (r *Recons) Params() *Params {
+	p := &Params{
+		Size:     r.Size,
+		SympSize: r.SympSize,
+		UseLen:   r.UseLen,
+		VicC:     r.VicC,
+		SympC:    r.SympC,
+		PointC:   r.PointC,
+		FoundC:   r.FoundC,
+		Strata:   r.StrataFile,
+	}
+	if r.Raster != nil {
+		p.Raster = r.Raster.File
+		p.Cols = r.Raster.Cols
+		p.Fill = r.Raster.Fill
+		p.FillDist = r.Raster.Dist
+		p.Ranges = r.Raster.Ranges
+		p.RangesName = r.Raster.RangesName
+		p.Maps = r.Raster.Maps
+		p.BBox = r.Raster.BBox
+		p.Mask = r.Raster.Mask
+		p.Taxa = r.Raster.Taxa
+		p.UncertObs = r.Raster.UncertObs
+		p.MaxUncert = r.Raster.MaxUncert
+		if r.Raster.Grid != nil {
+			p.Grid = r.Raster.Grid.Name()
+		}
+	}
+	return p
+}
+
+// Write writes the parameters as a block of comment lines into an output
+// stream.
+func (p *Params) Write(out io.Writer) error {
+	lines := []struct {
+		key, val string
+	}{
+		{"vic", strconv.FormatFloat(p.VicC, 'f', -1, 64)},
+		{"symp", strconv.FormatFloat(p.SympC, 'f', -1, 64)},
+		{"point", strconv.FormatFloat(p.PointC, 'f', -1, 64)},
+		{"found", strconv.FormatFloat(p.FoundC, 'f', -1, 64)},
+		{"size", strconv.FormatFloat(p.Size, 'f', -1, 64)},
+		{"sympSize", strconv.FormatFloat(p.SympSize, 'f', -1, 64)},
+		{"brlen", strconv.FormatBool(p.UseLen)},
+		{"grid", p.Grid},
+		{"columns", strconv.FormatInt(int64(p.Cols), 10)},
+		{"fill", strconv.FormatInt(int64(p.Fill), 10)},
+		{"fillDist", strconv.FormatFloat(p.FillDist, 'f', -1, 64)},
+	}
+	if len(p.Strata) > 0 {
+		lines = append(lines, struct{ key, val string }{"strata", p.Strata})
+	}
+	if len(p.Raster) > 0 {
+		lines = append(lines, struct{ key, val string }{"raster", p.Raster})
+	}
+	if len(p.Ranges) > 0 {
+		lines = append(lines, struct{ key, val string }{"ranges", p.Ranges})
+	}
+	if len(p.RangesName) > 0 {
+		lines = append(lines, struct{ key, val string }{"rangesName", p.RangesName})
+	}
+	if len(p.Maps) > 0 {
+		lines = append(lines, struct{ key, val string }{"maps", p.Maps})
+	}
+	if len(p.BBox) > 0 {
+		lines = append(lines, struct{ key, val string }{"bbox", p.BBox})
+	}
+	if len(p.Mask) > 0 {
+		lines = append(lines, struct{ key, val string }{"mask", p.Mask})
+	}
+	if len(p.Taxa) > 0 {
+		lines = append(lines, struct{ key, val string }{"taxa", p.Taxa})
+	}
+	if p.UncertObs {
+		lines = append(lines, struct{ key, val string }{"uncertObs", strconv.FormatBool(p.UncertObs)})
+	}
+	if p.MaxUncert > 0 {
+		lines = append(lines, struct{ key, val string }{"maxUncert", strconv.FormatFloat(p.MaxUncert, 'f', -1, 64)})
+	}
+	for _, l := range lines {
+		if _, err := fmt.Fprintf(out, "# %s: %s\r\n", l.key, l.val); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadParams reads the block of parameters at the start of a
+// reconstruction file. After reading, in will be positioned at the first
+// line after the parameters. If there is no block of parameters, it returns
+// the default parameters. Parameters not found in the block take the
+// default value.
+func ReadParams(in *bufio.Reader) (*Params, error) {
+	p := DefaultParams()
+	for i := 1; ; i++ {
+		b, err := in.Peek(1)
+		if (err != nil) || (b[0] != '#') {
+			break
+		}
+		ln, err := in.ReadString('\n')
+		if (err != nil) && (err != io.EOF) {
+			return nil, fmt.Errorf("(params) line %d: %v", i, err)
+		}
+		kv := strings.SplitN(strings.TrimPrefix(ln, "#"), ":", 2)
+		if len(kv) < 2 {
+			continue
+		}
+		if err := p.set(strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])); err != nil {
+			return nil, fmt.Errorf("(params) line %d: %v", i, err)
+		}
+	}
+	return p, nil
+}
+
+// set sets a parameter read from a parameter block. Unknown parameters are
+// ignored.
+func (p *Params) set(key, val string) error {
+	var err error
+	switch strings.ToLower(key) {
+	case "vic":
+		p.VicC, err = strconv.ParseFloat(val, 64)
+	case "symp":
+		p.SympC, err = strconv.ParseFloat(val, 64)
+	case "point":
+		p.PointC, err = strconv.ParseFloat(val, 64)
+	case "found":
+		p.FoundC, err = strconv.ParseFloat(val, 64)
+	case "strata":
+		p.Strata = val
+	case "size":
+		p.Size, err = strconv.ParseFloat(val, 64)
+	case "sympsize":
+		p.SympSize, err = strconv.ParseFloat(val, 64)
+	case "brlen":
+		p.UseLen, err = strconv.ParseBool(val)
+	case "raster":
+		p.Raster = val
+	case "grid":
+		p.Grid = val
+	case "columns":
+		p.Cols, err = strconv.Atoi(val)
+	case "fill":
+		p.Fill, err = strconv.Atoi(val)
+	case "filldist":
+		p.FillDist, err = strconv.ParseFloat(val, 64)
+	case "ranges":
+		p.Ranges = val
+	case "rangesname":
+		p.RangesName = val
+	case "maps":
+		p.Maps = val
+	case "bbox":
+		p.BBox = val
+	case "mask":
+		p.Mask = val
+	case "taxa":
+		p.Taxa = val
+	case "uncertobs":
+		p.UncertObs, err = strconv.ParseBool(val)
+	case "maxuncert":
+		p.MaxUncert, err = strconv.ParseFloat(val, 64)
+	}
+	if err != nil {
+		return fmt.Errorf("parameter %s: %v", key, err)
+	}
+	return nil
+}
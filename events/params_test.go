@@ -0,0 +1,63 @@
+// Copyright (c) 2015, J. Salvador Arias <jsalarias@csnat.unt.edu.ar>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package events
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestParams(t *testing.T) {
+	p := &Params{
+		Size:     3,
+		SympSize: 0.5,
+		UseLen:   true,
+		VicC:     2,
+		SympC:    1,
+		PointC:   1.5,
+		FoundC:   4,
+		Strata:   "strata.tab",
+		Raster:   "raster.tab",
+		Grid:     "hex",
+		Cols:     720,
+		Fill:     1,
+		FillDist: 250,
+		BBox:     "-80,-40,-50,-10",
+		Taxa:     "taxa.txt",
+
+		RangesName: "binomial",
+
+		UncertObs: true,
+		MaxUncert: 5000,
+	}
+	var buf bytes.Buffer
+	if err := p.Write(&buf); err != nil {
+		t.Fatalf("write error: %v", err)
+	}
+	buf.WriteString("Tree\tID\tNode\tEvent\tSet\r\n")
+	in := bufio.NewReader(&buf)
+	np, err := ReadParams(in)
+	if err != nil {
+		t.Fatalf("read error: %v", err)
+	}
+	if *np != *p {
+		t.Errorf("params error: expecting %v, found %v", *p, *np)
+	}
+	ln, _ := in.ReadString('\n')
+	if !strings.HasPrefix(ln, "Tree") {
+		t.Errorf("read error: expecting header, found %q", ln)
+	}
+
+	// a file without parameters
+	np, err = ReadParams(bufio.NewReader(strings.NewReader("Tree\tID\tNode\tEvent\tSet\r\n")))
+	if err != nil {
+		t.Fatalf("read error: %v", err)
+	}
+	if *np != *DefaultParams() {
+		t.Errorf("params error: expecting %v, found %v", *DefaultParams(), *np)
+	}
+}
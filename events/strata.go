@@ -0,0 +1,189 @@
+// Copyright (c) 2015, J. Salvador Arias <jsalarias@csnat.unt.edu.ar>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package events
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// A Stratum is a time slice with its own event costs. Start is the age of
+// the beginning (the oldest age) of the slice, and End the age of its end.
+// A cost of zero means that the cost of the reconstruction is used for
+// that event.
+type Stratum struct {
+	Name   string
+	Start  float64
+	End    float64
+	VicC   float64
+	SympC  float64
+	PointC float64
+	FoundC float64
+}
+
+// ReadStrata reads a stratification from a tab delimited file with the
+// columns 'Start' and 'End', and optionally, 'Name', 'Vic', 'Symp', 'Point'
+// and 'Found' (the costs of the events in the slice). An empty cost, or a
+// missing cost column, means that the cost of the reconstruction is used.
+// The time slices can not overlap.
+func ReadStrata(in io.Reader) ([]Stratum, error) {
+	r := csv.NewReader(in)
+	r.Comma = '\t'
+
+	h, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("header (strata): %v", err)
+	}
+	name, start, end := -1, -1, -1
+	costs := []int{-1, -1, -1, -1}
+	for i, v := range h {
+		switch strings.ToLower(strings.TrimSpace(v)) {
+		case "name", "stratum":
+			name = i
+		case "start":
+			start = i
+		case "end":
+			end = i
+		case "vic":
+			costs[0] = i
+		case "symp":
+			costs[1] = i
+		case "point":
+			costs[2] = i
+		case "found":
+			costs[3] = i
+		}
+	}
+	if (start < 0) || (end < 0) {
+		return nil, errors.New("header (strata): incomplete header")
+	}
+	var st []Stratum
+	for i := 1; ; i++ {
+		row, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("(strata) row %d: %v", i, err)
+		}
+		for j := range row {
+			row[j] = strings.TrimSpace(row[j])
+		}
+		if (len(row[start]) == 0) && (len(row[end]) == 0) {
+			continue
+		}
+		var s Stratum
+		if name >= 0 {
+			s.Name = row[name]
+		}
+		if s.Start, err = strconv.ParseFloat(row[start], 64); err != nil {
+			return nil, fmt.Errorf("(strata) row %d: start: %v", i, err)
+		}
+		if s.End, err = strconv.ParseFloat(row[end], 64); err != nil {
+			return nil, fmt.Errorf("(strata) row %d: end: %v", i, err)
+		}
+		if s.End >= s.Start {
+			return nil, fmt.Errorf("(strata) row %d: end not younger than start", i)
+		}
+		for j, c := range []*float64{&s.VicC, &s.SympC, &s.PointC, &s.FoundC} {
+			if (costs[j] < 0) || (len(row[costs[j]]) == 0) {
+				continue
+			}
+			if *c, err = strconv.ParseFloat(row[costs[j]], 64); err != nil {
+				return nil, fmt.Errorf("(strata) row %d: %s: %v", i, h[costs[j]], err)
+			}
+			if *c <= 0 {
+				return nil, fmt.Errorf("(strata) row %d: %s: event costs should be greater than 0", i, h[costs[j]])
+			}
+		}
+		for _, o := range st {
+			if (s.End < o.Start) && (o.End < s.Start) {
+				return nil, fmt.Errorf("(strata) row %d: overlapping time slices", i)
+			}
+		}
+		st = append(st, s)
+	}
+	if len(st) == 0 {
+		return nil, errors.New("(strata): empty stratification")
+	}
+	return st, nil
+}
+
+// SetStrata sets the time slices of a stratified cost model, and updates
+// the reconstruction. The costs of the events of each node are the costs
+// of the slice that includes the age of the node. The nodes outside any
+// slice use the costs of the reconstruction. The tree of the
+// reconstruction must be dated, as the ages of the nodes of an undated
+// tree are not absolute ages.
+func (r *Recons) SetStrata(st []Stratum) error {
+	if (len(st) > 0) && !r.Tree.Dated {
+		return fmt.Errorf("tree %s: stratified costs on a tree that is not dated", r.Tree.ID)
+	}
+	r.Strata = st
+	for i := range r.Rec {
+		if r.Rec[i].SetL != -1 {
+			r.DownPass(i)
+		}
+	}
+	return nil
+}
+
+// stratum returns the time slice that includes the age of node n, or nil
+// if there is no such slice. An age equal to the boundary between two
+// slices is included in the youngest slice, and an age equal to the start
+// of the oldest slice (e.g. the root of a tree scaled to the start of the
+// stratification) is included in the oldest slice.
+func (r *Recons) stratum(n int) *Stratum {
+	age := r.Rec[n].Node.Age
+	var old *Stratum
+	for i := range r.Strata {
+		if (age >= r.Strata[i].End) && (age < r.Strata[i].Start) {
+			return &r.Strata[i]
+		}
+		if (old == nil) || (r.Strata[i].Start > old.Start) {
+			old = &r.Strata[i]
+		}
+	}
+	if (old != nil) && (age == old.Start) {
+		return old
+	}
+	return nil
+}
+
+// vicCost returns the cost of a vicariance at node n.
+func (r *Recons) vicCost(n int) float64 {
+	if s := r.stratum(n); (s != nil) && (s.VicC > 0) {
+		return s.VicC
+	}
+	return r.VicC
+}
+
+// sympCost returns the cost of a sympatry at node n.
+func (r *Recons) sympCost(n int) float64 {
+	if s := r.stratum(n); (s != nil) && (s.SympC > 0) {
+		return s.SympC
+	}
+	return r.SympC
+}
+
+// pointCost returns the cost of a punctual sympatry at node n.
+func (r *Recons) pointCost(n int) float64 {
+	if s := r.stratum(n); (s != nil) && (s.PointC > 0) {
+		return s.PointC
+	}
+	return r.PointC
+}
+
+// foundCost returns the cost of a founder event at node n.
+func (r *Recons) foundCost(n int) float64 {
+	if s := r.stratum(n); (s != nil) && (s.FoundC > 0) {
+		return s.FoundC
+	}
+	return r.FoundC
+}
@@ -0,0 +1,102 @@
+// Copyright (c) 2015, J. Salvador Arias <jsalarias@csnat.unt.edu.ar>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package events
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReadStrata(t *testing.T) {
+	data := "Name\tStart\tEnd\tVic\tFound\r\n" +
+		"young\t10\t0\t\t0.5\r\n" +
+		"old\t30\t10\t2\t\r\n"
+	st, err := ReadStrata(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("read error: %v", err)
+	}
+	if len(st) != 2 {
+		t.Fatalf("read error: expecting 2 strata, found %d", len(st))
+	}
+	want := []Stratum{
+		{Name: "young", Start: 10, End: 0, FoundC: 0.5},
+		{Name: "old", Start: 30, End: 10, VicC: 2},
+	}
+	for i, s := range st {
+		if s != want[i] {
+			t.Errorf("stratum error: expecting %v, found %v", want[i], s)
+		}
+	}
+
+	bad := []string{
+		"Name\tStart\tVic\r\nx\t10\t1\r\n",
+		"Start\tEnd\tVic\r\n0\t10\t1\r\n",
+		"Start\tEnd\tVic\r\n10\t0\t0\r\n",
+		"Start\tEnd\tVic\r\n10\t0\t1\r\n20\t5\t1\r\n",
+	}
+	for _, s := range bad {
+		if _, err := ReadStrata(strings.NewReader(s)); err == nil {
+			t.Errorf("read error: expecting error on %q", s)
+		}
+	}
+}
+
+func TestStrataCost(t *testing.T) {
+	ras := testRaster()
+	tr := readTree(t, "((a:1,b:1):1,(c:1,d:1):1);")
+	or := OR(ras, tr, 0, 0, false)
+	cost := or.Cost()
+
+	// an undated tree
+	st := []Stratum{{Start: 10, End: 0, VicC: 3, SympC: 3, PointC: 3, FoundC: 3}}
+	if err := or.SetStrata(st); err == nil {
+		t.Errorf("strata error: expecting error on an undated tree")
+	}
+	if or.Cost() != cost {
+		t.Errorf("cost error: stratified cost on an undated tree")
+	}
+
+	// the ages are the same, but the tree is dated
+	if err := tr.ScaleRoot(2); err != nil {
+		t.Fatalf("scale error: %v", err)
+	}
+
+	// a slice without nodes does not change the cost
+	if err := or.SetStrata([]Stratum{{Start: 100, End: 50, VicC: 5, SympC: 5, PointC: 5, FoundC: 5}}); err != nil {
+		t.Fatalf("strata error: %v", err)
+	}
+	if c := or.Cost(); c != cost {
+		t.Errorf("cost error: expecting %.3f, found %.3f", cost, c)
+	}
+
+	// a slice with all nodes is the same as changing the costs
+	cp := or.MakeCopy()
+	cp.SetStrata(nil)
+	cp.SetVicCost(3)
+	cp.SetSympCost(3)
+	cp.SetPointCost(3)
+	cp.SetFoundCost(3)
+	if err := or.SetStrata(st); err != nil {
+		t.Fatalf("strata error: %v", err)
+	}
+	if or.Cost() != cp.Cost() {
+		t.Errorf("cost error: expecting %.3f, found %.3f", cp.Cost(), or.Cost())
+	}
+	if or.Cost() == cost {
+		t.Errorf("cost error: stratified cost equal to the unstratified cost")
+	}
+
+	// the root is at the start of the oldest slice
+	boundary := []Stratum{
+		{Start: 2, End: 1, VicC: 3, SympC: 3, PointC: 3, FoundC: 3},
+		{Start: 1, End: 0},
+	}
+	if err := or.SetStrata(boundary); err != nil {
+		t.Fatalf("strata error: %v", err)
+	}
+	if or.Cost() != cp.Cost() {
+		t.Errorf("cost error: node at the start of the oldest slice: expecting %.3f, found %.3f", cp.Cost(), or.Cost())
+	}
+}
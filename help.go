@@ -41,7 +41,13 @@ file must have at least the following columns:
       The goegraphic position of each record is stored in these columns.
 
 Optionally it can include the column 'Catalog' for a reference of the catalog
-code (or any other record identifier) of each record.
+code (or any other record identifier) of each record, and the column
+'Uncertainty' (or 'coordinateUncertaintyInMeters') for the coordinate
+uncertainty of each record, in meters. Any other column is kept as an
+attribute of the records.
+
+Records from Darwin Core Archives and GBIF downloads can be added to the file
+with rec.in.
 	`,
 }
 
@@ -64,7 +70,65 @@ least the following columns:
     Terminal
       The name of the terminal taxon
 
+Optionally, it can include the following columns:
+
+    Length
+      The length of the branch of the node. By default, the length is 1.
+
+    Age
+      The age of the node. If all the nodes of a tree have an age, the tree
+      is dated, and the nodes without a length take its length from the
+      ages. Otherwise, the ages are calculated from the branch lengths
+      (the age of a node is the distance to the most distant terminal).
+
 The table must be sorted in a form that each node is read only after its
 ancestor was already readed.
 	`,
 }
+
+var rasterHelp = &cmdapp.Command{
+	UsageLine: "raster",
+	Short:     "raster file",
+	Long: `
+A raster file stores a rasterized dataset, so the same raster can be used by
+different commands (using the --raster option), without the need to repeat
+the raster options on each command. Raster files are created with r.make.
+The file has the following columns:
+
+    Kind
+      The kind of the row. It can be 'param' for the parameters used to
+      build the raster, 'pixel' for the pixels of the raster, and 'obs' and
+      'fill' for the observed and filled pixels of a taxon.
+
+    Key
+      The name of the parameter ('grid', 'columns', 'fill', 'fillDist',
+      'sparse', 'ranges', 'maps', 'bbox', 'mask', 'taxa', 'uncertObs' and
+      'maxUncert'), the bit of a pixel, or the name of a taxon.
+
+    Value
+      The value of the parameter, the pixel ID in the grid, or the pixels
+      of the taxon, encoded as a bitfield.
+	`,
+}
+
+var synonymsHelp = &cmdapp.Command{
+	UsageLine: "synonyms",
+	Short:     "synonyms file",
+	Long: `
+In evs the synonyms of the taxa are stored in an optional file called
+'synonyms.tab'. If the file exists, the taxa of the records, range polygons
+and presence maps are renamed to its accepted names, and terminals named
+with a synonym use the data of the accepted name. The file has the
+following columns:
+
+    Name
+      The accepted name of the taxon. This column can be also named
+      'Accepted'.
+
+    Synonym
+      A synonym of the taxon.
+
+Tx.check can be used to search for terminals without data, and to propose
+possible matches for its names.
+	`,
+}
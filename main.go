@@ -5,13 +5,17 @@
 package main
 
 import (
+	"flag"
 	"math/rand"
 	"os"
+	"path/filepath"
 	"runtime"
 	"time"
 
 	"github.com/js-arias/evs/biogeo"
 	"github.com/js-arias/evs/cmdapp"
+	"github.com/js-arias/evs/events"
+	"github.com/js-arias/evs/raster"
 	"github.com/js-arias/evs/tree"
 )
 
@@ -28,8 +32,19 @@ var (
 
 // raster flags
 var (
-	numCols int // -c|--columns
-	numFill int // -f|--fill
+	numCols    int     // -c|--columns
+	numFill    int     // -f|--fill
+	fillDist   float64 // --fillDist
+	gridType   string  // --grid
+	rasFile    string  // --raster
+	rangeFls   string  // --ranges
+	rangesName string  // --rangesName
+	mapsFile   string  // --maps
+	bboxStr    string  // --bbox
+	maskFile   string  // --mask
+	taxaFile   string  // --taxa
+	uncObs     bool    // --uncertObs
+	maxUnc     float64 // --maxUncert
 )
 
 func setRasterFlags(c *cmdapp.Command) {
@@ -37,6 +52,274 @@ func setRasterFlags(c *cmdapp.Command) {
 	c.Flag.IntVar(&numCols, "c", 360, "")
 	c.Flag.IntVar(&numFill, "fill", 2, "")
 	c.Flag.IntVar(&numFill, "f", 2, "")
+	c.Flag.Float64Var(&fillDist, "fillDist", 0, "")
+	c.Flag.StringVar(&gridType, "grid", raster.EquirectGrid, "")
+	c.Flag.StringVar(&rangeFls, "ranges", "", "")
+	c.Flag.StringVar(&rangesName, "rangesName", "", "")
+	c.Flag.StringVar(&mapsFile, "maps", "", "")
+	c.Flag.StringVar(&bboxStr, "bbox", "", "")
+	c.Flag.StringVar(&maskFile, "mask", "", "")
+	c.Flag.StringVar(&taxaFile, "taxa", "", "")
+	c.Flag.BoolVar(&uncObs, "uncertObs", false, "")
+	c.Flag.Float64Var(&maxUnc, "maxUncert", 0, "")
+}
+
+// loadRaster returns the raster stored in the file set with the --raster
+// flag, or, if no file is set, the raster of the records file using the
+// raster flags. The raster searches taxa using the synonyms file (if any).
+func loadRaster() (*raster.Raster, error) {
+	var r *raster.Raster
+	if len(rasFile) == 0 {
+		d, err := rasterData()
+		if err != nil {
+			return nil, err
+		}
+		r, err = rasterize(d)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		f, err := os.Open(rasFile)
+		if err != nil {
+			return nil, err
+		}
+		r, err = raster.Read(f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		r.File = rasFile
+	}
+	syn, err := loadSynonyms()
+	if err != nil {
+		return nil, err
+	}
+	r.Syns = syn
+	return r, nil
+}
+
+// rasterData returns the dataset to be rasterized: the records of the
+// records file, the range polygons of the GeoJSON file set with the
+// --ranges flag (with the taxon names of the property set with the
+// --rangesName flag), and the presence maps of the manifest set with the --maps
+// flag. If a ranges file or a manifest is set, the records file is
+// optional. Taxa are renamed using the synonyms file (if any), and the
+// data set is restricted with the --bbox, --mask, --taxa and --maxUncert
+// flags.
+func rasterData() (*biogeo.DataSet, error) {
+	d, err := loadData()
+	if err != nil {
+		if ((len(rangeFls) == 0) && (len(mapsFile) == 0)) || !os.IsNotExist(err) {
+			return nil, err
+		}
+		d = &biogeo.DataSet{Names: make(map[string]*biogeo.Taxon)}
+	}
+	if len(rangeFls) > 0 {
+		f, err := os.Open(rangeFls)
+		if err != nil {
+			return nil, err
+		}
+		rd, err := biogeo.ReadGeoJSON(f, rangesName)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		d.Merge(rd)
+	}
+	if len(mapsFile) > 0 {
+		f, err := os.Open(mapsFile)
+		if err != nil {
+			return nil, err
+		}
+		md, err := biogeo.ReadManifest(f, filepath.Dir(mapsFile))
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		d.Merge(md)
+	}
+	syn, err := loadSynonyms()
+	if err != nil {
+		return nil, err
+	}
+	d.Rename(syn)
+	return filterData(d, syn)
+}
+
+// filterData restricts a data set to the region defined by the --bbox and
+// --mask flags, and to the taxa listed in the file set with the --taxa
+// flag. The names in the list are replaced by its accepted names. If the
+// --maxUncert flag is set, the records with a larger uncertainty are
+// removed.
+func filterData(d *biogeo.DataSet, syn biogeo.Synonyms) (*biogeo.DataSet, error) {
+	if maxUnc > 0 {
+		d = d.FilterUncert(maxUnc)
+	}
+	if (len(bboxStr) > 0) || (len(maskFile) > 0) {
+		reg := biogeo.NewRegion()
+		if len(bboxStr) > 0 {
+			if err := reg.ParseBox(bboxStr); err != nil {
+				return nil, err
+			}
+		}
+		if len(maskFile) > 0 {
+			f, err := os.Open(maskFile)
+			if err != nil {
+				return nil, err
+			}
+			reg.Polys, err = biogeo.ReadPolygons(f)
+			f.Close()
+			if err != nil {
+				return nil, err
+			}
+		}
+		d = d.FilterRegion(reg)
+	}
+	if len(taxaFile) > 0 {
+		f, err := os.Open(taxaFile)
+		if err != nil {
+			return nil, err
+		}
+		names, err := biogeo.ReadTaxa(f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		for i, nm := range names {
+			names[i] = syn.Accepted(nm)
+		}
+		d = d.FilterTaxa(names)
+	}
+	return d, nil
+}
+
+// recParams returns the parameters used to read a reconstruction. Event and
+// raster flags that are not set in the command line take the value stored
+// in p (i.e. the parameters stored in the reconstruction file), so by
+// default a reconstruction is evaluated with the same parameters used to
+// build it.
+func recParams(c *cmdapp.Command, p *events.Params) *events.Params {
+	set := make(map[string]bool)
+	c.Flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	// isSet returns true if a flag is defined for the command, and set
+	// in the command line.
+	isSet := func(short, long string) bool {
+		if c.Flag.Lookup(short) == nil {
+			return false
+		}
+		return set[short] || set[long]
+	}
+	if !isSet("z", "size") {
+		szExtra = p.Size
+	}
+	if !isSet("sympSize", "sympSize") {
+		sympSize = p.SympSize
+	}
+	if !isSet("b", "brlen") {
+		brlen = p.UseLen
+	}
+	if !isSet("vic", "vic") {
+		VicCost = p.VicC
+	}
+	if !isSet("symp", "symp") {
+		SympCost = p.SympC
+	}
+	if !isSet("point", "point") {
+		PointCost = p.PointC
+	}
+	if !isSet("found", "found") {
+		FoundCost = p.FoundC
+	}
+	if !isSet("strata", "strata") {
+		strataFl = p.Strata
+	}
+	if !isSet("raster", "raster") {
+		rasFile = p.Raster
+	}
+	if !isSet("grid", "grid") {
+		gridType = p.Grid
+	}
+	if !isSet("c", "columns") {
+		numCols = p.Cols
+	}
+	if !isSet("f", "fill") {
+		numFill = p.Fill
+	}
+	if !isSet("fillDist", "fillDist") {
+		fillDist = p.FillDist
+	}
+	if !isSet("ranges", "ranges") {
+		rangeFls = p.Ranges
+	}
+	if !isSet("rangesName", "rangesName") {
+		rangesName = p.RangesName
+	}
+	if !isSet("maps", "maps") {
+		mapsFile = p.Maps
+	}
+	if !isSet("bbox", "bbox") {
+		bboxStr = p.BBox
+	}
+	if !isSet("mask", "mask") {
+		maskFile = p.Mask
+	}
+	if !isSet("taxa", "taxa") {
+		taxaFile = p.Taxa
+	}
+	if !isSet("uncertObs", "uncertObs") {
+		uncObs = p.UncertObs
+	}
+	if !isSet("maxUncert", "maxUncert") {
+		maxUnc = p.MaxUncert
+	}
+	return &events.Params{
+		Size:     szExtra,
+		SympSize: sympSize,
+		UseLen:   brlen,
+		VicC:     VicCost,
+		SympC:    SympCost,
+		PointC:   PointCost,
+		FoundC:   FoundCost,
+		Strata:   strataFl,
+		Raster:   rasFile,
+		Grid:     gridType,
+		Cols:     numCols,
+		Fill:     numFill,
+		FillDist: fillDist,
+		Ranges:   rangeFls,
+		Maps:     mapsFile,
+		BBox:     bboxStr,
+		Mask:     maskFile,
+		Taxa:     taxaFile,
+
+		RangesName: rangesName,
+
+		UncertObs: uncObs,
+		MaxUncert: maxUnc,
+	}
+}
+
+// rasterize creates a raster of a dataset using the raster flags.
+func rasterize(d *biogeo.DataSet) (*raster.Raster, error) {
+	g, err := raster.NewGrid(gridType, numCols)
+	if err != nil {
+		return nil, err
+	}
+	r := raster.RasterizeOpts(d, g, raster.Options{
+		Fill:      numFill,
+		Dist:      fillDist,
+		UncertObs: uncObs,
+	})
+	r.Ranges = rangeFls
+	r.RangesName = rangesName
+	r.Maps = mapsFile
+	r.BBox = bboxStr
+	r.Mask = maskFile
+	r.Taxa = taxaFile
+	r.MaxUncert = maxUnc
+	return r, nil
 }
 
 func main() {
@@ -45,15 +328,30 @@ func main() {
 		evEval,
 		evFlip,
 		evMap,
+		evTime,
 		evTree,
 		rBay,
+		rMake,
+		recClean,
+		recIn,
 		txLs,
+		trAge,
+		trCheck,
 		trIn,
 		trLs,
+		trOut,
+		trPrune,
+		trRename,
+		trRm,
+		trRoot,
+		trSub,
+		txCheck,
 
 		// help topics,
 		about,
+		rasterHelp,
 		recordsHelp,
+		synonymsHelp,
 		treesHelp,
 	}
 	runtime.GOMAXPROCS(runtime.NumCPU() * 2)
@@ -61,8 +359,10 @@ func main() {
 }
 
 const (
-	treeFileName = "trees.tab"
-	dataFileName = "records.tab"
+	treeFileName   = "trees.tab"
+	dataFileName   = "records.tab"
+	rasterFileName = "raster.tab"
+	synFileName    = "synonyms.tab"
 )
 
 func loadData() (*biogeo.DataSet, error) {
@@ -78,6 +378,19 @@ func loadData() (*biogeo.DataSet, error) {
 	return d, nil
 }
 
+// writeData writes a dataset into the records file.
+func writeData(d *biogeo.DataSet) error {
+	f, err := os.Create(dataFileName)
+	if err != nil {
+		return err
+	}
+	if err := d.Write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
 func loadTrees() ([]*tree.Tree, error) {
 	f, err := os.Open(treeFileName)
 	if err != nil {
@@ -91,6 +404,78 @@ func loadTrees() ([]*tree.Tree, error) {
 	return ts, nil
 }
 
+// writeTrees writes a set of trees into the trees file.
+func writeTrees(ts []*tree.Tree) error {
+	f, err := os.Create(treeFileName)
+	if err != nil {
+		return err
+	}
+	head := true
+	for _, t := range ts {
+		if err := t.Write(f, head); err != nil {
+			f.Close()
+			return err
+		}
+		head = false
+	}
+	return f.Close()
+}
+
+// findTree returns the index of the tree with a given ID, or -1 if the
+// tree is not found.
+func findTree(ts []*tree.Tree, id string) int {
+	for i, t := range ts {
+		if t.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// loadStrata returns the time slices of the stratification file set with
+// the --strata flag. If no file is set, it returns nil.
+func loadStrata() ([]events.Stratum, error) {
+	if len(strataFl) == 0 {
+		return nil, nil
+	}
+	f, err := os.Open(strataFl)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return events.ReadStrata(f)
+}
+
+// setStrata sets the stratification file, set with the --strata flag (or
+// stored in the reconstruction parameters), in a list of reconstructions.
+func setStrata(recs []*events.Recons) error {
+	st, err := loadStrata()
+	if err != nil {
+		return err
+	}
+	for _, rc := range recs {
+		if err := rc.SetStrata(st); err != nil {
+			return err
+		}
+		rc.StrataFile = strataFl
+	}
+	return nil
+}
+
+// loadSynonyms returns the synonym table of the synonyms file. If the
+// file does not exist, it returns an empty table.
+func loadSynonyms() (biogeo.Synonyms, error) {
+	f, err := os.Open(synFileName)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	return biogeo.ReadSynonyms(f)
+}
+
 func shuffle(v []int) {
 	for i, x := range v {
 		j := rand.Intn(len(v))
@@ -7,6 +7,7 @@ package main
 import (
 	"fmt"
 	"os"
+	"sort"
 
 	"github.com/js-arias/evs/cmdapp"
 	"github.com/js-arias/evs/raster"
@@ -57,17 +58,12 @@ func rBayRun(c *cmdapp.Command, args []string) {
 	}
 	defer geo.Close()
 	fmt.Fprintf(geo, "# 0.0\n")
-	var pxls []int
-	for y := 0; y < ((numCols / 2) + 1); y++ {
-		lat := 90 - ((float64(y) * ras.Resol) + (ras.Resol / 2))
-		for x := 0; x < numCols; x++ {
-			px := (y * numCols) + x
-			if _, ok := ras.Pixel[px]; ok {
-				pxls = append(pxls, px)
-				lon := ((float64(x) * ras.Resol) + (ras.Resol / 2)) - 180
-				fmt.Fprintf(geo, "%.4f %.4f\n", lat, lon)
-			}
-		}
+	pxls := make([]int, 0, len(ras.Pixels))
+	pxls = append(pxls, ras.Pixels...)
+	sort.Ints(pxls)
+	for _, px := range pxls {
+		cell := ras.Cell(ras.Pixel[px])
+		fmt.Fprintf(geo, "%.4f %.4f\n", cell.Lat, cell.Lon)
 	}
 
 	areas, err := os.Create(args[0] + ".areas.txt")
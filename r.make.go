@@ -0,0 +1,135 @@
+// Copyright (c) 2015, J. Salvador Arias <jsalarias@csnat.unt.edu.ar>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/js-arias/evs/cmdapp"
+)
+
+var rMake = &cmdapp.Command{
+	Run: rMakeRun,
+	UsageLine: `r.make [--bbox box] [-c|--columns number] [-f|--fill number]
+	[--fillDist number] [--grid name] [--maps file] [--mask file]
+	[--maxUncert number] [--ranges file] [--rangesName name]
+	[--taxa file] [--uncertObs] [-o|--output file]`,
+	Short: "create a raster file",
+	Long: `
+R.make rasterizes the current dataset, and stores the raster in a file, that
+can be used with the --raster option of the ev.* commands. By default the
+raster is stored in a file called 'raster.tab'.
+
+Options are:
+
+    --bbox box
+      If set, only the data inside the indicated bounding box will be used.
+      The box is defined as 'minLon,minLat,maxLon,maxLat'. If minLon is
+      greater than maxLon, the box crosses the antimeridian.
+
+    -c number
+    --column number
+      Set the number of columns in the raster. Default = 360 (i.e. a pixel
+      grid with 1x1 degrees.
+
+    -f number
+    --fill number
+      Set the number of pixels to fill around an observed pixel. Default = 2.
+
+    --fillDist number
+      If set, the fill will include all pixels with a center at the
+      indicated distance (in km) or less from a record, instead of a fixed
+      number of pixels. The distance is the great circle distance, so it
+      means the same at any latitude.
+
+    --grid name
+      Set the type of grid used for the raster. Valid values are:
+        equirect   an equirectangular grid in which each pixel has the same
+                   size in degrees.
+        equalarea  a cylindrical equal-area grid in which each pixel has
+                   the same area.
+        hex        a global grid of hexagons on an icosahedron, in which
+                   pixels have about the same area and shape, and the
+                   distance between neighbour pixels is about 360 / columns
+                   degrees. The fill is done by rings of neighbour pixels.
+      Default = equirect.
+
+    --maps file
+      Reads presence maps of the terminals from the ESRI ASCII grid files
+      listed in the indicated manifest file. The manifest is a tab
+      delimited file with the columns 'Name' (the name of the taxon),
+      'File' (the grid file, relative to the manifest), and optionally,
+      'Threshold' (the minimum value of an occupied cell; by default,
+      0.5). The pixels occupied in the maps are used as observed pixels of
+      the taxon, together with the pixels of the records (if any).
+
+    --mask file
+      If set, only the data inside the polygons of the indicated GeoJSON
+      file will be used.
+
+    --maxUncert number
+      If set, the records with a coordinate uncertainty greater than the
+      indicated value (in meters) will be ignored.
+
+    --ranges file
+      Reads range polygons of the terminals from the indicated GeoJSON
+      file. Each Polygon or MultiPolygon feature is assigned to the taxon
+      named by the 'name' property (or 'scientificName', 'binomial',
+      'sci_name' or 'species'). The pixels with a center inside the
+      polygons are used as observed pixels of the taxon, together with the
+      pixels of the records (if any).
+
+    --rangesName name
+      Sets the property of the features of the ranges file used as the
+      name of the taxon. By default, the first property found of 'name',
+      'scientificName', 'binomial', 'sci_name' or 'species' is used.
+
+    --taxa file
+      If set, only the taxa listed in the indicated file (a name per line)
+      will be used.
+
+    --uncertObs
+      If set, the pixels that intersect the uncertainty circle of a record
+      will be used as observed pixels. By default, they are only used as
+      filled pixels.
+
+    -o file
+    --output file
+      Set the output file. Default = raster.tab.
+	`,
+}
+
+func init() {
+	setRasterFlags(rMake)
+	rMake.Flag.StringVar(&outFile, "output", "", "")
+	rMake.Flag.StringVar(&outFile, "o", "", "")
+}
+
+func rMakeRun(c *cmdapp.Command, args []string) {
+	if len(outFile) == 0 {
+		outFile = rasterFileName
+	}
+	d, err := rasterData()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
+		os.Exit(1)
+	}
+	r, err := rasterize(d)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
+		os.Exit(1)
+	}
+	o, err := os.Create(outFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
+		os.Exit(1)
+	}
+	defer o.Close()
+	if err := r.Write(o); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
+		os.Exit(1)
+	}
+}
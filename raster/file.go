@@ -0,0 +1,287 @@
+// Copyright (c) 2015, J. Salvador Arias <jsalarias@csnat.unt.edu.ar>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package raster
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/js-arias/evs/bitfield"
+)
+
+// Raster file format.
+//
+// A raster is stored as a tab-delimited file with three columns: Kind, Key
+// and Value. Rows of kind "param" store the parameters used to build the
+// raster (grid, columns, fill, fillDist, sparse, ranges, maps, bbox, mask,
+// taxa, uncertObs and maxUncert), rows of kind "pixel" store the pixel of
+// each bit (key is the bit, value is the pixel), and rows of kind "obs" and
+// "fill" store the observed and filled pixels of each taxon (key is the
+// taxon name, value is the bitfield in its text encoding).
+
+// Row kinds of a raster file.
+const (
+	paramRow = "param"
+	pixelRow = "pixel"
+	obsRow   = "obs"
+	fillRow  = "fill"
+)
+
+// Write writes a raster as csv into an output stream.
+func (ras *Raster) Write(out io.Writer) error {
+	w := csv.NewWriter(out)
+	w.Comma = '\t'
+	w.UseCRLF = true
+	defer w.Flush()
+	err := w.Write([]string{"Kind", "Key", "Value"})
+	if err != nil {
+		return err
+	}
+	params := [][]string{
+		{paramRow, "grid", ras.Grid.Name()},
+		{paramRow, "columns", strconv.FormatInt(int64(ras.Cols), 10)},
+		{paramRow, "fill", strconv.FormatInt(int64(ras.Fill), 10)},
+		{paramRow, "fillDist", strconv.FormatFloat(ras.Dist, 'f', -1, 64)},
+		{paramRow, "sparse", strconv.FormatBool(ras.Sparse)},
+	}
+	if len(ras.Ranges) > 0 {
+		params = append(params, []string{paramRow, "ranges", ras.Ranges})
+	}
+	if len(ras.RangesName) > 0 {
+		params = append(params, []string{paramRow, "rangesName", ras.RangesName})
+	}
+	if len(ras.Maps) > 0 {
+		params = append(params, []string{paramRow, "maps", ras.Maps})
+	}
+	if len(ras.BBox) > 0 {
+		params = append(params, []string{paramRow, "bbox", ras.BBox})
+	}
+	if len(ras.Mask) > 0 {
+		params = append(params, []string{paramRow, "mask", ras.Mask})
+	}
+	if len(ras.Taxa) > 0 {
+		params = append(params, []string{paramRow, "taxa", ras.Taxa})
+	}
+	if ras.UncertObs {
+		params = append(params, []string{paramRow, "uncertObs", strconv.FormatBool(ras.UncertObs)})
+	}
+	if ras.MaxUncert > 0 {
+		params = append(params, []string{paramRow, "maxUncert", strconv.FormatFloat(ras.MaxUncert, 'f', -1, 64)})
+	}
+	for _, p := range params {
+		if err := w.Write(p); err != nil {
+			return err
+		}
+	}
+	for b, px := range ras.Pixels {
+		err := w.Write([]string{pixelRow, strconv.FormatInt(int64(b), 10), strconv.FormatInt(int64(px), 10)})
+		if err != nil {
+			return err
+		}
+	}
+	names := make([]string, 0, len(ras.Names))
+	for nm := range ras.Names {
+		names = append(names, nm)
+	}
+	sort.Strings(names)
+	for _, nm := range names {
+		t := ras.Names[nm]
+		obs, err := t.Obs.MarshalText()
+		if err != nil {
+			return err
+		}
+		if err := w.Write([]string{obsRow, t.Name, string(obs)}); err != nil {
+			return err
+		}
+		fill, err := t.Fill.MarshalText()
+		if err != nil {
+			return err
+		}
+		if err := w.Write([]string{fillRow, t.Name, string(fill)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Read reads a raster from an input stream in tsv format.
+func Read(in io.Reader) (*Raster, error) {
+	r := csv.NewReader(in)
+	r.Comma = '\t'
+	r.TrimLeadingSpace = true
+
+	// reads the file header
+	h, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("header (raster): %v", err)
+	}
+	kind := -1
+	key := -1
+	val := -1
+	for i, v := range h {
+		switch strings.ToLower(v) {
+		case "kind":
+			kind = i
+		case "key":
+			key = i
+		case "value":
+			val = i
+		}
+	}
+	if (kind < 0) || (key < 0) || (val < 0) {
+		return nil, errors.New("header (raster): incomplete header")
+	}
+
+	// reads the data
+	ras := &Raster{
+		Names: make(map[string]*Taxon),
+		Pixel: make(map[int]int),
+	}
+	gridName := EquirectGrid
+	for i := 1; ; i++ {
+		row, err := r.Read()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, fmt.Errorf("(raster) row %d: %v", i, err)
+		}
+		if lr := len(row); (lr <= kind) || (lr <= key) || (lr <= val) {
+			continue
+		}
+		switch strings.ToLower(row[kind]) {
+		case paramRow:
+			if err := ras.setParam(row[key], row[val]); err != nil {
+				return nil, fmt.Errorf("(raster) row %d: %v", i, err)
+			}
+			if strings.ToLower(row[key]) == "grid" {
+				gridName = row[val]
+			}
+		case pixelRow:
+			b, err := strconv.Atoi(row[key])
+			if err != nil {
+				return nil, fmt.Errorf("(raster) row %d, col %d: %v", i, key+1, err)
+			}
+			px, err := strconv.Atoi(row[val])
+			if err != nil {
+				return nil, fmt.Errorf("(raster) row %d, col %d: %v", i, val+1, err)
+			}
+			if b != len(ras.Pixels) {
+				return nil, fmt.Errorf("(raster) row %d: expecting bit %d, found %d", i, len(ras.Pixels), b)
+			}
+			if _, ok := ras.Pixel[px]; ok {
+				return nil, fmt.Errorf("(raster) row %d: pixel %d repeated", i, px)
+			}
+			ras.Pixel[px] = b
+			ras.Pixels = append(ras.Pixels, px)
+		case obsRow, fillRow:
+			nm := strings.Join(strings.Fields(row[key]), " ")
+			if len(nm) == 0 {
+				return nil, fmt.Errorf("(raster) row %d: empty taxon name", i)
+			}
+			s, err := bitfield.UnmarshalText([]byte(row[val]))
+			if err != nil {
+				return nil, fmt.Errorf("(raster) row %d, taxon %s: %v", i, nm, err)
+			}
+			t, ok := ras.Names[strings.ToLower(nm)]
+			if !ok {
+				t = &Taxon{Name: nm}
+				ras.Names[strings.ToLower(nm)] = t
+			}
+			if strings.ToLower(row[kind]) == obsRow {
+				t.Obs = s
+			} else {
+				t.Fill = s
+			}
+		}
+	}
+	if ras.Cols <= 0 {
+		return nil, errors.New("(raster): undefined number of columns")
+	}
+	ras.Grid, err = NewGrid(gridName, ras.Cols)
+	if err != nil {
+		return nil, fmt.Errorf("(raster): %v", err)
+	}
+	ras.Resol = 360 / float64(ras.Cols)
+	ras.Fields = bitfield.Fields(len(ras.Pixels))
+	for _, t := range ras.Names {
+		if (t.Obs == nil) || (t.Fill == nil) {
+			return nil, fmt.Errorf("(raster): taxon %s: incomplete data", t.Name)
+		}
+		if err := ras.checkSet(t.Obs); err != nil {
+			return nil, fmt.Errorf("(raster): taxon %s: %v", t.Name, err)
+		}
+		if err := ras.checkSet(t.Fill); err != nil {
+			return nil, fmt.Errorf("(raster): taxon %s: %v", t.Name, err)
+		}
+	}
+	return ras, nil
+}
+
+// setParam sets a raster parameter read from a raster file.
+func (ras *Raster) setParam(key, val string) error {
+	var err error
+	switch strings.ToLower(key) {
+	case "grid":
+		// the grid is built once the number of columns is known
+	case "columns", "cols":
+		ras.Cols, err = strconv.Atoi(val)
+	case "fill":
+		ras.Fill, err = strconv.Atoi(val)
+	case "filldist", "dist":
+		ras.Dist, err = strconv.ParseFloat(val, 64)
+	case "sparse":
+		ras.Sparse, err = strconv.ParseBool(val)
+	case "ranges":
+		ras.Ranges = val
+	case "rangesname":
+		ras.RangesName = val
+	case "maps":
+		ras.Maps = val
+	case "bbox":
+		ras.BBox = val
+	case "mask":
+		ras.Mask = val
+	case "taxa":
+		ras.Taxa = val
+	case "uncertobs":
+		ras.UncertObs, err = strconv.ParseBool(val)
+	case "maxuncert":
+		ras.MaxUncert, err = strconv.ParseFloat(val, 64)
+	default:
+		return fmt.Errorf("unknown parameter %s", key)
+	}
+	return err
+}
+
+// checkSet returns an error if a bitfield read from a raster file is not
+// valid for the raster.
+func (ras *Raster) checkSet(s bitfield.Set) error {
+	switch f := s.(type) {
+	case bitfield.Bitfield:
+		if ras.Sparse {
+			return errors.New("dense bitfield in a sparse raster")
+		}
+		if len(f) != ras.Fields {
+			return fmt.Errorf("expecting %d fields, found %d", ras.Fields, len(f))
+		}
+	case *bitfield.Sparse:
+		if !ras.Sparse {
+			return errors.New("sparse bitfield in a dense raster")
+		}
+	}
+	var err error
+	s.ForEach(func(b int) {
+		if (err == nil) && (b >= len(ras.Pixels)) {
+			err = fmt.Errorf("bit %d without pixel", b)
+		}
+	})
+	return err
+}
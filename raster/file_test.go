@@ -0,0 +1,51 @@
+// Copyright (c) 2015, J. Salvador Arias <jsalarias@csnat.unt.edu.ar>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package raster
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/js-arias/evs/biogeo"
+)
+
+func TestReadWrite(t *testing.T) {
+	d := &biogeo.DataSet{
+		Ls: []*biogeo.Taxon{
+			{Name: "Aus bus", Recs: []biogeo.GeoRef{{Lon: -65.2, Lat: -26.8}, {Lon: -64.1, Lat: -27.5}}},
+			{Name: "Aus cus", Recs: []biogeo.GeoRef{{Lon: -58.4, Lat: -34.6}}},
+			{Name: "Dus fus", Recs: []biogeo.GeoRef{{Lon: 150.3, Lat: -33.9}}},
+		},
+	}
+	for _, g := range []Grid{NewEquirect(360), NewHex(180)} {
+		ras := RasterizeGrid(d, g, 1)
+		var buf bytes.Buffer
+		if err := ras.Write(&buf); err != nil {
+			t.Fatalf("%s: write error: %v", g.Name(), err)
+		}
+		nr, err := Read(&buf)
+		if err != nil {
+			t.Fatalf("%s: read error: %v", g.Name(), err)
+		}
+		if (nr.Grid.Name() != g.Name()) || (nr.Cols != ras.Cols) || (nr.Fill != ras.Fill) || (nr.Fields != ras.Fields) {
+			t.Errorf("%s: parameters error: found grid %s, cols %d, fill %d, fields %d", g.Name(), nr.Grid.Name(), nr.Cols, nr.Fill, nr.Fields)
+		}
+		for px, b := range ras.Pixel {
+			if nb, ok := nr.Pixel[px]; !ok || (nb != b) {
+				t.Errorf("%s: pixel error: pixel %d: expecting bit %d, found %d", g.Name(), px, b, nb)
+			}
+		}
+		for _, tx := range d.Ls {
+			a, b := ras.Taxon(tx.Name), nr.Taxon(tx.Name)
+			if b == nil {
+				t.Errorf("%s: taxon %s not found", g.Name(), tx.Name)
+				continue
+			}
+			if (b.Name != a.Name) || !b.Obs.Equal(a.Obs) || !b.Fill.Equal(a.Fill) {
+				t.Errorf("%s: taxon %s: different data", g.Name(), tx.Name)
+			}
+		}
+	}
+}
@@ -0,0 +1,251 @@
+// Copyright (c) 2015, J. Salvador Arias <jsalarias@csnat.unt.edu.ar>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package raster
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/js-arias/evs/biogeo"
+)
+
+// A Grid is a discretization of the Earth surface into pixels.
+type Grid interface {
+	// Name returns the name of the grid type.
+	Name() string
+
+	// Cols returns the number of columns of the grid.
+	Cols() int
+
+	// Pixel returns the pixel that contains a geographic point.
+	Pixel(lon, lat float64) int
+
+	// Center returns the geographic coordinates of the center of a
+	// pixel.
+	Center(px int) (lon, lat float64)
+
+	// Bounds returns the bounding box of a pixel. If the pixel crosses
+	// the antimeridian, minLon will be greater than maxLon.
+	Bounds(px int) (minLon, minLat, maxLon, maxLat float64)
+
+	// Area returns the area of a pixel, in square km.
+	Area(px int) float64
+
+	// Fill calls fn for each pixel in the neighbourhood of size f (in
+	// pixels) around pixel px, including px.
+	Fill(px, f int, fn func(px int))
+}
+
+// Grid types.
+const (
+	EquirectGrid  = "equirect"
+	EqualAreaGrid = "equalarea"
+	HexGrid       = "hex"
+)
+
+// NewGrid returns a new grid of the indicated type, with the given number
+// of columns.
+func NewGrid(name string, cols int) (Grid, error) {
+	if cols <= 0 {
+		return nil, fmt.Errorf("raster: invalid number of columns: %d", cols)
+	}
+	switch strings.ToLower(name) {
+	case "", EquirectGrid:
+		return NewEquirect(cols), nil
+	case EqualAreaGrid:
+		return NewEqualArea(cols), nil
+	case HexGrid:
+		return NewHex(cols), nil
+	}
+	return nil, fmt.Errorf("raster: unknown grid type: %s", name)
+}
+
+// An Equirect is an equirectangular grid, in which each pixel has the same
+// size in degrees of longitude and latitude.
+type Equirect struct {
+	cols  int
+	resol float64
+}
+
+// NewEquirect returns a new equirectangular grid.
+func NewEquirect(cols int) *Equirect {
+	return &Equirect{
+		cols:  cols,
+		resol: 360 / float64(cols),
+	}
+}
+
+// Name returns the name of the grid type.
+func (g *Equirect) Name() string {
+	return EquirectGrid
+}
+
+// Cols returns the number of columns of the grid.
+func (g *Equirect) Cols() int {
+	return g.cols
+}
+
+// Pixel returns the pixel that contains a geographic point.
+func (g *Equirect) Pixel(lon, lat float64) int {
+	c := int((180 + lon) / g.resol)
+	r := int((90 - lat) / g.resol)
+	return (r * g.cols) + c
+}
+
+// Center returns the geographic coordinates of the center of a pixel.
+func (g *Equirect) Center(px int) (lon, lat float64) {
+	c := px % g.cols
+	r := px / g.cols
+	lon = ((float64(c) + 0.5) * g.resol) - 180
+	lat = 90 - ((float64(r) + 0.5) * g.resol)
+	return lon, lat
+}
+
+// Bounds returns the bounding box of a pixel.
+func (g *Equirect) Bounds(px int) (minLon, minLat, maxLon, maxLat float64) {
+	c := px % g.cols
+	r := px / g.cols
+	minLon = (float64(c) * g.resol) - 180
+	maxLon = minLon + g.resol
+	maxLat = 90 - (float64(r) * g.resol)
+	minLat = maxLat - g.resol
+	if minLat < -90 {
+		minLat = -90
+	}
+	return minLon, minLat, maxLon, maxLat
+}
+
+// Area returns the area of a pixel, in square km.
+func (g *Equirect) Area(px int) float64 {
+	_, minLat, _, maxLat := g.Bounds(px)
+	return bandArea(minLat, maxLat, g.resol)
+}
+
+// Fill calls fn for each pixel in a square window of f pixels around px.
+func (g *Equirect) Fill(px, f int, fn func(px int)) {
+	fillWindow(px, f, g.cols, -1, fn)
+}
+
+// An EqualArea is a cylindrical equal-area (Lambert) grid, in which each
+// pixel has the same size in degrees of longitude, and the same area. The
+// rows are equally spaced in the sine of the latitude, and the number of
+// rows is set in such a way that pixels at the equator are approximately
+// square.
+type EqualArea struct {
+	cols  int
+	rows  int
+	resol float64
+}
+
+// NewEqualArea returns a new cylindrical equal-area grid.
+func NewEqualArea(cols int) *EqualArea {
+	rows := int(math.Floor((float64(cols) / math.Pi) + 0.5))
+	if rows < 1 {
+		rows = 1
+	}
+	return &EqualArea{
+		cols:  cols,
+		rows:  rows,
+		resol: 360 / float64(cols),
+	}
+}
+
+// Name returns the name of the grid type.
+func (g *EqualArea) Name() string {
+	return EqualAreaGrid
+}
+
+// Cols returns the number of columns of the grid.
+func (g *EqualArea) Cols() int {
+	return g.cols
+}
+
+// Rows returns the number of rows of the grid.
+func (g *EqualArea) Rows() int {
+	return g.rows
+}
+
+// Pixel returns the pixel that contains a geographic point.
+func (g *EqualArea) Pixel(lon, lat float64) int {
+	c := int((180 + lon) / g.resol)
+	if c >= g.cols {
+		c = g.cols - 1
+	}
+	y := (1 - math.Sin(lat*math.Pi/180)) / 2
+	r := int(y * float64(g.rows))
+	if r >= g.rows {
+		r = g.rows - 1
+	}
+	return (r * g.cols) + c
+}
+
+// Center returns the geographic coordinates of the center of a pixel.
+func (g *EqualArea) Center(px int) (lon, lat float64) {
+	c := px % g.cols
+	r := px / g.cols
+	lon = ((float64(c) + 0.5) * g.resol) - 180
+	y := (float64(r) + 0.5) / float64(g.rows)
+	lat = math.Asin(1-(2*y)) * 180 / math.Pi
+	return lon, lat
+}
+
+// Bounds returns the bounding box of a pixel.
+func (g *EqualArea) Bounds(px int) (minLon, minLat, maxLon, maxLat float64) {
+	c := px % g.cols
+	r := px / g.cols
+	minLon = (float64(c) * g.resol) - 180
+	maxLon = minLon + g.resol
+	top := float64(r) / float64(g.rows)
+	bot := float64(r+1) / float64(g.rows)
+	maxLat = math.Asin(1-(2*top)) * 180 / math.Pi
+	minLat = math.Asin(1-(2*bot)) * 180 / math.Pi
+	return minLon, minLat, maxLon, maxLat
+}
+
+// Area returns the area of a pixel, in square km.
+func (g *EqualArea) Area(px int) float64 {
+	return 4 * math.Pi * biogeo.EarthRadius * biogeo.EarthRadius / float64(g.rows*g.cols)
+}
+
+// Fill calls fn for each pixel in a square window of f pixels around px.
+func (g *EqualArea) Fill(px, f int, fn func(px int)) {
+	fillWindow(px, f, g.cols, g.rows, fn)
+}
+
+// bandArea returns the area, in square km, of a section of a latitude band
+// with the indicated width in degrees of longitude.
+func bandArea(minLat, maxLat, width float64) float64 {
+	s := math.Sin(maxLat*math.Pi/180) - math.Sin(minLat*math.Pi/180)
+	return biogeo.EarthRadius * biogeo.EarthRadius * (width * math.Pi / 180) * s
+}
+
+// fillWindow calls fn for each pixel in a square window of f pixels around
+// px, on a grid with the given number of columns and rows. Columns wrap
+// around the antimeridian. If rows is negative, the number of rows is not
+// checked.
+func fillWindow(px, f, cols, rows int, fn func(px int)) {
+	c := px % cols
+	r := px / cols
+	for i := -f; i <= f; i++ {
+		x := c - i
+		if x < 0 {
+			x += cols
+		}
+		if x >= cols {
+			x -= cols
+		}
+		for j := -f; j <= f; j++ {
+			y := r - j
+			if y < 0 {
+				continue
+			}
+			if (rows >= 0) && (y >= rows) {
+				continue
+			}
+			fn((y * cols) + x)
+		}
+	}
+}
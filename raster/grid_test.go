@@ -0,0 +1,105 @@
+// Copyright (c) 2015, J. Salvador Arias <jsalarias@csnat.unt.edu.ar>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package raster
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/js-arias/evs/biogeo"
+)
+
+func TestHexGrid(t *testing.T) {
+	g := NewHex(60)
+	if n := (10 * g.freq * g.freq) + 2; g.Len() != n {
+		t.Fatalf("Hex error: expecting %d cells, found %d", n, g.Len())
+	}
+	pent := 0
+	for px := 0; px < g.Len(); px++ {
+		nb := g.Neighbors(px)
+		switch len(nb) {
+		case 5:
+			pent++
+		case 6:
+		default:
+			t.Errorf("Hex error: cell %d with %d neighbours", px, len(nb))
+		}
+	}
+	if pent != 12 {
+		t.Errorf("Hex error: expecting %d pentagons, found %d", 12, pent)
+	}
+
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 500; i++ {
+		lon := (rnd.Float64() * 360) - 180
+		lat := (rnd.Float64() * 180) - 90
+		p := toVec(lon, lat)
+		best, d := -1, -2.0
+		for px, v := range g.pts {
+			if nd := v.dot(p); nd > d {
+				best, d = px, nd
+			}
+		}
+		if px := g.Pixel(lon, lat); (px != best) && (g.pts[px].dot(p) < d-1e-12) {
+			t.Errorf("Pixel error: point %.3f %.3f: expecting %d, found %d", lon, lat, best, px)
+		}
+	}
+
+	px := g.Pixel(-60, -30)
+	n := 0
+	g.Fill(px, 2, func(int) { n++ })
+	if n != 19 {
+		t.Errorf("Fill error: expecting %d cells, found %d", 19, n)
+	}
+}
+
+func TestEqualAreaGrid(t *testing.T) {
+	g := NewEqualArea(360)
+	if g.Rows() != 115 {
+		t.Errorf("EqualArea error: expecting %d rows, found %d", 115, g.Rows())
+	}
+	if px := g.Pixel(180, -90); px != (g.Rows()*g.Cols())-1 {
+		t.Errorf("Pixel error: expecting %d, found %d", (g.Rows()*g.Cols())-1, px)
+	}
+	if px := g.Pixel(-180, 90); px != 0 {
+		t.Errorf("Pixel error: expecting %d, found %d", 0, px)
+	}
+}
+
+func TestGridArea(t *testing.T) {
+	earth := 4 * math.Pi * biogeo.EarthRadius * biogeo.EarthRadius
+	eq := NewEquirect(36)
+	ea := NewEqualArea(36)
+	hx := NewHex(36)
+	grids := []struct {
+		g     Grid
+		cells int
+	}{
+		{eq, 36 * 18},
+		{ea, 36 * ea.Rows()},
+		{hx, hx.Len()},
+	}
+	for _, tc := range grids {
+		var a float64
+		for px := 0; px < tc.cells; px++ {
+			a += tc.g.Area(px)
+			lon, lat := tc.g.Center(px)
+			if tc.g.Pixel(lon, lat) != px {
+				t.Errorf("%s: Center error: center of %d in pixel %d", tc.g.Name(), px, tc.g.Pixel(lon, lat))
+			}
+			minLon, minLat, maxLon, maxLat := tc.g.Bounds(px)
+			if (lat < minLat) || (lat > maxLat) {
+				t.Errorf("%s: Bounds error: pixel %d: latitude %.3f outside [%.3f, %.3f]", tc.g.Name(), px, lat, minLat, maxLat)
+			}
+			if (minLon <= maxLon) && ((lon < minLon) || (lon > maxLon)) {
+				t.Errorf("%s: Bounds error: pixel %d: longitude %.3f outside [%.3f, %.3f]", tc.g.Name(), px, lon, minLon, maxLon)
+			}
+		}
+		if math.Abs(a-earth)/earth > 1e-6 {
+			t.Errorf("%s: Area error: expecting %.0f, found %.0f", tc.g.Name(), earth, a)
+		}
+	}
+}
@@ -0,0 +1,471 @@
+// Copyright (c) 2015, J. Salvador Arias <jsalarias@csnat.unt.edu.ar>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package raster
+
+import (
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/js-arias/evs/biogeo"
+)
+
+// icosaArc is the arc (in degrees) of an edge of the icosahedron.
+const icosaArc = 63.434948822922
+
+// A Hex is a discrete global grid of hexagonal cells (and 12 pentagons)
+// built on an icosahedron. Each face of the icosahedron is subdivided in a
+// triangular lattice, and the cells are the Voronoi regions of the lattice
+// vertices projected onto the sphere, so all cells have approximately the
+// same size and shape, and each cell has six neighbours (five in the
+// pentagons).
+//
+// The pixel of a cell is the index of its center.
+type Hex struct {
+	cols  int
+	freq  int         // number of subdivisions of each icosahedron edge
+	pts   []vec       // cell centers
+	nbs   [][6]int32  // neighbours of each cell (-1 if undefined)
+	faces [20][3]int  // icosahedron faces (indices of corners)
+	corn  [12]vec     // icosahedron corners
+	lat   [20][]int32 // lattice vertices of each face
+}
+
+// vec is a point in 3D space.
+type vec struct {
+	x, y, z float64
+}
+
+func (v vec) add(o vec) vec {
+	return vec{v.x + o.x, v.y + o.y, v.z + o.z}
+}
+
+func (v vec) sub(o vec) vec {
+	return vec{v.x - o.x, v.y - o.y, v.z - o.z}
+}
+
+func (v vec) scale(s float64) vec {
+	return vec{v.x * s, v.y * s, v.z * s}
+}
+
+func (v vec) dot(o vec) float64 {
+	return (v.x * o.x) + (v.y * o.y) + (v.z * o.z)
+}
+
+func (v vec) cross(o vec) vec {
+	return vec{
+		(v.y * o.z) - (v.z * o.y),
+		(v.z * o.x) - (v.x * o.z),
+		(v.x * o.y) - (v.y * o.x),
+	}
+}
+
+func (v vec) unit() vec {
+	return v.scale(1 / math.Sqrt(v.dot(v)))
+}
+
+// toVec returns the unit vector of a geographic point.
+func toVec(lon, lat float64) vec {
+	lo := lon * math.Pi / 180
+	la := lat * math.Pi / 180
+	return vec{
+		math.Cos(la) * math.Cos(lo),
+		math.Cos(la) * math.Sin(lo),
+		math.Sin(la),
+	}
+}
+
+// toGeo returns the geographic point of a unit vector.
+func toGeo(v vec) (lon, lat float64) {
+	lat = math.Asin(math.Max(-1, math.Min(1, v.z))) * 180 / math.Pi
+	lon = math.Atan2(v.y, v.x) * 180 / math.Pi
+	return lon, lat
+}
+
+// hexCache stores the hexagonal grids already built, as building a grid
+// is expensive.
+var hexCache = struct {
+	sync.Mutex
+	m map[int]*Hex
+}{m: make(map[int]*Hex)}
+
+// NewHex returns a new hexagonal grid. The number of columns sets the
+// approximate distance between the centers of neighbour cells, as in an
+// equirectangular grid with the same number of columns at the equator
+// (i.e. 360 / cols degrees).
+func NewHex(cols int) *Hex {
+	hexCache.Lock()
+	defer hexCache.Unlock()
+	if g, ok := hexCache.m[cols]; ok {
+		return g
+	}
+	freq := int(math.Floor((icosaArc * float64(cols) / 360) + 0.5))
+	if freq < 1 {
+		freq = 1
+	}
+	g := &Hex{cols: cols, freq: freq}
+	g.build()
+	hexCache.m[cols] = g
+	return g
+}
+
+// Name returns the name of the grid type.
+func (g *Hex) Name() string {
+	return HexGrid
+}
+
+// Cols returns the number of columns used to define the grid.
+func (g *Hex) Cols() int {
+	return g.cols
+}
+
+// Len returns the number of cells of the grid.
+func (g *Hex) Len() int {
+	return len(g.pts)
+}
+
+// Neighbors returns the neighbours of a cell.
+func (g *Hex) Neighbors(px int) []int {
+	var nb []int
+	for _, v := range g.nbs[px] {
+		if v < 0 {
+			continue
+		}
+		nb = append(nb, int(v))
+	}
+	return nb
+}
+
+// Pixel returns the pixel that contains a geographic point.
+func (g *Hex) Pixel(lon, lat float64) int {
+	p := toVec(lon, lat)
+
+	// the face that contains the point
+	face := 0
+	best := math.Inf(-1)
+	for i, f := range g.faces {
+		c := g.corn[f[0]].add(g.corn[f[1]]).add(g.corn[f[2]])
+		if d := c.dot(p); d > best {
+			best = d
+			face = i
+		}
+	}
+
+	// projects the point into the face, and rounds it to the closest
+	// lattice vertex
+	a, b, c := g.corn[g.faces[face][0]], g.corn[g.faces[face][1]], g.corn[g.faces[face][2]]
+	nrm := b.sub(a).cross(c.sub(a))
+	q := p.scale(nrm.dot(a) / nrm.dot(p))
+	u, v := barycentric(q, a, b, c)
+	i := int(math.Floor((u * float64(g.freq)) + 0.5))
+	j := int(math.Floor((v * float64(g.freq)) + 0.5))
+	if i < 0 {
+		i = 0
+	}
+	if j < 0 {
+		j = 0
+	}
+	if i+j > g.freq {
+		if i > j {
+			i = g.freq - j
+		} else {
+			j = g.freq - i
+		}
+	}
+	px := int(g.lat[face][latIndex(i, j, g.freq)])
+
+	// walks to the closest cell center
+	for {
+		next := px
+		d := g.pts[px].dot(p)
+		for _, nb := range g.nbs[px] {
+			if nb < 0 {
+				continue
+			}
+			if nd := g.pts[nb].dot(p); nd > d {
+				d = nd
+				next = int(nb)
+			}
+		}
+		if next == px {
+			return px
+		}
+		px = next
+	}
+}
+
+// Fill calls fn for each pixel at f or less rings of neighbours around px.
+func (g *Hex) Fill(px, f int, fn func(px int)) {
+	if (px < 0) || (px >= len(g.pts)) {
+		return
+	}
+	seen := map[int]bool{px: true}
+	ring := []int{px}
+	fn(px)
+	for i := 0; i < f; i++ {
+		var next []int
+		for _, v := range ring {
+			for _, nb := range g.nbs[v] {
+				if nb < 0 {
+					continue
+				}
+				if seen[int(nb)] {
+					continue
+				}
+				seen[int(nb)] = true
+				next = append(next, int(nb))
+				fn(int(nb))
+			}
+		}
+		ring = next
+	}
+}
+
+// Center returns the geographic coordinates of the center of a cell.
+func (g *Hex) Center(px int) (lon, lat float64) {
+	return toGeo(g.pts[px])
+}
+
+// Bounds returns the bounding box of a cell, as defined by its corners.
+func (g *Hex) Bounds(px int) (minLon, minLat, maxLon, maxLat float64) {
+	if (g.Pixel(0, 90) == px) || (g.Pixel(0, -90) == px) {
+		minLat, maxLat = 90, -90
+		for _, c := range g.corners(px) {
+			_, lat := toGeo(c)
+			minLat = math.Min(minLat, lat)
+			maxLat = math.Max(maxLat, lat)
+		}
+		if g.Pixel(0, 90) == px {
+			maxLat = 90
+		} else {
+			minLat = -90
+		}
+		return -180, minLat, 180, maxLat
+	}
+	lon0, _ := toGeo(g.pts[px])
+	minLat, maxLat = 90, -90
+	minD, maxD := 180.0, -180.0
+	for _, c := range g.corners(px) {
+		lon, lat := toGeo(c)
+		minLat = math.Min(minLat, lat)
+		maxLat = math.Max(maxLat, lat)
+		d := wrapLon(lon - lon0)
+		minD = math.Min(minD, d)
+		maxD = math.Max(maxD, d)
+	}
+	return wrapLon(lon0 + minD), minLat, wrapLon(lon0 + maxD), maxLat
+}
+
+// Area returns the area of a cell, in square km.
+func (g *Hex) Area(px int) float64 {
+	p := g.pts[px]
+	cs := g.corners(px)
+	var a float64
+	for i := range cs {
+		a += sphTriangle(p, cs[i], cs[(i+1)%len(cs)])
+	}
+	return a * biogeo.EarthRadius * biogeo.EarthRadius
+}
+
+// corners returns the corners of a cell, sorted around its center. The
+// corners are the centers of the triangles formed by the cell center and
+// each pair of adjacent neighbours.
+func (g *Hex) corners(px int) []vec {
+	p := g.pts[px]
+	nb := g.Neighbors(px)
+	var cs []vec
+	for i := range nb {
+		for j := i + 1; j < len(nb); j++ {
+			adj := false
+			for _, v := range g.nbs[nb[i]] {
+				if int(v) == nb[j] {
+					adj = true
+					break
+				}
+			}
+			if !adj {
+				continue
+			}
+			cs = append(cs, p.add(g.pts[nb[i]]).add(g.pts[nb[j]]).unit())
+		}
+	}
+
+	// a local basis on the tangent plane of the center
+	e1 := p.cross(vec{0, 0, 1})
+	if e1.dot(e1) < 1e-12 {
+		e1 = p.cross(vec{1, 0, 0})
+	}
+	e1 = e1.unit()
+	e2 := p.cross(e1)
+	sort.Slice(cs, func(i, j int) bool {
+		return math.Atan2(cs[i].dot(e2), cs[i].dot(e1)) < math.Atan2(cs[j].dot(e2), cs[j].dot(e1))
+	})
+	return cs
+}
+
+// sphTriangle returns the area of a spherical triangle on the unit sphere.
+func sphTriangle(a, b, c vec) float64 {
+	num := math.Abs(a.dot(b.cross(c)))
+	den := 1 + a.dot(b) + b.dot(c) + c.dot(a)
+	return 2 * math.Atan2(num, den)
+}
+
+// wrapLon returns a longitude in the range (-180, 180].
+func wrapLon(lon float64) float64 {
+	for lon > 180 {
+		lon -= 360
+	}
+	for lon <= -180 {
+		lon += 360
+	}
+	return lon
+}
+
+// barycentric returns the barycentric coordinates of q (in the plane of
+// the triangle abc) relative to a and b.
+func barycentric(q, a, b, c vec) (u, v float64) {
+	v0 := a.sub(c)
+	v1 := b.sub(c)
+	v2 := q.sub(c)
+	d00 := v0.dot(v0)
+	d01 := v0.dot(v1)
+	d11 := v1.dot(v1)
+	d20 := v2.dot(v0)
+	d21 := v2.dot(v1)
+	den := (d00 * d11) - (d01 * d01)
+	u = ((d11 * d20) - (d01 * d21)) / den
+	v = ((d00 * d21) - (d01 * d20)) / den
+	return u, v
+}
+
+// latIndex returns the index of the lattice vertex (i, j) in a face with
+// the indicated frequency.
+func latIndex(i, j, freq int) int {
+	// row i has freq-i+1 vertices
+	return (i * (freq + 1)) - ((i * (i - 1)) / 2) + j
+}
+
+// vertexKey identifies a lattice vertex shared between faces.
+type vertexKey struct {
+	a, b, w int
+}
+
+// build builds the grid.
+func (g *Hex) build() {
+	// icosahedron corners
+	phi := (1 + math.Sqrt(5)) / 2
+	cs := []vec{
+		{-1, phi, 0}, {1, phi, 0}, {-1, -phi, 0}, {1, -phi, 0},
+		{0, -1, phi}, {0, 1, phi}, {0, -1, -phi}, {0, 1, -phi},
+		{phi, 0, -1}, {phi, 0, 1}, {-phi, 0, -1}, {-phi, 0, 1},
+	}
+	for i, c := range cs {
+		g.corn[i] = c.unit()
+	}
+
+	// faces are the triples of mutually adjacent corners
+	edge := g.corn[0].dot(g.corn[1])
+	adj := func(i, j int) bool {
+		return math.Abs(g.corn[i].dot(g.corn[j])-edge) < 1e-9
+	}
+	nf := 0
+	for i := 0; i < 12; i++ {
+		for j := i + 1; j < 12; j++ {
+			if !adj(i, j) {
+				continue
+			}
+			for k := j + 1; k < 12; k++ {
+				if adj(i, k) && adj(j, k) {
+					g.faces[nf] = [3]int{i, j, k}
+					nf++
+				}
+			}
+		}
+	}
+
+	// lattice vertices
+	n := g.freq
+	shared := make(map[vertexKey]int32)
+	for f, fc := range g.faces {
+		g.lat[f] = make([]int32, latIndex(n, 0, n)+1)
+		a, b, c := g.corn[fc[0]], g.corn[fc[1]], g.corn[fc[2]]
+		for i := 0; i <= n; i++ {
+			for j := 0; i+j <= n; j++ {
+				k := n - i - j
+				key, isShared := sharedKey(fc, i, j, k, n)
+				if isShared {
+					if id, ok := shared[key]; ok {
+						g.lat[f][latIndex(i, j, n)] = id
+						continue
+					}
+				}
+				p := a.scale(float64(i)).add(b.scale(float64(j))).add(c.scale(float64(k))).unit()
+				id := int32(len(g.pts))
+				g.pts = append(g.pts, p)
+				if isShared {
+					shared[key] = id
+				}
+				g.lat[f][latIndex(i, j, n)] = id
+			}
+		}
+	}
+
+	// neighbours
+	g.nbs = make([][6]int32, len(g.pts))
+	for i := range g.nbs {
+		for j := range g.nbs[i] {
+			g.nbs[i][j] = -1
+		}
+	}
+	link := func(x, y int32) {
+		for j, v := range g.nbs[x] {
+			if v == y {
+				return
+			}
+			if v < 0 {
+				g.nbs[x][j] = y
+				return
+			}
+		}
+	}
+	steps := [][2]int{{1, 0}, {-1, 0}, {0, 1}, {0, -1}, {1, -1}, {-1, 1}}
+	for f := range g.faces {
+		for i := 0; i <= n; i++ {
+			for j := 0; i+j <= n; j++ {
+				x := g.lat[f][latIndex(i, j, n)]
+				for _, s := range steps {
+					ni, nj := i+s[0], j+s[1]
+					if (ni < 0) || (nj < 0) || (ni+nj > n) {
+						continue
+					}
+					link(x, g.lat[f][latIndex(ni, nj, n)])
+				}
+			}
+		}
+	}
+}
+
+// sharedKey returns the key of a lattice vertex of a face, if the vertex is
+// at a corner or at an edge of the face.
+func sharedKey(fc [3]int, i, j, k, n int) (vertexKey, bool) {
+	w := [3]int{i, j, k}
+	var on []int
+	for x := range w {
+		if w[x] > 0 {
+			on = append(on, x)
+		}
+	}
+	switch len(on) {
+	case 1:
+		return vertexKey{a: fc[on[0]], b: -1}, true
+	case 2:
+		p, q := on[0], on[1]
+		if fc[p] > fc[q] {
+			p, q = q, p
+		}
+		return vertexKey{a: fc[p], b: fc[q], w: w[p]}, true
+	}
+	return vertexKey{}, false
+}
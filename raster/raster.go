@@ -5,6 +5,7 @@
 package raster
 
 import (
+	"math"
 	"strings"
 
 	"github.com/js-arias/evs/biogeo"
@@ -15,8 +16,8 @@ import (
 type Taxon struct {
 	Name string
 	// rasterized data
-	Obs  bitfield.Bitfield
-	Fill bitfield.Bitfield
+	Obs  bitfield.Set
+	Fill bitfield.Set
 }
 
 // A Raster is a rasterized data set.
@@ -24,90 +25,480 @@ type Raster struct {
 	Names  map[string]*Taxon // a map of name (in lower caps) to taxon
 	Fields int               // number of fields in the raster bitfield
 	Pixel  map[int]int       // map of pixel:bit
+	Pixels []int             // map of bit:pixel
 	Cols   int               // number of columns
 	Fill   int               // fill of the raster
 	Resol  float64           // resolution of the raster
+	Sparse bool              // if true, use sparse bitfields
+	Grid   Grid              // grid used for the pixels
+	Dist   float64           // fill distance (in km)
+	Ranges string            // file of the range polygons (if any)
+	Maps   string            // manifest of the presence maps (if any)
+	BBox   string            // bounding box of the data (if any)
+	Mask   string            // file of the mask polygons (if any)
+	Taxa   string            // file of the list of taxa (if any)
+	Syns   biogeo.Synonyms   // synonyms used to search a taxon (if any)
+	File   string            // file from which the raster was read (if any)
+
+	// property of the taxon names in the ranges file (if any)
+	RangesName string
+
+	// uncertainty of the records
+	UncertObs bool    // if true, pixels in the uncertainty are observed
+	MaxUncert float64 // maximum uncertainty of the records, in m (if any)
+
+	// index of pixel centers used for distance fill
+	centers []center
+	bands   map[int][]int // map of latitude band:bits
+	bandSz  float64       // size of a latitude band (in degrees)
 }
 
-// Rasterize creates a new raster from a given dataset.
+// A center is the center of a pixel.
+type center struct {
+	lon, lat float64
+}
+
+// Limits for the use of sparse bitfields in a raster. Sparse bitfields are
+// only used on rasters with a large number of pixels, and when the expected
+// fraction of filled pixels of each taxon is small.
+const (
+	sparseMinCells = 1 << 16
+	sparseDensity  = 1.0 / 32
+)
+
+// Rasterize creates a new raster from a given dataset, using an
+// equirectangular grid.
 func Rasterize(d *biogeo.DataSet, cols, fill int) *Raster {
+	return RasterizeGrid(d, NewEquirect(cols), fill)
+}
+
+// RasterizeGrid creates a new raster from a given dataset, using the
+// indicated grid. Each observed pixel is expanded by fill pixels.
+func RasterizeGrid(d *biogeo.DataSet, grid Grid, fill int) *Raster {
+	return RasterizeOpts(d, grid, Options{Fill: fill})
+}
+
+// RasterizeDist creates a new raster from a given dataset, using the
+// indicated grid. The fill of each taxon includes all the occupied pixels
+// whose center is at dist km or less from a record of the taxon.
+func RasterizeDist(d *biogeo.DataSet, grid Grid, dist float64) *Raster {
+	return RasterizeOpts(d, grid, Options{Dist: dist})
+}
+
+// Options are the options used to rasterize a dataset.
+type Options struct {
+	// Fill is the number of pixels filled around each observed pixel.
+	Fill int
+
+	// If Dist is greater than 0, the fill of each taxon includes all the
+	// occupied pixels whose center is at Dist km or less from a record
+	// of the taxon, instead of a fixed number of pixels.
+	Dist float64
+
+	// The pixels that intersect the uncertainty circle of a record are
+	// filled. If UncertObs is true, they are also observed.
+	UncertObs bool
+}
+
+// RasterizeOpts creates a new raster from a given dataset, using the
+// indicated grid and options.
+func RasterizeOpts(d *biogeo.DataSet, grid Grid, opt Options) *Raster {
+	fill, dist := opt.Fill, opt.Dist
+	if dist > 0 {
+		fill = 0
+	}
 	ras := &Raster{
-		Names: make(map[string]*Taxon),
-		Pixel: make(map[int]int),
-		Cols:  cols,
-		Fill:  fill,
-		Resol: 360 / float64(cols),
+		Names:     make(map[string]*Taxon),
+		Pixel:     make(map[int]int),
+		Cols:      grid.Cols(),
+		Fill:      fill,
+		Resol:     360 / float64(grid.Cols()),
+		Grid:      grid,
+		Dist:      dist,
+		UncertObs: opt.UncertObs,
 	}
 	cells := 0
-	for _, t := range d.Ls {
+	add := func(px int) {
+		if _, ok := ras.Pixel[px]; ok {
+			return
+		}
+		ras.Pixel[px] = cells
+		ras.Pixels = append(ras.Pixels, px)
+		cells++
+	}
+	// pixels of the range polygons and presence maps of each taxon, and
+	// of the uncertainty circles of its records
+	regs := make([][]int, len(d.Ls))
+	uncs := make([][]int, len(d.Ls))
+	occ := make([]int, len(d.Ls))
+	// taxa with data in the raster
+	var ls []int
+	for i, t := range d.Ls {
 		for _, g := range t.Recs {
-			c := int((180 + g.Lon) / ras.Resol)
-			r := int((90 - g.Lat) / ras.Resol)
-			px := (r * ras.Cols) + c
-			if _, ok := ras.Pixel[px]; ok {
-				continue
+			add(grid.Pixel(g.Lon, g.Lat))
+			if g.Uncert > 0 {
+				uncs[i] = append(uncs[i], ras.circlePixels(g.Lon, g.Lat, g.Uncert/1000)...)
 			}
-			ras.Pixel[px] = cells
-			cells++
+		}
+		for _, p := range t.Polys {
+			regs[i] = append(regs[i], ras.polygonPixels(p)...)
+		}
+		for _, m := range t.Maps {
+			regs[i] = append(regs[i], ras.presencePixels(m)...)
+		}
+		if d.Region != nil {
+			// removes the pixels outside the region of the data set
+			regs[i] = inRegion(d.Region, grid, regs[i])
+			uncs[i] = inRegion(d.Region, grid, uncs[i])
+		}
+		if (len(t.Recs) == 0) && (len(regs[i]) == 0) {
+			// all the pixels of the taxon are outside the
+			// region
+			continue
+		}
+		ls = append(ls, i)
+		for _, px := range regs[i] {
+			add(px)
+		}
+		for _, px := range uncs[i] {
+			add(px)
+		}
+		occ[i] = len(t.Recs) + len(regs[i])
+		if ras.UncertObs {
+			occ[i] += len(uncs[i])
 		}
 	}
-	ras.Fields = cells / bitfield.BitsPerField
-	if (ras.Fields * bitfield.BitsPerField) != cells {
-		ras.Fields++
+	ras.Fields = bitfield.Fields(cells)
+	if dist > 0 {
+		ras.indexCenters(cells)
+		fill = int(math.Ceil(dist / kmPerDegree / ras.Resol))
 	}
+	var used []int
+	for _, i := range ls {
+		used = append(used, occ[i])
+	}
+	ras.Sparse = useSparse(used, cells, fill)
 	tc := make(chan *Taxon)
-	for _, t := range d.Ls {
-		go ras.rasterize(t, tc)
+	for _, i := range ls {
+		go ras.rasterize(d.Ls[i], regs[i], uncs[i], tc)
 	}
-	for _ = range d.Ls {
+	for _ = range ls {
 		t := <-tc
 		ras.Names[strings.ToLower(t.Name)] = t
 	}
 	return ras
 }
 
-// rasterize creates the raster of a given taxon.
-func (ras *Raster) rasterize(tx *biogeo.Taxon, tc chan *Taxon) {
+// useSparse returns true if the expected occupancy of the taxa in a raster
+// with the indicated number of cells is low enough to use sparse bitfields.
+// Occ is the number of records (or occupied pixels) of each taxon.
+func useSparse(occ []int, cells, fill int) bool {
+	if (cells < sparseMinCells) || (len(occ) == 0) {
+		return false
+	}
+	win := ((2 * fill) + 1) * ((2 * fill) + 1)
+	sum := 0
+	for _, o := range occ {
+		n := o * win
+		if n > cells {
+			n = cells
+		}
+		sum += n
+	}
+	return float64(sum)/float64(cells*len(occ)) < sparseDensity
+}
+
+// NewSet returns a new empty bitfield set for the raster, using a sparse
+// or a dense bitfield as defined during rasterization.
+func (ras *Raster) NewSet() bitfield.Set {
+	if ras.Sparse {
+		return bitfield.NewSparse()
+	}
+	return make(bitfield.Bitfield, ras.Fields)
+}
+
+// rasterize creates the raster of a given taxon. Regs are the pixels
+// inside the range polygons and presence maps of the taxon, and uncs are
+// the pixels that intersect the uncertainty circles of its records.
+func (ras *Raster) rasterize(tx *biogeo.Taxon, regs, uncs []int, tc chan *Taxon) {
 	t := &Taxon{
 		Name: tx.Name,
-		Obs:  make(bitfield.Bitfield, ras.Fields),
-		Fill: make(bitfield.Bitfield, ras.Fields),
+		Obs:  ras.NewSet(),
+		Fill: ras.NewSet(),
 	}
 	for _, g := range tx.Recs {
-		c := int((180 + g.Lon) / ras.Resol)
-		r := int((90 - g.Lat) / ras.Resol)
-		px := (r * ras.Cols) + c
-		b := ras.Pixel[px]
-		if t.Obs.IsOn(b) {
+		ras.putOn(t, ras.Grid.Pixel(g.Lon, g.Lat), g.Lon, g.Lat)
+	}
+	for _, px := range regs {
+		lon, lat := ras.Grid.Center(px)
+		ras.putOn(t, px, lon, lat)
+	}
+	for _, px := range uncs {
+		if ras.UncertObs {
+			lon, lat := ras.Grid.Center(px)
+			ras.putOn(t, px, lon, lat)
 			continue
 		}
+		t.Fill.PutOn(ras.Pixel[px])
+	}
+	tc <- t
+}
+
+// putOn sets as observed a pixel of a taxon, from a point (a record, or
+// the center of a pixel inside a range polygon or a presence map) in that
+// pixel, and fills the pixels around it.
+func (ras *Raster) putOn(t *Taxon, px int, lon, lat float64) {
+	b := ras.Pixel[px]
+	if ras.Dist > 0 {
 		t.Obs.PutOn(b)
-		for i := -ras.Fill; i <= ras.Fill; i++ {
-			x := c - i
-			if x < 0 {
-				x += ras.Cols
+		t.Fill.PutOn(b)
+		ras.fillDist(lon, lat, t.Fill)
+		return
+	}
+	if t.Obs.IsOn(b) {
+		return
+	}
+	t.Obs.PutOn(b)
+	ras.Grid.Fill(px, ras.Fill, func(fp int) {
+		fb, ok := ras.Pixel[fp]
+		if !ok {
+			return
+		}
+		t.Fill.PutOn(fb)
+	})
+}
+
+// inRegion returns the pixels of pxs with a center inside a region. The
+// pixels are filtered in place.
+func inRegion(reg *biogeo.Region, grid Grid, pxs []int) []int {
+	in := pxs[:0]
+	for _, px := range pxs {
+		if reg.Contains(grid.Center(px)) {
+			in = append(in, px)
+		}
+	}
+	return in
+}
+
+// polygonPixels returns the pixels of the grid with a center inside a
+// polygon. The pixels are searched by sampling the bounding box of the
+// polygon at half the resolution of the raster. If no pixel center is
+// inside the polygon (i.e. the polygon is smaller than a pixel), it returns
+// the pixel that contains the center of the bounding box of the polygon.
+func (ras *Raster) polygonPixels(p biogeo.Polygon) []int {
+	if (len(p) == 0) || (len(p[0]) == 0) {
+		return nil
+	}
+	minLon, minLat, maxLon, maxLat := p.Bounds()
+	step := ras.Resol / 2
+	seen := make(map[int]bool)
+	var pxs []int
+	for lat := minLat; lat <= maxLat+step; lat += step {
+		y := clampLat(lat)
+		for lon := minLon; lon <= maxLon+step; lon += step {
+			x := clampLon(lon)
+			px := ras.Grid.Pixel(x, y)
+			if seen[px] {
+				continue
 			}
-			if x >= ras.Cols {
-				x -= ras.Cols
+			seen[px] = true
+			if cl, ct := ras.Grid.Center(px); p.Contains(cl, ct) {
+				pxs = append(pxs, px)
 			}
-			for j := -ras.Fill; j <= ras.Fill; j++ {
-				y := r - j
-				if y < 0 {
+		}
+	}
+	if len(pxs) == 0 {
+		pxs = append(pxs, ras.Grid.Pixel(clampLon((minLon+maxLon)/2), clampLat((minLat+maxLat)/2)))
+	}
+	return pxs
+}
+
+// presencePixels returns the pixels of the grid that are occupied in a
+// presence map. If the cells of the map are smaller than the pixels, a
+// pixel is occupied if it contains the center of an occupied cell. If the
+// cells are larger, a pixel is occupied if its center is inside an occupied
+// cell (the cell is sampled at half the resolution of the raster).
+func (ras *Raster) presencePixels(m *biogeo.Presence) []int {
+	seen := make(map[int]bool)
+	var pxs []int
+	add := func(lon, lat float64) int {
+		px := ras.Grid.Pixel(clampLon(lon), clampLat(lat))
+		if !seen[px] {
+			seen[px] = true
+			pxs = append(pxs, px)
+		}
+		return px
+	}
+	step := ras.Resol / 2
+	m.Cells.ForEach(func(c int) {
+		minLon, minLat, maxLon, maxLat := m.Bounds(c)
+		if m.Size <= ras.Resol {
+			add(minLon+(m.Size/2), minLat+(m.Size/2))
+			return
+		}
+		for lat := minLat + (step / 2); lat < maxLat; lat += step {
+			for lon := minLon + (step / 2); lon < maxLon; lon += step {
+				px := ras.Grid.Pixel(clampLon(lon), clampLat(lat))
+				if seen[px] {
 					continue
 				}
-				fp := (y * ras.Cols) + x
-				fb, ok := ras.Pixel[fp]
-				if !ok {
+				cl, ct := ras.Grid.Center(px)
+				if (cl < minLon) || (cl >= maxLon) || (ct < minLat) || (ct >= maxLat) {
 					continue
 				}
-				t.Fill.PutOn(fb)
+				add(cl, ct)
+			}
+		}
+	})
+	return pxs
+}
+
+// circlePixels returns the pixels of the grid that intersect a circle of
+// radius r (in km) around a point. The pixels are searched by sampling the
+// bounding box of the circle at half the resolution of the raster.
+func (ras *Raster) circlePixels(lon, lat, r float64) []int {
+	deg := r / kmPerDegree
+	step := ras.Resol / 2
+	px := ras.Grid.Pixel(lon, lat)
+	seen := map[int]bool{px: true}
+	pxs := []int{px}
+	for y := lat - deg - step; y <= lat+deg+step; y += step {
+		cy := clampLat(y)
+		// the longitude span of the circle at the band
+		span := 180.0
+		if c := math.Cos(math.Min(math.Abs(cy)+step, 90) * math.Pi / 180); c > 0 {
+			span = math.Min(deg/c+step, 180)
+		}
+		for x := lon - span; x <= lon+span; x += step {
+			cx := x
+			if cx < biogeo.MinLon {
+				cx += 360
+			} else if cx > biogeo.MaxLon {
+				cx -= 360
+			}
+			px := ras.Grid.Pixel(clampLon(cx), cy)
+			if seen[px] {
+				continue
+			}
+			seen[px] = true
+			if ras.pixelDist(px, lon, lat) <= r {
+				pxs = append(pxs, px)
 			}
 		}
 	}
-	tc <- t
+	return pxs
+}
+
+// pixelDist returns the distance (in km) from a point to the nearest point
+// of the bounding box of a pixel.
+func (ras *Raster) pixelDist(px int, lon, lat float64) float64 {
+	minLon, minLat, maxLon, maxLat := ras.Grid.Bounds(px)
+	nLat := math.Max(math.Min(lat, maxLat), minLat)
+	if (lon >= minLon) && (lon <= maxLon) {
+		return biogeo.Distance(lon, lat, lon, nLat)
+	}
+	return math.Min(biogeo.Distance(lon, lat, minLon, nLat), biogeo.Distance(lon, lat, maxLon, nLat))
 }
 
-// Taxon returns a taxon for a given name.
+// clampLon returns a longitude inside the valid range of the grids.
+func clampLon(lon float64) float64 {
+	return math.Max(math.Min(lon, biogeo.MaxLon-1e-9), biogeo.MinLon)
+}
+
+// clampLat returns a latitude inside the valid range of the grids.
+func clampLat(lat float64) float64 {
+	return math.Max(math.Min(lat, biogeo.MaxLat), biogeo.MinLat+1e-9)
+}
+
+// kmPerDegree is the length of a degree of a great circle, in km.
+const kmPerDegree = 2 * math.Pi * biogeo.EarthRadius / 360
+
+// indexCenters stores the center of each occupied pixel, indexed by
+// latitude bands of about the size of the fill distance.
+func (ras *Raster) indexCenters(cells int) {
+	ras.centers = make([]center, cells)
+	ras.bands = make(map[int][]int)
+	ras.bandSz = ras.Dist / kmPerDegree
+	if ras.bandSz < ras.Resol {
+		ras.bandSz = ras.Resol
+	}
+	for px, b := range ras.Pixel {
+		lon, lat := ras.Grid.Center(px)
+		ras.centers[b] = center{lon: lon, lat: lat}
+		band := int(math.Floor((lat + 90) / ras.bandSz))
+		ras.bands[band] = append(ras.bands[band], b)
+	}
+}
+
+// fillDist sets as on in f all pixels with a center at a distance less than
+// or equal to the fill distance from a given point. As the search is made
+// on latitude bands, it works across the antimeridian and over the poles.
+func (ras *Raster) fillDist(lon, lat float64, f bitfield.Set) {
+	deg := ras.Dist / kmPerDegree
+	first := int(math.Floor((lat - deg + 90) / ras.bandSz))
+	last := int(math.Floor((lat + deg + 90) / ras.bandSz))
+	for band := first; band <= last; band++ {
+		for _, b := range ras.bands[band] {
+			c := ras.centers[b]
+			if biogeo.Distance(lon, lat, c.lon, c.lat) <= ras.Dist {
+				f.PutOn(b)
+			}
+		}
+	}
+}
+
+// A Cell is the geographic description of a pixel of a raster.
+type Cell struct {
+	Bit    int     // bit of the pixel in the raster bitfields
+	Pixel  int     // pixel ID in the raster grid
+	Lon    float64 // longitude of the center
+	Lat    float64 // latitude of the center
+	MinLon float64 // bounding box
+	MinLat float64
+	MaxLon float64
+	MaxLat float64
+	Area   float64 // area in square km
+}
+
+// Cell returns the geographic description of a given bit of the raster.
+func (ras *Raster) Cell(b int) Cell {
+	px := ras.Pixels[b]
+	c := Cell{
+		Bit:   b,
+		Pixel: px,
+		Area:  ras.Grid.Area(px),
+	}
+	c.Lon, c.Lat = ras.Grid.Center(px)
+	c.MinLon, c.MinLat, c.MaxLon, c.MaxLat = ras.Grid.Bounds(px)
+	return c
+}
+
+// Cells returns the geographic description of each on bit of a bitfield
+// of the raster (e.g. the observed or filled pixels of a taxon or a
+// reconstructed node).
+func (ras *Raster) Cells(f bitfield.Set) []Cell {
+	cs := make([]Cell, 0, f.Count())
+	f.ForEach(func(b int) {
+		cs = append(cs, ras.Cell(b))
+	})
+	return cs
+}
+
+// Area returns the total area, in square km, of the on bits of a bitfield
+// of the raster.
+func (ras *Raster) Area(f bitfield.Set) float64 {
+	var a float64
+	f.ForEach(func(b int) {
+		a += ras.Grid.Area(ras.Pixels[b])
+	})
+	return a
+}
+
+// Taxon returns a taxon for a given name. If the name is not found, and the
+// raster has a synonym table, it returns the taxon of the accepted name.
 func (r *Raster) Taxon(name string) *Taxon {
-	return r.Names[strings.ToLower(name)]
+	if t, ok := r.Names[strings.ToLower(name)]; ok {
+		return t
+	}
+	return r.Names[strings.ToLower(r.Syns.Accepted(name))]
 }
@@ -0,0 +1,188 @@
+// Copyright (c) 2015, J. Salvador Arias <jsalarias@csnat.unt.edu.ar>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package raster
+
+import (
+	"testing"
+
+	"github.com/js-arias/evs/biogeo"
+	"github.com/js-arias/evs/bitfield"
+)
+
+func TestRasterizeDist(t *testing.T) {
+	d := &biogeo.DataSet{
+		Ls: []*biogeo.Taxon{
+			{Name: "a", Recs: []biogeo.GeoRef{{Lon: 179.6, Lat: 0.5}}},
+			{Name: "b", Recs: []biogeo.GeoRef{{Lon: -179.5, Lat: 0.5}}},
+			{Name: "c", Recs: []biogeo.GeoRef{{Lon: 179.6, Lat: 10.5}}},
+			{Name: "d", Recs: []biogeo.GeoRef{{Lon: 0.5, Lat: 89.5}}},
+			{Name: "e", Recs: []biogeo.GeoRef{{Lon: 180, Lat: 89.5}}},
+		},
+	}
+	ras := RasterizeDist(d, NewEquirect(360), 300)
+	tests := []struct {
+		a, b string
+		near bool
+	}{
+		{"a", "b", true},  // across the antimeridian
+		{"a", "c", false}, // about 1100 km apart
+		{"d", "e", true},  // across the north pole
+	}
+	for _, tc := range tests {
+		a, b := ras.Taxon(tc.a), ras.Taxon(tc.b)
+		if near := b.Obs.Common(a.Fill) > 0; near != tc.near {
+			t.Errorf("fill error: %s in fill of %s: expecting %v, found %v", tc.b, tc.a, tc.near, near)
+		}
+	}
+}
+
+func TestRasterizePolygon(t *testing.T) {
+	sq := biogeo.Polygon{
+		{{-70, -30}, {-60, -30}, {-60, -20}, {-70, -20}, {-70, -30}},
+		{{-66, -26}, {-64, -26}, {-64, -24}, {-66, -24}, {-66, -26}}, // hole
+	}
+	d := &biogeo.DataSet{
+		Ls: []*biogeo.Taxon{
+			{Name: "a", Polys: []biogeo.Polygon{sq}},
+			{Name: "b", Recs: []biogeo.GeoRef{{Lon: -65.5, Lat: -25.5}}, Polys: []biogeo.Polygon{
+				{{{10.1, 10.1}, {10.2, 10.1}, {10.2, 10.2}, {10.1, 10.1}}}, // smaller than a pixel
+			}},
+			// the first vertex is in a different pixel than the
+			// polygon
+			{Name: "c", Polys: []biogeo.Polygon{
+				{{{10.9, 12.1}, {11.4, 12.1}, {11.4, 12.4}, {10.9, 12.1}}},
+			}},
+		},
+	}
+	ras := RasterizeGrid(d, NewEquirect(360), 0)
+	a := ras.Taxon("a")
+	if n := a.Obs.Count(); n != 96 {
+		t.Errorf("polygon error: expecting 96 pixels, found %d", n)
+	}
+	b := ras.Taxon("b")
+	if n := b.Obs.Count(); n != 2 {
+		t.Errorf("polygon error: expecting 2 pixels, found %d", n)
+	}
+	if a.Obs.Common(b.Obs) != 0 {
+		t.Errorf("polygon error: pixel in a hole of the polygon")
+	}
+	c := ras.Taxon("c")
+	if (c == nil) || (c.Obs.Count() != 1) {
+		t.Fatalf("polygon error: expecting 1 pixel of c")
+	}
+	want := ras.Grid.Pixel(11.15, 12.25)
+	c.Obs.ForEach(func(b int) {
+		if ras.Pixels[b] != want {
+			t.Errorf("polygon error: expecting pixel %d, found %d", want, ras.Pixels[b])
+		}
+	})
+}
+
+func TestRasterizeRegion(t *testing.T) {
+	d := &biogeo.DataSet{
+		Ls: []*biogeo.Taxon{
+			// the bounding box of the polygon overlaps the region,
+			// but its pixel centers are outside
+			{Name: "a", Polys: []biogeo.Polygon{
+				{{{-50.4, -20.9}, {-48.6, -20.9}, {-48.6, -20.1}, {-50.4, -20.1}, {-50.4, -20.9}}},
+			}},
+			{Name: "b", Recs: []biogeo.GeoRef{{Lon: -65.5, Lat: -25.5}}},
+		},
+	}
+	r := biogeo.NewRegion()
+	if err := r.ParseBox("-80,-40,-50,-10"); err != nil {
+		t.Fatalf("bbox error: %v", err)
+	}
+	nd := d.FilterRegion(r)
+	if nd.Taxon("a") == nil {
+		t.Fatalf("filter error: expecting polygon of a")
+	}
+	ras := RasterizeGrid(nd, NewEquirect(360), 0)
+	if a := ras.Taxon("a"); a != nil {
+		t.Errorf("region error: taxon a with %d pixels outside the region", a.Obs.Count())
+	}
+	if b := ras.Taxon("b"); (b == nil) || (b.Obs.Count() != 1) {
+		t.Errorf("region error: expecting 1 pixel of b")
+	}
+}
+
+func TestRasterizePresence(t *testing.T) {
+	// a 2x2 map of cells of 5 degrees with a single occupied cell
+	coarse := &biogeo.Presence{Cols: 2, Rows: 2, MinLon: -70, MinLat: -30, Size: 5, Cells: bitfield.New(4)}
+	coarse.Cells.PutOn(1)
+	// a 20x20 map of cells of 0.25 degrees with all cells occupied
+	fine := &biogeo.Presence{Cols: 20, Rows: 20, MinLon: 10, MinLat: 10, Size: 0.25, Cells: bitfield.New(400)}
+	for i := 0; i < 400; i++ {
+		fine.Cells.PutOn(i)
+	}
+	d := &biogeo.DataSet{
+		Ls: []*biogeo.Taxon{
+			{Name: "a", Maps: []*biogeo.Presence{coarse}},
+			{Name: "b", Maps: []*biogeo.Presence{fine}},
+		},
+	}
+	ras := RasterizeGrid(d, NewEquirect(360), 0)
+	if n := ras.Taxon("a").Obs.Count(); n != 25 {
+		t.Errorf("presence error: expecting 25 pixels, found %d", n)
+	}
+	for _, c := range ras.Cells(ras.Taxon("a").Obs) {
+		if (c.Lon < -65) || (c.Lon > -60) || (c.Lat < -25) || (c.Lat > -20) {
+			t.Errorf("presence error: pixel %d outside occupied cell", c.Pixel)
+		}
+	}
+	if n := ras.Taxon("b").Obs.Count(); n != 25 {
+		t.Errorf("presence error: expecting 25 pixels, found %d", n)
+	}
+}
+
+func TestRasterizeUncert(t *testing.T) {
+	d := &biogeo.DataSet{
+		Ls: []*biogeo.Taxon{
+			{Name: "a", Recs: []biogeo.GeoRef{{Lon: -65.5, Lat: -25.5, Uncert: 200000}}},
+		},
+	}
+	g := NewEquirect(360)
+	ras := RasterizeOpts(d, g, Options{})
+	a := ras.Taxon("a")
+	if n := a.Obs.Count(); n != 1 {
+		t.Errorf("uncertainty error: expecting 1 observed pixel, found %d", n)
+	}
+	nf := a.Fill.Count()
+	if nf <= 1 {
+		t.Fatalf("uncertainty error: expecting filled pixels, found %d", nf)
+	}
+	tests := []struct {
+		lon, lat float64
+		in       bool
+	}{
+		{-65.5, -24.5, true},
+		{-65.5, -22.5, false}, // nearest point at about 280 km
+		{-67.5, -25.5, true},
+	}
+	for _, tc := range tests {
+		b, ok := ras.Pixel[g.Pixel(tc.lon, tc.lat)]
+		if in := ok && a.Fill.IsOn(b); in != tc.in {
+			t.Errorf("uncertainty error: point %.1f %.1f: expecting %v, found %v", tc.lon, tc.lat, tc.in, in)
+		}
+	}
+
+	ras = RasterizeOpts(d, g, Options{UncertObs: true})
+	if n := ras.Taxon("a").Obs.Count(); n != nf {
+		t.Errorf("uncertainty error: expecting %d observed pixels, found %d", nf, n)
+	}
+
+	// the uncertainty is restricted to the region of the data set
+	r := biogeo.NewRegion()
+	if err := r.ParseBox("-66,-30,-60,-20"); err != nil {
+		t.Fatalf("bbox error: %v", err)
+	}
+	ras = RasterizeOpts(d.FilterRegion(r), g, Options{UncertObs: true})
+	if n := ras.Taxon("a").Obs.Count(); (n <= 1) || (n >= nf) {
+		t.Errorf("uncertainty error: expecting less than %d observed pixels, found %d", nf, n)
+	}
+	if _, ok := ras.Pixel[g.Pixel(-67.5, -25.5)]; ok {
+		t.Errorf("uncertainty error: pixel outside the region")
+	}
+}
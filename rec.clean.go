@@ -0,0 +1,170 @@
+// Copyright (c) 2015, J. Salvador Arias <jsalarias@csnat.unt.edu.ar>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/js-arias/evs/biogeo"
+	"github.com/js-arias/evs/cmdapp"
+)
+
+var recClean = &cmdapp.Command{
+	Run: recCleanRun,
+	UsageLine: `rec.clean [--dup=false] [--dupResol degrees] [--equal=false]
+	[-i|--input file] [-o|--output file] [--outlier number]
+	[--outlierMin number] [--precision number] [-r|--report file]
+	[--zero=false]`,
+	Short: "clean occurrence records",
+	Long: `
+Rec.clean reads the records of the 'records.tab' file, and removes the
+records flagged by a set of cleaning tests. The cleaned records are written
+to the standard output, and the flagged records are written in a report file
+with the following columns:
+	Name		Name of the taxon
+	Longitude	Longitude of the record
+	Latitude	Latitude of the record
+	Catalog		Catalog code of the record
+	Test		The test that flagged the record
+
+Each record is flagged only by the first test that fails, in the order:
+zero, equal, precision, duplicate, and outlier.
+
+Options are:
+
+    --dup
+      If true, records of a taxon with the same coordinates will be
+      removed. Default = true.
+
+    --dupResol degrees
+      If set, records of a taxon in the same cell of an equirectangular
+      grid with pixels of the indicated size (in degrees) will be removed.
+
+    --equal
+      If true, records with the same value for latitude and longitude will
+      be removed. Default = true.
+
+    -i file
+    --input file
+      Reads the records from the indicated file, instead of 'records.tab'.
+
+    -o file
+    --output file
+      Set the output file, instead of the standard output.
+
+    --outlier number
+      If set, records with a distance from the centroid of the taxon
+      greater than the median distance plus the indicated number of
+      (scaled) median absolute deviations will be removed.
+
+    --outlierMin number
+      Set the minimum number of records of a taxon to search for
+      outliers. Default = 5.
+
+    --precision number
+      If set, records in which the longitude or latitude has less than the
+      indicated number of decimals will be removed. Trailing zeros are not
+      counted (e.g. -34.600 has a single decimal), as they are not stored
+      in the records file.
+
+    -r file
+    --report file
+      Set the name of the report file. Default = report.tab.
+
+    --zero
+      If true, records at the coordinates 0, 0 will be removed.
+      Default = true.
+	`,
+}
+
+// cleaning flags
+var (
+	cleanOpts  = biogeo.DefaultCleanOptions()
+	reportFile string // -r|--report
+)
+
+func init() {
+	recClean.Flag.BoolVar(&cleanOpts.Dup, "dup", cleanOpts.Dup, "")
+	recClean.Flag.Float64Var(&cleanOpts.DupResol, "dupResol", 0, "")
+	recClean.Flag.BoolVar(&cleanOpts.Zero, "zero", cleanOpts.Zero, "")
+	recClean.Flag.BoolVar(&cleanOpts.Equal, "equal", cleanOpts.Equal, "")
+	recClean.Flag.Float64Var(&cleanOpts.Outlier, "outlier", 0, "")
+	recClean.Flag.IntVar(&cleanOpts.OutlierMin, "outlierMin", cleanOpts.OutlierMin, "")
+	recClean.Flag.IntVar(&cleanOpts.Precision, "precision", 0, "")
+	recClean.Flag.StringVar(&inFile, "input", "", "")
+	recClean.Flag.StringVar(&inFile, "i", "", "")
+	recClean.Flag.StringVar(&outFile, "output", "", "")
+	recClean.Flag.StringVar(&outFile, "o", "", "")
+	recClean.Flag.StringVar(&reportFile, "report", "", "")
+	recClean.Flag.StringVar(&reportFile, "r", "", "")
+}
+
+func recCleanRun(c *cmdapp.Command, args []string) {
+	name := dataFileName
+	if len(inFile) > 0 {
+		name = inFile
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
+		os.Exit(1)
+	}
+	d, err := biogeo.Read(f)
+	f.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
+		os.Exit(1)
+	}
+	nd, iss := biogeo.Clean(d, cleanOpts)
+
+	o := os.Stdout
+	if len(outFile) > 0 {
+		o, err = os.Create(outFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
+			os.Exit(1)
+		}
+		defer o.Close()
+	}
+	if err := nd.Write(o); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
+		os.Exit(1)
+	}
+
+	if len(reportFile) == 0 {
+		reportFile = "report.tab"
+	}
+	r, err := os.Create(reportFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
+		os.Exit(1)
+	}
+	defer r.Close()
+	w := csv.NewWriter(r)
+	w.Comma = '\t'
+	w.UseCRLF = true
+	defer w.Flush()
+	err = w.Write([]string{"Name", "Longitude", "Latitude", "Catalog", "Test"})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
+		os.Exit(1)
+	}
+	for _, is := range iss {
+		row := []string{
+			is.Taxon,
+			strconv.FormatFloat(is.Rec.Lon, 'f', -1, 64),
+			strconv.FormatFloat(is.Rec.Lat, 'f', -1, 64),
+			is.Rec.Catalog,
+			is.Test,
+		}
+		if err := w.Write(row); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
+			os.Exit(1)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright (c) 2015, J. Salvador Arias <jsalarias@csnat.unt.edu.ar>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+
+	"github.com/js-arias/evs/biogeo"
+	"github.com/js-arias/evs/cmdapp"
+)
+
+var recIn = &cmdapp.Command{
+	Run:       recInRun,
+	UsageLine: `rec.in [-v|--verbose] [file...]`,
+	Short:     "import occurrence records",
+	Long: `
+Rec.in reads occurrence records from Darwin Core Archives or GBIF downloads,
+and adds them to the 'records.tab' file. If the file does not exist, it
+will be created. The file is rewritten with the records already in the
+file and the imported records (the records of a taxon are written
+together), using the columns described in 'evs help records'. Other
+columns of the file are kept.
+
+Each file can be a Darwin Core Archive (either as a zip file, or a directory
+with the content of the archive), in which the occurrence data is read
+using the description of the meta.xml file; or a delimited text file (with
+tabs or commas) in which the columns are named with Darwin Core terms, as
+in the GBIF simple downloads (also as a zip file). If no file is given, the
+data will be read from the standard input as a delimited text file.
+
+The following Darwin Core terms are used:
+
+    scientificName
+      The name of the taxon. The names are normalized, removing the
+      authorship, and setting the genus in upper caps and the epithets in
+      lower caps (e.g. 'puma concolor (Linnaeus, 1771)' will be read as
+      'Puma concolor'). If the taxon is already in 'records.tab', the name
+      used in that file is kept.
+
+    decimalLongitude
+    decimalLatitude
+      The geographic position of the record. Records without a valid
+      georeference are ignored.
+
+    catalogNumber
+    occurrenceID
+      Used as the record identifier (the catalogNumber is preferred).
+
+    coordinateUncertaintyInMeters
+      The uncertainty of the georeference. If an imported record has an
+      uncertainty, and the 'records.tab' file has no 'Uncertainty' column,
+      the column is added to the file.
+
+Options are:
+
+    -v
+    --verbose
+      If set, the number of taxa and records read from each file will be
+      printed.
+
+    file
+      One or more files to be imported.
+	`,
+}
+
+func init() {
+	recIn.Flag.BoolVar(&verbose, "verbose", false, "")
+	recIn.Flag.BoolVar(&verbose, "v", false, "")
+}
+
+func recInRun(c *cmdapp.Command, args []string) {
+	var ds []*biogeo.DataSet
+	if len(args) == 0 {
+		d, err := biogeo.ReadGBIF(os.Stdin)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
+			os.Exit(1)
+		}
+		if verbose {
+			fmt.Printf("stdin: %d taxa, %d records\n", len(d.Ls), numRecs(d))
+		}
+		ds = append(ds, d)
+	}
+	for _, a := range args {
+		d, err := readOccurrences(a)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s: %v\n", c.Name(), a, err)
+			os.Exit(1)
+		}
+		if verbose {
+			fmt.Printf("%s: %d taxa, %d records\n", a, len(d.Ls), numRecs(d))
+		}
+		ds = append(ds, d)
+	}
+
+	d := &biogeo.DataSet{Names: make(map[string]*biogeo.Taxon)}
+	if _, err := os.Stat(dataFileName); err == nil {
+		d, err = loadData()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
+			os.Exit(1)
+		}
+	}
+	for _, nd := range ds {
+		d.Merge(nd)
+	}
+	if err := writeData(d); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
+		os.Exit(1)
+	}
+}
+
+// readOccurrences reads the occurrences of a Darwin Core Archive, or a GBIF
+// download.
+func readOccurrences(name string) (*biogeo.DataSet, error) {
+	fi, err := os.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r := bufio.NewReader(f)
+		if m, err := r.Peek(4); (err != nil) || (string(m) != "PK\x03\x04") {
+			// not a zip file
+			return biogeo.ReadGBIF(r)
+		}
+	}
+	return biogeo.ReadArchive(name)
+}
+
+// numRecs returns the number of records of a dataset.
+func numRecs(d *biogeo.DataSet) int {
+	n := 0
+	for _, t := range d.Ls {
+		n += len(t.Recs)
+	}
+	return n
+}
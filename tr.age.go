@@ -0,0 +1,126 @@
+// Copyright (c) 2015, J. Salvador Arias <jsalarias@csnat.unt.edu.ar>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/js-arias/evs/cmdapp"
+)
+
+var trAge = &cmdapp.Command{
+	Run:       trAgeRun,
+	UsageLine: "tr.age [--root age] [--tol number] [tree-id...]",
+	Short:     "print or set the age of the trees",
+	Long: `
+Tr.age prints the age of the root of the trees in the 'trees.tab' file,
+and checks if the trees are ultrametric (i.e. all terminals are
+contemporaneous).
+
+If the 'trees.tab' file has an 'Age' column, the ages of the nodes are
+read from that column (the tree is dated). Otherwise, the ages are
+calculated from the branch lengths: the age of a node is the distance to
+the most distant terminal.
+
+The output is a tab table with the following columns:
+	Tree		Tree identifier
+	Root		The age of the root
+	Dated		'yes' if the ages are absolute ages
+	Ultrametric	'yes' if the tree is ultrametric
+	Range		The difference between the ages of the oldest and
+			the youngest terminal
+
+Options are:
+
+    --root age
+      If set, the branch lengths of the trees will be scaled so the root
+      has the indicated age, and the ages of the nodes will be stored in
+      the 'trees.tab' file.
+
+    --tol number
+      Sets the tolerance used to check if a tree is ultrametric, as a
+      fraction of the age of the root. Default = 0.001.
+
+    tree-id
+      If defined, only the indicated trees will be printed (or scaled). By
+      default, all trees are used.
+	`,
+}
+
+var (
+	rootAge float64 // --root
+	ultTol  float64 // --tol
+)
+
+func init() {
+	trAge.Flag.Float64Var(&rootAge, "root", 0, "")
+	trAge.Flag.Float64Var(&ultTol, "tol", 0.001, "")
+}
+
+func trAgeRun(c *cmdapp.Command, args []string) {
+	ts, err := loadTrees()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
+		os.Exit(1)
+	}
+	sel := ts
+	if len(args) > 0 {
+		sel = nil
+		for _, id := range args {
+			i := findTree(ts, id)
+			if i < 0 {
+				fmt.Fprintf(os.Stderr, "%s: tree %s not found\n", c.Name(), id)
+				os.Exit(1)
+			}
+			sel = append(sel, ts[i])
+		}
+	}
+
+	if rootAge > 0 {
+		for _, t := range sel {
+			if err := t.ScaleRoot(rootAge); err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
+				os.Exit(1)
+			}
+		}
+		if err := writeTrees(ts); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
+			os.Exit(1)
+		}
+	}
+
+	w := csv.NewWriter(os.Stdout)
+	w.Comma = '\t'
+	w.UseCRLF = true
+	defer w.Flush()
+	if err := w.Write([]string{"Tree", "Root", "Dated", "Ultrametric", "Range"}); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
+		os.Exit(1)
+	}
+	for _, t := range sel {
+		row := []string{
+			t.ID,
+			strconv.FormatFloat(t.Root.Age, 'f', 6, 64),
+			yesNo(t.Dated),
+			yesNo(t.IsUltrametric(ultTol)),
+			strconv.FormatFloat(t.TermRange(), 'f', 6, 64),
+		}
+		if err := w.Write(row); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
+			os.Exit(1)
+		}
+	}
+}
+
+// yesNo returns 'yes' if v is true, or 'no' otherwise.
+func yesNo(v bool) string {
+	if v {
+		return "yes"
+	}
+	return "no"
+}
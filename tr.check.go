@@ -0,0 +1,165 @@
+// Copyright (c) 2015, J. Salvador Arias <jsalarias@csnat.unt.edu.ar>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+
+	"github.com/js-arias/evs/cmdapp"
+	"github.com/js-arias/evs/tree"
+)
+
+var trCheck = &cmdapp.Command{
+	Run: trCheckRun,
+	UsageLine: `tr.check [--fix] [--maps file] [--minLen number] [--ranges file]
+	[--rangesName name] [tree-id...]`,
+	Short: "check the trees",
+	Long: `
+Tr.check checks the trees of the 'trees.tab' file, and prints the problems
+found in each tree. The problems are:
+	unary node		An internal node with a single descendant
+	zero length		A branch with a length of zero or less (it makes
+				the cost of the events infinite when branch
+				lengths are used)
+	duplicated terminal	A terminal with a name already used in the
+				tree
+	terminal without data	A terminal without data in the
+				'records.tab' file (after the synonyms in the
+				'synonyms.tab' file, if any, are replaced by
+				its accepted names)
+If there is no 'records.tab' file, and no ranges or maps are given, the
+terminals are not checked for data.
+
+The output is a tab table with the following columns:
+	Tree		Tree identifier
+	Node		Node identifier
+	Terminal	The name of the terminal (if the node is a terminal)
+	Problem		The problem found in the node
+
+Options are:
+
+    --fix
+      If set, the problems will be repaired: unary nodes are collapsed (its
+      branch length is added to the branch of its descendant), the branches
+      shorter than the minimum length are set to that length, and the
+      duplicated terminals are removed (keeping the first terminal with
+      that name). The remaining nodes keep their identifiers.
+      Terminals without data are not removed (use tr.prune --missing).
+
+    --maps file
+      Includes the taxa with presence maps in the indicated manifest file
+      as taxa with data.
+
+    --minLen number
+      Set the minimum branch length used to repair the trees. If zero, the
+      branch lengths are not repaired. Default = 0.
+
+    --ranges file
+      Includes the taxa with range polygons in the indicated GeoJSON file
+      as taxa with data.
+
+    --rangesName name
+      Sets the property of the features of the ranges file used as the
+      name of the taxon. By default, the first property found of 'name',
+      'scientificName', 'binomial', 'sci_name' or 'species' is used.
+
+    tree-id
+      If defined, only the indicated trees will be checked. By default,
+      all trees are checked.
+	`,
+}
+
+var (
+	fixTrees bool    // --fix
+	minLen   float64 // --minLen
+)
+
+func init() {
+	trCheck.Flag.BoolVar(&fixTrees, "fix", false, "")
+	trCheck.Flag.Float64Var(&minLen, "minLen", 0, "")
+	trCheck.Flag.StringVar(&rangeFls, "ranges", "", "")
+	trCheck.Flag.StringVar(&rangesName, "rangesName", "", "")
+	trCheck.Flag.StringVar(&mapsFile, "maps", "", "")
+}
+
+func trCheckRun(c *cmdapp.Command, args []string) {
+	ts, err := loadTrees()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
+		os.Exit(1)
+	}
+	check := ts
+	if len(args) > 0 {
+		check = nil
+		for _, id := range args {
+			i := findTree(ts, id)
+			if i < 0 {
+				fmt.Fprintf(os.Stderr, "%s: tree %s not found\n", c.Name(), id)
+				os.Exit(1)
+			}
+			check = append(check, ts[i])
+		}
+	}
+
+	var hasData func(string) bool
+	d, err := rasterData()
+	if err == nil {
+		syn, err := loadSynonyms()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
+			os.Exit(1)
+		}
+		hasData = func(term string) bool {
+			return d.Taxon(syn.Accepted(term)) != nil
+		}
+	} else if !os.IsNotExist(err) {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
+		os.Exit(1)
+	}
+
+	w := csv.NewWriter(os.Stdout)
+	w.Comma = '\t'
+	w.UseCRLF = true
+	defer w.Flush()
+	if err := w.Write([]string{"Tree", "Node", "Terminal", "Problem"}); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
+		os.Exit(1)
+	}
+	fixed := false
+	for _, t := range check {
+		for _, p := range t.Validate(hasData) {
+			if err := w.Write([]string{t.ID, p.Node.ID, p.Node.Term, p.Kind}); err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
+				os.Exit(1)
+			}
+		}
+		if !fixTrees {
+			continue
+		}
+		if repairTree(t) {
+			fixed = true
+		}
+	}
+	if !fixed {
+		return
+	}
+	if err := writeTrees(ts); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
+		os.Exit(1)
+	}
+}
+
+// repairTree repairs the problems of a tree. It returns true if the tree
+// was modified.
+func repairTree(t *tree.Tree) bool {
+	num := t.CollapseUnary()
+	if minLen > 0 {
+		num += t.SetMinLen(minLen)
+	}
+	num += t.DropDuplicates()
+	return num > 0
+}
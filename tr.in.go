@@ -5,8 +5,12 @@
 package main
 
 import (
+	"bufio"
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"unicode"
 
 	"github.com/js-arias/evs/cmdapp"
 	"github.com/js-arias/evs/tree"
@@ -14,12 +18,13 @@ import (
 
 var trIn = &cmdapp.Command{
 	Run:       trInRun,
-	UsageLine: `tr.in [-i|--input file] tree-id`,
-	Short:     "import a parenthetical tree",
+	UsageLine: `tr.in [-i|--input file] [tree-id]`,
+	Short:     "import parenthetical or NEXUS trees",
 	Long: `
-Tr.in reads a tree in parenthetical notation, assuming that each terminal is
-stored by its name (underline character will be transformed into space), and
-prints in as a tab table that contains the tree.
+Tr.in reads one or more trees in parenthetical (Newick) notation, or from the
+TREES blocks of a NEXUS file, and adds them to the 'trees.tab' file. It
+assumes that each terminal is stored by its name (underline character will
+be transformed into space).
 
 The output file, has the following columns:
 	Tree		Tree identifier
@@ -30,19 +35,29 @@ The output file, has the following columns:
 The table must be sorted in a form that each node is read only after its
 ancestor was already readed.
 
-By default, the tree is read from the standard input. The tree must be in
-parenthetical format, without any header (such as 'tread' or 'tree ='). Only
-one tree will be read from the input.
+By default, the trees are read from the standard input. If the input starts
+with '#NEXUS', it is read as a NEXUS file: the trees are read from the
+'tree' commands of the TREES blocks, and the terminals are named using the
+TRANSLATE table (if any). Otherwise the input is read as a sequence of
+trees in parenthetical format, each one ended by a semicolon; any text
+before a tree (such as 'tree =') is ignored. In both formats, comments
+(e.g. '[&R]') and the labels of internal nodes (e.g. support values) are
+ignored.
 
 Options are:
 
     -i file
     --input file
-      If defined, the tree in parenthetical format will read from the
-      indicated file, instead of the standard input.
+      If defined, the trees will be read from the indicated file, instead
+      of the standard input.
 
     tree-id
-      Set the id of the tree.
+      Set the id of the tree. If there are several trees in the input, the
+      trees will be identified as tree-id.1, tree-id.2, etc. If not
+      defined, the trees in a NEXUS file will use the names in the file,
+      and the trees in parenthetical format will be identified as tree1,
+      tree2, etc., skipping the identifiers already used in the 'trees.tab'
+      file.
 	`,
 }
 
@@ -53,10 +68,6 @@ func init() {
 }
 
 func trInRun(c *cmdapp.Command, args []string) {
-	if len(args) == 0 {
-		fmt.Fprintf(os.Stderr, "%s: expecting tree ID\n", c.Name())
-		os.Exit(1)
-	}
 	var ts []*tree.Tree
 	if _, err := os.Stat(treeFileName); err == nil {
 		ts, err = loadTrees()
@@ -65,6 +76,12 @@ func trInRun(c *cmdapp.Command, args []string) {
 			os.Exit(1)
 		}
 	}
+	ids := make(map[string]bool)
+	for _, t := range ts {
+		ids[t.ID] = true
+	}
+
+	// reads the trees
 	f := os.Stdin
 	if len(inFile) != 0 {
 		var err error
@@ -75,45 +92,68 @@ func trInRun(c *cmdapp.Command, args []string) {
 		}
 		defer f.Close()
 	}
-	for _, t := range ts {
-		if t.ID == args[0] {
-			fmt.Fprintf(os.Stderr, "%s: tree ID already used\n", c.Name())
-			os.Exit(1)
-		}
+	in := bufio.NewReader(f)
+	var nt []*tree.Tree
+	var err error
+	auto := false
+	if isNexus(in) {
+		nt, err = tree.ReadNexus(in)
+	} else {
+		nt, err = tree.ReadNewick(in, "tree")
+		auto = len(args) == 0
 	}
-
-	// reads the tree
-	in := os.Stdin
-	if len(inFile) != 0 {
-		var err error
-		in, err = os.Open(inFile)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
-			os.Exit(1)
-		}
-		defer in.Close()
-	}
-	t, err := tree.ReadParenthetic(in, args[0])
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
 		os.Exit(1)
 	}
-	ts = append(ts, t)
+	if len(args) > 0 {
+		if len(nt) == 1 {
+			nt[0].ID = args[0]
+		} else {
+			for i, t := range nt {
+				t.ID = args[0] + "." + strconv.Itoa(i+1)
+			}
+		}
+	}
+	if auto {
+		// automatic IDs skip the IDs already used
+		k := 0
+		for _, t := range nt {
+			k++
+			for ids["tree"+strconv.Itoa(k)] {
+				k++
+			}
+			t.ID = "tree" + strconv.Itoa(k)
+		}
+	}
+	for _, t := range nt {
+		if ids[t.ID] {
+			fmt.Fprintf(os.Stderr, "%s: tree ID %s already used\n", c.Name(), t.ID)
+			os.Exit(1)
+		}
+		ids[t.ID] = true
+	}
+	ts = append(ts, nt...)
 
 	// writes the trees into the database
-	out, err := os.Create(treeFileName)
-	if err != nil {
+	if err := writeTrees(ts); err != nil {
 		fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
 		os.Exit(1)
 	}
-	defer out.Close()
-	head := true
-	for _, v := range ts {
-		err = v.Write(out, head)
+}
+
+// isNexus returns true if the input starts with the NEXUS header.
+func isNexus(in *bufio.Reader) bool {
+	for {
+		b, err := in.Peek(1)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
-			os.Exit(1)
+			return false
+		}
+		if !unicode.IsSpace(rune(b[0])) {
+			break
 		}
-		head = false
+		in.ReadByte()
 	}
+	b, _ := in.Peek(6)
+	return strings.ToUpper(string(b)) == "#NEXUS"
 }
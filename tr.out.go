@@ -0,0 +1,94 @@
+// Copyright (c) 2015, J. Salvador Arias <jsalarias@csnat.unt.edu.ar>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/js-arias/evs/cmdapp"
+	"github.com/js-arias/evs/tree"
+)
+
+var trOut = &cmdapp.Command{
+	Run:       trOutRun,
+	UsageLine: `tr.out [--nexus] [-o|--output file] [tree-id...]`,
+	Short:     "export trees in parenthetical or NEXUS format",
+	Long: `
+Tr.out writes the trees of the 'trees.tab' file in parenthetical (Newick)
+notation, a tree per line. Terminals are written by its name (spaces are
+transformed into underlines, and names with punctuation are quoted), the
+internal nodes are labeled with its node identifiers, and the length of
+each branch is included.
+
+Options are:
+
+    --nexus
+      If set, the trees will be written as the TREES block of a NEXUS
+      file.
+
+    -o file
+    --output file
+      If defined, the trees will be written in the indicated file, instead
+      of the standard output.
+
+    tree-id
+      If defined, only the indicated trees will be written. By default,
+      all trees are written.
+	`,
+}
+
+var nexusOut bool // --nexus
+
+func init() {
+	trOut.Flag.BoolVar(&nexusOut, "nexus", false, "")
+	trOut.Flag.StringVar(&outFile, "output", "", "")
+	trOut.Flag.StringVar(&outFile, "o", "", "")
+}
+
+func trOutRun(c *cmdapp.Command, args []string) {
+	ts, err := loadTrees()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
+		os.Exit(1)
+	}
+	if len(args) > 0 {
+		ids := make(map[string]*tree.Tree)
+		for _, t := range ts {
+			ids[t.ID] = t
+		}
+		ts = nil
+		for _, a := range args {
+			t, ok := ids[a]
+			if !ok {
+				fmt.Fprintf(os.Stderr, "%s: tree %s not found\n", c.Name(), a)
+				os.Exit(1)
+			}
+			ts = append(ts, t)
+		}
+	}
+	o := os.Stdout
+	if len(outFile) > 0 {
+		o, err = os.Create(outFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
+			os.Exit(1)
+		}
+		defer o.Close()
+	}
+	if nexusOut {
+		err = tree.WriteNexus(o, ts)
+	} else {
+		for _, t := range ts {
+			if err = t.WriteNewick(o); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
+		os.Exit(1)
+	}
+}
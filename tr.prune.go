@@ -0,0 +1,144 @@
+// Copyright (c) 2015, J. Salvador Arias <jsalarias@csnat.unt.edu.ar>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/js-arias/evs/cmdapp"
+	"github.com/js-arias/evs/tree"
+)
+
+var trPrune = &cmdapp.Command{
+	Run: trPruneRun,
+	UsageLine: `tr.prune [--id new-id] [--maps file] [--missing] [--ranges file]
+	[--rangesName name] tree-id [terminal...]`,
+	Short: "prune terminals of a tree",
+	Long: `
+Tr.prune removes the indicated terminals from a tree of the 'trees.tab'
+file. Internal nodes left with a single descendant are removed, and its
+branch length is added to the branch of its descendant. The remaining
+nodes keep their identifiers.
+
+Options are:
+
+    --id new-id
+      If set, the pruned tree will be added as a new tree with the
+      indicated ID, instead of replacing the original tree.
+
+    --maps file
+      Includes the taxa with presence maps in the indicated manifest file
+      as taxa with data (used with --missing).
+
+    --missing
+      If set, the terminals without data in the 'records.tab' file (after
+      the synonyms in the 'synonyms.tab' file, if any, are replaced by its
+      accepted names) will be pruned.
+
+    --ranges file
+      Includes the taxa with range polygons in the indicated GeoJSON file
+      as taxa with data (used with --missing).
+
+    --rangesName name
+      Sets the property of the features of the ranges file used as the
+      name of the taxon. By default, the first property found of 'name',
+      'scientificName', 'binomial', 'sci_name' or 'species' is used.
+
+    tree-id
+      The tree to be pruned.
+
+    terminal
+      The name of a terminal to be pruned.
+	`,
+}
+
+var (
+	newID   string // --id
+	missing bool   // --missing
+)
+
+func init() {
+	trPrune.Flag.StringVar(&newID, "id", "", "")
+	trPrune.Flag.BoolVar(&missing, "missing", false, "")
+	trPrune.Flag.StringVar(&rangeFls, "ranges", "", "")
+	trPrune.Flag.StringVar(&rangesName, "rangesName", "", "")
+	trPrune.Flag.StringVar(&mapsFile, "maps", "", "")
+}
+
+func trPruneRun(c *cmdapp.Command, args []string) {
+	if len(args) == 0 {
+		fmt.Fprintf(os.Stderr, "%s: expecting a tree ID\n", c.Name())
+		os.Exit(1)
+	}
+	ts, err := loadTrees()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
+		os.Exit(1)
+	}
+	i := findTree(ts, args[0])
+	if i < 0 {
+		fmt.Fprintf(os.Stderr, "%s: tree %s not found\n", c.Name(), args[0])
+		os.Exit(1)
+	}
+	t := ts[i]
+	terms := args[1:]
+	if missing {
+		d, err := rasterData()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
+			os.Exit(1)
+		}
+		syn, err := loadSynonyms()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
+			os.Exit(1)
+		}
+		for _, tm := range termNames([]*tree.Tree{t}) {
+			if d.Taxon(syn.Accepted(tm)) == nil {
+				terms = append(terms, tm)
+			}
+		}
+	}
+	if len(terms) == 0 {
+		if missing {
+			// all terminals have data
+			return
+		}
+		fmt.Fprintf(os.Stderr, "%s: no terminals to prune\n", c.Name())
+		os.Exit(1)
+	}
+	if len(newID) > 0 {
+		t = t.Copy()
+	}
+	if err := t.Prune(terms); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
+		os.Exit(1)
+	}
+	ts, err = storeTree(ts, i, t)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
+		os.Exit(1)
+	}
+	if err := writeTrees(ts); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
+		os.Exit(1)
+	}
+}
+
+// storeTree stores a modified copy of the tree i. If the --id flag is
+// set, the tree is added with the new ID, otherwise, it replaces the
+// original tree.
+func storeTree(ts []*tree.Tree, i int, t *tree.Tree) ([]*tree.Tree, error) {
+	if len(newID) == 0 {
+		ts[i] = t
+		return ts, nil
+	}
+	if findTree(ts, newID) >= 0 {
+		return nil, fmt.Errorf("tree ID %s already used", newID)
+	}
+	t.ID = newID
+	return append(ts, t), nil
+}
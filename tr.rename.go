@@ -0,0 +1,95 @@
+// Copyright (c) 2015, J. Salvador Arias <jsalarias@csnat.unt.edu.ar>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/js-arias/evs/cmdapp"
+)
+
+var trRename = &cmdapp.Command{
+	Run:       trRenameRun,
+	UsageLine: "tr.rename [--term] [--tree tree-id] old new",
+	Short:     "rename a tree or a terminal",
+	Long: `
+Tr.rename changes the ID of a tree of the 'trees.tab' file. If the option
+--term is set, it changes the name of a terminal in the trees.
+
+Options are:
+
+    --term
+      If set, the name of a terminal will be changed, instead of the ID of
+      a tree.
+
+    --tree tree-id
+      If set, the terminal will be renamed only in the indicated tree. By
+      default, the terminal is renamed in all trees.
+
+    old
+      The current ID of the tree, or the current name of the terminal.
+
+    new
+      The new ID of the tree, or the new name of the terminal.
+	`,
+}
+
+var (
+	renTerm bool   // --term
+	renTree string // --tree
+)
+
+func init() {
+	trRename.Flag.BoolVar(&renTerm, "term", false, "")
+	trRename.Flag.StringVar(&renTree, "tree", "", "")
+}
+
+func trRenameRun(c *cmdapp.Command, args []string) {
+	if len(args) != 2 {
+		fmt.Fprintf(os.Stderr, "%s: expecting the old and the new name\n", c.Name())
+		os.Exit(1)
+	}
+	ts, err := loadTrees()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
+		os.Exit(1)
+	}
+	if !renTerm {
+		i := findTree(ts, args[0])
+		if i < 0 {
+			fmt.Fprintf(os.Stderr, "%s: tree %s not found\n", c.Name(), args[0])
+			os.Exit(1)
+		}
+		if findTree(ts, args[1]) >= 0 {
+			fmt.Fprintf(os.Stderr, "%s: tree ID %s already used\n", c.Name(), args[1])
+			os.Exit(1)
+		}
+		ts[i].ID = args[1]
+	} else {
+		found := false
+		for _, t := range ts {
+			if (len(renTree) > 0) && (t.ID != renTree) {
+				continue
+			}
+			if t.Terminal(args[0]) == nil {
+				continue
+			}
+			if err := t.RenameTerminal(args[0], args[1]); err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
+				os.Exit(1)
+			}
+			found = true
+		}
+		if !found {
+			fmt.Fprintf(os.Stderr, "%s: terminal %s not found\n", c.Name(), args[0])
+			os.Exit(1)
+		}
+	}
+	if err := writeTrees(ts); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
+		os.Exit(1)
+	}
+}
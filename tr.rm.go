@@ -0,0 +1,53 @@
+// Copyright (c) 2015, J. Salvador Arias <jsalarias@csnat.unt.edu.ar>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/js-arias/evs/cmdapp"
+)
+
+var trRm = &cmdapp.Command{
+	Run:       trRmRun,
+	UsageLine: "tr.rm tree-id...",
+	Short:     "remove trees",
+	Long: `
+Tr.rm removes the indicated trees from the 'trees.tab' file. If no tree
+remains, the file is removed.
+	`,
+}
+
+func trRmRun(c *cmdapp.Command, args []string) {
+	if len(args) == 0 {
+		fmt.Fprintf(os.Stderr, "%s: expecting a tree ID\n", c.Name())
+		os.Exit(1)
+	}
+	ts, err := loadTrees()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
+		os.Exit(1)
+	}
+	for _, id := range args {
+		i := findTree(ts, id)
+		if i < 0 {
+			fmt.Fprintf(os.Stderr, "%s: tree %s not found\n", c.Name(), id)
+			os.Exit(1)
+		}
+		ts = append(ts[:i], ts[i+1:]...)
+	}
+	if len(ts) == 0 {
+		if err := os.Remove(treeFileName); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
+			os.Exit(1)
+		}
+		return
+	}
+	if err := writeTrees(ts); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright (c) 2015, J. Salvador Arias <jsalarias@csnat.unt.edu.ar>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/js-arias/evs/cmdapp"
+)
+
+var trRoot = &cmdapp.Command{
+	Run:       trRootRun,
+	UsageLine: "tr.root [--id new-id] [--ladderize] tree-id [terminal...]",
+	Short:     "reroot a tree",
+	Long: `
+Tr.root roots a tree of the 'trees.tab' file at the branch that separates
+the indicated terminals (the outgroup) from the rest of the tree. The
+outgroup must be monophyletic in the unrooted tree. The length of the
+branch is divided in equal parts between the two descendants of the new
+root. The nodes of the rerooted tree keep their identifiers, and the new
+root takes an unused identifier.
+
+Options are:
+
+    --id new-id
+      If set, the rerooted tree will be added as a new tree with the
+      indicated ID, instead of replacing the original tree.
+
+    --ladderize
+      If set, the descendants of each node will be sorted by the number of
+      terminals, from the smallest to the largest clade. If no outgroup is
+      given, the tree is only ladderized.
+
+    tree-id
+      The tree to be rerooted.
+
+    terminal
+      The name of a terminal of the outgroup.
+	`,
+}
+
+var ladder bool // --ladderize
+
+func init() {
+	trRoot.Flag.StringVar(&newID, "id", "", "")
+	trRoot.Flag.BoolVar(&ladder, "ladderize", false, "")
+}
+
+func trRootRun(c *cmdapp.Command, args []string) {
+	if len(args) == 0 {
+		fmt.Fprintf(os.Stderr, "%s: expecting a tree ID\n", c.Name())
+		os.Exit(1)
+	}
+	if (len(args) == 1) && !ladder {
+		fmt.Fprintf(os.Stderr, "%s: expecting an outgroup\n", c.Name())
+		os.Exit(1)
+	}
+	ts, err := loadTrees()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
+		os.Exit(1)
+	}
+	i := findTree(ts, args[0])
+	if i < 0 {
+		fmt.Fprintf(os.Stderr, "%s: tree %s not found\n", c.Name(), args[0])
+		os.Exit(1)
+	}
+	t := ts[i]
+	if len(newID) > 0 {
+		t = t.Copy()
+	}
+	if len(args) > 1 {
+		if err := t.Reroot(args[1:]); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
+			os.Exit(1)
+		}
+	}
+	if ladder {
+		t.Ladderize()
+	}
+	ts, err = storeTree(ts, i, t)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
+		os.Exit(1)
+	}
+	if err := writeTrees(ts); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright (c) 2015, J. Salvador Arias <jsalarias@csnat.unt.edu.ar>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/js-arias/evs/cmdapp"
+)
+
+var trSub = &cmdapp.Command{
+	Run:       trSubRun,
+	UsageLine: "tr.sub tree-id new-id terminal...",
+	Short:     "extract a subtree",
+	Long: `
+Tr.sub extracts the clade defined by the most recent common ancestor of the
+indicated terminals from a tree of the 'trees.tab' file, and adds it as a
+new tree with the indicated ID. The nodes of the new tree keep the
+identifiers of the original tree.
+
+Options are:
+
+    tree-id
+      The tree from which the subtree is extracted.
+
+    new-id
+      The ID of the new tree.
+
+    terminal
+      The name of a terminal of the clade.
+	`,
+}
+
+func trSubRun(c *cmdapp.Command, args []string) {
+	if len(args) < 3 {
+		fmt.Fprintf(os.Stderr, "%s: expecting a tree ID, a new ID and the terminals of the clade\n", c.Name())
+		os.Exit(1)
+	}
+	ts, err := loadTrees()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
+		os.Exit(1)
+	}
+	i := findTree(ts, args[0])
+	if i < 0 {
+		fmt.Fprintf(os.Stderr, "%s: tree %s not found\n", c.Name(), args[0])
+		os.Exit(1)
+	}
+	if findTree(ts, args[1]) >= 0 {
+		fmt.Fprintf(os.Stderr, "%s: tree ID %s already used\n", c.Name(), args[1])
+		os.Exit(1)
+	}
+	s, err := ts[i].Subtree(args[2:], args[1])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
+		os.Exit(1)
+	}
+	ts = append(ts, s)
+	if err := writeTrees(ts); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
+		os.Exit(1)
+	}
+}
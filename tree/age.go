@@ -0,0 +1,197 @@
+// Copyright (c) 2015, J. Salvador Arias <jsalarias@csnat.unt.edu.ar>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package tree
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// SetAges sets the age of the nodes of a tree from the branch lengths. The
+// age of a node is the distance from the root to the most distant
+// terminal, minus the distance from the root to the node, so the most
+// distant terminal has an age of zero.
+func (t *Tree) SetAges() {
+	dist := make([]float64, len(t.Nodes))
+	max := float64(0)
+	for _, n := range t.Nodes {
+		if n.Anc != nil {
+			dist[n.Index] = dist[n.Anc.Index] + n.Len
+		}
+		if dist[n.Index] > max {
+			max = dist[n.Index]
+		}
+	}
+	for _, n := range t.Nodes {
+		n.Age = max - dist[n.Index]
+	}
+}
+
+// TermRange returns the difference between the oldest and the youngest
+// terminal of a tree. In an ultrametric tree, in which all terminals are
+// contemporaneous, it is zero.
+func (t *Tree) TermRange() float64 {
+	min, max := -1.0, -1.0
+	for _, n := range t.Nodes {
+		if n.First != nil {
+			continue
+		}
+		if (min < 0) || (n.Age < min) {
+			min = n.Age
+		}
+		if n.Age > max {
+			max = n.Age
+		}
+	}
+	return max - min
+}
+
+// IsUltrametric returns true if the difference between the ages of the
+// terminals is not greater than tol times the age of the root.
+func (t *Tree) IsUltrametric(tol float64) bool {
+	return t.TermRange() <= tol*t.Root.Age
+}
+
+// ScaleRoot scales the branch lengths, and the node ages, of a tree, so
+// the root has the indicated age. The tree is marked as dated.
+func (t *Tree) ScaleRoot(age float64) error {
+	if age <= 0 {
+		return fmt.Errorf("tree %s: invalid root age %g", t.ID, age)
+	}
+	if t.Root.Age <= 0 {
+		return fmt.Errorf("tree %s: root without age", t.ID)
+	}
+	f := age / t.Root.Age
+	for _, n := range t.Nodes {
+		n.Age *= f
+		if n.Anc != nil {
+			n.Len *= f
+		}
+	}
+	t.Dated = true
+	return nil
+}
+
+// setLenFromAges sets the branch lengths of the nodes without a defined
+// length from the node ages.
+func (t *Tree) setLenFromAges(noLen map[*Node]bool) error {
+	for _, n := range t.Nodes {
+		if (n.Anc == nil) || !noLen[n] {
+			continue
+		}
+		if n.Age > n.Anc.Age {
+			return fmt.Errorf("tree %s: node %s older than its ancestor", t.ID, n.ID)
+		}
+		n.Len = n.Anc.Age - n.Age
+	}
+	return nil
+}
+
+// A Period is a time interval of a geological time scale. Start is the
+// age of the beginning (the oldest age) of the period, and End the age of
+// its end.
+type Period struct {
+	Name  string
+	Start float64
+	End   float64
+	Color string
+}
+
+// Periods are the periods of the Phanerozoic, as defined in the
+// International Chronostratigraphic Chart (2023/06), with ages in million
+// years, and the colors of the chart.
+var Periods = []Period{
+	{"Quaternary", 2.58, 0, "#F9F97F"},
+	{"Neogene", 23.03, 2.58, "#FFE619"},
+	{"Paleogene", 66, 23.03, "#FD9A52"},
+	{"Cretaceous", 145, 66, "#7FC64E"},
+	{"Jurassic", 201.4, 145, "#34B2C9"},
+	{"Triassic", 251.902, 201.4, "#812B92"},
+	{"Permian", 298.9, 251.902, "#F04028"},
+	{"Carboniferous", 358.9, 298.9, "#67A599"},
+	{"Devonian", 419.2, 358.9, "#CB8C37"},
+	{"Silurian", 443.8, 419.2, "#B3E1B6"},
+	{"Ordovician", 485.4, 443.8, "#009270"},
+	{"Cambrian", 538.8, 485.4, "#7FA056"},
+}
+
+// PeriodOf returns the period that includes an age, or nil if the age is
+// outside the time scale. An age equal to the boundary between two periods
+// is included in the youngest period.
+func PeriodOf(ps []Period, age float64) *Period {
+	for i := range ps {
+		if (age >= ps[i].End) && (age < ps[i].Start) {
+			return &ps[i]
+		}
+	}
+	return nil
+}
+
+// ReadPeriods reads a time scale from a tab delimited file with the
+// columns 'Name', 'Start' and 'End', and optionally, 'Color'.
+func ReadPeriods(in io.Reader) ([]Period, error) {
+	r := csv.NewReader(bufio.NewReader(in))
+	r.Comma = '\t'
+
+	h, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("header (periods): %v", err)
+	}
+	name, start, end, color := -1, -1, -1, -1
+	for i, v := range h {
+		switch strings.ToLower(strings.TrimSpace(v)) {
+		case "name", "period":
+			name = i
+		case "start":
+			start = i
+		case "end":
+			end = i
+		case "color", "colour":
+			color = i
+		}
+	}
+	if (name < 0) || (start < 0) || (end < 0) {
+		return nil, errors.New("header (periods): incomplete header")
+	}
+	var ps []Period
+	for i := 1; ; i++ {
+		row, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("(periods) row %d: %v", i, err)
+		}
+		if (len(row) <= name) || (len(row) <= start) || (len(row) <= end) {
+			continue
+		}
+		p := Period{Name: strings.TrimSpace(row[name])}
+		if len(p.Name) == 0 {
+			continue
+		}
+		if p.Start, err = strconv.ParseFloat(strings.TrimSpace(row[start]), 64); err != nil {
+			return nil, fmt.Errorf("(periods) row %d: start: %v", i, err)
+		}
+		if p.End, err = strconv.ParseFloat(strings.TrimSpace(row[end]), 64); err != nil {
+			return nil, fmt.Errorf("(periods) row %d: end: %v", i, err)
+		}
+		if p.End > p.Start {
+			return nil, fmt.Errorf("(periods) row %d: end of %s older than its start", i, p.Name)
+		}
+		if (color >= 0) && (len(row) > color) {
+			p.Color = strings.TrimSpace(row[color])
+		}
+		ps = append(ps, p)
+	}
+	if len(ps) == 0 {
+		return nil, errors.New("(periods): empty time scale")
+	}
+	return ps, nil
+}
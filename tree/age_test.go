@@ -0,0 +1,133 @@
+// Copyright (c) 2015, J. Salvador Arias <jsalarias@csnat.unt.edu.ar>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package tree
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestSetAges(t *testing.T) {
+	tr := readTest(t, "((a:1,b:1):2,(c:2,d:1):1);")
+	want := []float64{3, 1, 0, 0, 2, 0, 1}
+	for i, n := range tr.Nodes {
+		if n.Age != want[i] {
+			t.Errorf("age error: node %s: expecting %.2f, found %.2f", n.ID, want[i], n.Age)
+		}
+	}
+	if tr.IsUltrametric(0.001) {
+		t.Errorf("ultrametric error: tree is not ultrametric")
+	}
+	if r := tr.TermRange(); r != 1 {
+		t.Errorf("range error: expecting 1, found %.2f", r)
+	}
+
+	tr = readTest(t, "((a:1,b:1):2,(c:2,d:2):1);")
+	if !tr.IsUltrametric(0.001) {
+		t.Errorf("ultrametric error: tree is ultrametric")
+	}
+	if err := tr.ScaleRoot(30); err != nil {
+		t.Fatalf("scale error: %v", err)
+	}
+	if !tr.Dated {
+		t.Errorf("scale error: tree should be dated")
+	}
+	if tr.Root.Age != 30 {
+		t.Errorf("scale error: expecting root age 30, found %.2f", tr.Root.Age)
+	}
+	if ln := tr.Nodes[1].Len; ln != 20 {
+		t.Errorf("scale error: expecting length 20, found %.2f", ln)
+	}
+}
+
+func TestReadAges(t *testing.T) {
+	data := "Tree\tNode\tAncestor\tLength\tTerminal\tAge\r\n" +
+		"t1\t0\t-1\t\t\t50\r\n" +
+		"t1\t1\t0\t\t\t20\r\n" +
+		"t1\t2\t1\t\ta\t0\r\n" +
+		"t1\t3\t1\t5\tb\t0\r\n" +
+		"t1\t4\t0\t\tc\t10\r\n"
+	ts, err := Read(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("read error: %v", err)
+	}
+	tr := ts[0]
+	if !tr.Dated {
+		t.Errorf("read error: tree should be dated")
+	}
+	// the defined lengths are kept
+	want := []float64{1, 30, 20, 5, 40}
+	for i, n := range tr.Nodes {
+		if n.Len != want[i] {
+			t.Errorf("length error: node %s: expecting %.2f, found %.2f", n.ID, want[i], n.Len)
+		}
+	}
+
+	var b bytes.Buffer
+	if err := tr.Write(&b, true); err != nil {
+		t.Fatalf("write error: %v", err)
+	}
+	ts, err = Read(&b)
+	if err != nil {
+		t.Fatalf("read error: %v", err)
+	}
+	for i, n := range ts[0].Nodes {
+		if n.Age != tr.Nodes[i].Age {
+			t.Errorf("round-trip error: node %s: expecting age %.2f, found %.2f", n.ID, tr.Nodes[i].Age, n.Age)
+		}
+	}
+
+	// a tree without ages takes the ages from the lengths
+	data = "Tree\tNode\tAncestor\tLength\tTerminal\tAge\r\n" +
+		"t1\t0\t-1\t1\t\t\r\n" +
+		"t1\t1\t0\t2\ta\t\r\n" +
+		"t1\t2\t0\t1\tb\t\r\n"
+	ts, err = Read(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("read error: %v", err)
+	}
+	if ts[0].Dated || (ts[0].Root.Age != 2) {
+		t.Errorf("read error: expecting undated tree with root age 2, found %v, %.2f", ts[0].Dated, ts[0].Root.Age)
+	}
+
+	bad := []string{
+		"Tree\tNode\tAncestor\tTerminal\tAge\r\nt1\t0\t-1\t\t10\r\nt1\t1\t0\ta\t\r\nt1\t2\t0\tb\t0\r\n",
+		"Tree\tNode\tAncestor\tTerminal\tAge\r\nt1\t0\t-1\t\t10\r\nt1\t1\t0\ta\t20\r\nt1\t2\t0\tb\t0\r\n",
+		"Tree\tNode\tAncestor\tTerminal\tAge\r\nt1\t0\t-1\t\tx\r\nt1\t1\t0\ta\t0\r\nt1\t2\t0\tb\t0\r\n",
+	}
+	for _, s := range bad {
+		if _, err := Read(strings.NewReader(s)); err == nil {
+			t.Errorf("read error: expecting error on %q", s)
+		}
+	}
+}
+
+func TestPeriods(t *testing.T) {
+	if p := PeriodOf(Periods, 66); (p == nil) || (p.Name != "Cretaceous") {
+		t.Errorf("period error: expecting Cretaceous, found %v", p)
+	}
+	if p := PeriodOf(Periods, 1000); p != nil {
+		t.Errorf("period error: expecting no period, found %v", p)
+	}
+
+	data := "Name\tStart\tEnd\tColor\r\nlate\t10\t0\t#FF0000\r\nearly\t30\t10\t\r\n"
+	ps, err := ReadPeriods(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("read error: %v", err)
+	}
+	if len(ps) != 2 {
+		t.Fatalf("read error: expecting 2 periods, found %d", len(ps))
+	}
+	if p := PeriodOf(ps, 10); (p == nil) || (p.Name != "early") {
+		t.Errorf("period error: expecting early, found %v", p)
+	}
+	if ps[0].Color != "#FF0000" {
+		t.Errorf("color error: expecting #FF0000, found %q", ps[0].Color)
+	}
+	if _, err := ReadPeriods(strings.NewReader("Name\tStart\tEnd\r\nx\t0\t10\r\n")); err == nil {
+		t.Errorf("read error: expecting error on a period with an end older than its start")
+	}
+}
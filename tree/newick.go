@@ -0,0 +1,553 @@
+// Copyright (c) 2015, J. Salvador Arias <jsalarias@csnat.unt.edu.ar>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package tree
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ReadParenthetic reads a single tree in parenthetical format. Any text
+// before the first parenthesis (e.g. a 'tree =' header) is ignored.
+func ReadParenthetic(in io.Reader, id string) (*Tree, error) {
+	l := newLexer(in)
+	t, err := l.readTree(id, nil)
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, fmt.Errorf("(tree): %v", err)
+	}
+	return t, nil
+}
+
+// ReadNewick reads one or more trees in parenthetical (Newick) format,
+// each one ended by a semicolon. Any text before the first parenthesis of a
+// tree is ignored. The trees are identified with prefix followed by the
+// number of the tree in the input (starting from 1).
+func ReadNewick(in io.Reader, prefix string) ([]*Tree, error) {
+	l := newLexer(in)
+	var ts []*Tree
+	for {
+		t, err := l.readTree(prefix+strconv.Itoa(len(ts)+1), nil)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("(newick) tree %d: %v", len(ts)+1, err)
+		}
+		ts = append(ts, t)
+	}
+	if len(ts) == 0 {
+		return nil, errors.New("(newick): no trees")
+	}
+	return ts, nil
+}
+
+// ReadNexus reads the trees stored in the TREES blocks of a NEXUS file.
+// Trees are identified with the name used in the file, and terminals are
+// named using the TRANSLATE table of the block (if any). Comments (e.g.
+// '[&R]', or node annotations) are ignored.
+func ReadNexus(in io.Reader) ([]*Tree, error) {
+	l := newLexer(in)
+	tk, err := l.next()
+	if (err != nil) || (strings.ToUpper(tk.val) != "#NEXUS") {
+		return nil, errors.New("header (nexus): expecting #NEXUS")
+	}
+	var ts []*Tree
+	inTrees := false
+	var trans map[string]string
+	for {
+		tk, err := l.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("(nexus): %v", err)
+		}
+		if tk.isPunct(';') {
+			continue
+		}
+		cmd := strings.ToLower(tk.val)
+		switch {
+		case cmd == "begin":
+			blk, err := l.next()
+			if err != nil {
+				return nil, fmt.Errorf("(nexus): begin: %v", err)
+			}
+			inTrees = strings.ToLower(blk.val) == "trees"
+			trans = nil
+		case (cmd == "end") || (cmd == "endblock"):
+			inTrees = false
+		case inTrees && (cmd == "translate"):
+			trans, err = l.readTranslate()
+			if err != nil {
+				return nil, fmt.Errorf("(nexus): translate: %v", err)
+			}
+			continue
+		case inTrees && ((cmd == "tree") || (cmd == "utree")):
+			name, err := l.next()
+			if (err == nil) && (name.val == "*") && !name.quoted {
+				name, err = l.next()
+			}
+			if err != nil {
+				return nil, fmt.Errorf("(nexus): tree: %v", err)
+			}
+			if name.kind != wordToken {
+				return nil, fmt.Errorf("(nexus) tree %d: expecting tree name", len(ts)+1)
+			}
+			if eq, err := l.next(); (err != nil) || !eq.isPunct('=') {
+				return nil, fmt.Errorf("(nexus) tree %s: expecting '='", name.val)
+			}
+			t, err := l.readTree(name.val, trans)
+			if err != nil {
+				if err == io.EOF {
+					err = io.ErrUnexpectedEOF
+				}
+				return nil, fmt.Errorf("(nexus) tree %s: %v", name.val, err)
+			}
+			ts = append(ts, t)
+			continue
+		}
+		if err := l.skipCommand(); err != nil {
+			return nil, fmt.Errorf("(nexus): %v", err)
+		}
+	}
+	if len(ts) == 0 {
+		return nil, errors.New("(nexus): no trees")
+	}
+	return ts, nil
+}
+
+// WriteNewick writes a tree in parenthetical (Newick) format, ended by a
+// semicolon, with the length of the branches, and the node identifiers as
+// labels of the internal nodes.
+func (t *Tree) WriteNewick(out io.Writer) error {
+	_, err := fmt.Fprintf(out, "%s\r\n", t.Newick(nil))
+	return err
+}
+
+// WriteNexus writes one or more trees as the TREES block of a NEXUS file.
+// Each tree is written as in WriteNewick.
+func WriteNexus(out io.Writer, ts []*Tree) error {
+	if _, err := fmt.Fprintf(out, "#NEXUS\r\n\r\nbegin trees;\r\n"); err != nil {
+		return err
+	}
+	for _, t := range ts {
+		if _, err := fmt.Fprintf(out, "\ttree %s = [&R] %s\r\n", Label(t.ID), t.Newick(nil)); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(out, "end;\r\n")
+	return err
+}
+
+// Newick returns a tree in parenthetical (Newick) format, ended by a
+// semicolon, with the length of the branches, and the node identifiers as
+// labels of the internal nodes. If annot is not nil, it is called with each
+// node, and the returned string, if not empty, is written as a comment
+// after the label of the node (e.g. the '&key=value' annotations used by
+// FigTree).
+func (t *Tree) Newick(annot func(n *Node) string) string {
+	var b bytes.Buffer
+	writeNode(&b, t.Root, annot)
+	b.WriteByte(';')
+	return b.String()
+}
+
+// writeNode writes a node, and its descendants, in parenthetical format.
+func writeNode(b *bytes.Buffer, n *Node, annot func(n *Node) string) {
+	if n.First != nil {
+		b.WriteByte('(')
+		for d := n.First; d != nil; d = d.Sister {
+			if d != n.First {
+				b.WriteByte(',')
+			}
+			writeNode(b, d, annot)
+		}
+		b.WriteByte(')')
+		b.WriteString(Label(n.ID))
+	} else {
+		b.WriteString(Label(n.Term))
+	}
+	if annot != nil {
+		if a := annot(n); len(a) > 0 {
+			b.WriteString("[" + a + "]")
+		}
+	}
+	if n.Anc != nil {
+		b.WriteString(":" + strconv.FormatFloat(n.Len, 'f', -1, 64))
+	}
+}
+
+// Label returns a name formatted as a label of a parenthetical or NEXUS
+// file. Spaces are transformed into underlines, and names with
+// punctuation, brackets, quotes or underlines are quoted.
+func Label(name string) string {
+	if (len(name) == 0) || strings.ContainsAny(name, punct+"[]'_\t\r\n") {
+		return "'" + strings.Replace(name, "'", "''", -1) + "'"
+	}
+	return strings.Replace(name, " ", "_", -1)
+}
+
+// Token kinds.
+const (
+	punctToken = iota
+	wordToken
+)
+
+// A token is a token of a parenthetical or NEXUS file.
+type token struct {
+	kind   int
+	val    string
+	quoted bool
+}
+
+// isPunct returns true if the token is the indicated punctuation.
+func (tk token) isPunct(p rune) bool {
+	return (tk.kind == punctToken) && (tk.val == string(p))
+}
+
+// name returns the token as a taxon name: whitespace is collapsed, and in
+// unquoted words, underlines are transformed into spaces.
+func (tk token) name() string {
+	v := tk.val
+	if !tk.quoted {
+		v = strings.Replace(v, "_", " ", -1)
+	}
+	return strings.Join(strings.Fields(v), " ")
+}
+
+// punctuation characters of a parenthetical or NEXUS file.
+const punct = "(),:;="
+
+// A lexer reads the tokens of a parenthetical or NEXUS file.
+type lexer struct {
+	r   *bufio.Reader
+	buf *token // a token read with peek
+}
+
+func newLexer(in io.Reader) *lexer {
+	return &lexer{r: bufio.NewReader(in)}
+}
+
+// peek returns the next token, without consuming it.
+func (l *lexer) peek() (token, error) {
+	tk, err := l.next()
+	if err != nil {
+		return tk, err
+	}
+	l.buf = &tk
+	return tk, nil
+}
+
+// next returns the next token, ignoring comments.
+func (l *lexer) next() (token, error) {
+	if l.buf != nil {
+		tk := *l.buf
+		l.buf = nil
+		return tk, nil
+	}
+	for {
+		r1, _, err := l.r.ReadRune()
+		if err != nil {
+			return token{}, err
+		}
+		if unicode.IsSpace(r1) {
+			continue
+		}
+		if r1 == '[' {
+			if err := l.skipComment(); err != nil {
+				return token{}, err
+			}
+			continue
+		}
+		if strings.ContainsRune(punct, r1) {
+			return token{kind: punctToken, val: string(r1)}, nil
+		}
+		if r1 == '\'' {
+			s, err := l.readQuoted()
+			if err != nil {
+				return token{}, err
+			}
+			return token{kind: wordToken, val: s, quoted: true}, nil
+		}
+		l.r.UnreadRune()
+		return token{kind: wordToken, val: l.readWord()}, nil
+	}
+}
+
+// skipComment skips a comment (the opening bracket was already read).
+// Comments can be nested.
+func (l *lexer) skipComment() error {
+	depth := 1
+	for depth > 0 {
+		r1, _, err := l.r.ReadRune()
+		if err != nil {
+			return errors.New("unclosed comment")
+		}
+		switch r1 {
+		case '[':
+			depth++
+		case ']':
+			depth--
+		}
+	}
+	return nil
+}
+
+// readQuoted reads a quoted word (the opening quote was already read). Two
+// single quotes are read as a single quote.
+func (l *lexer) readQuoted() (string, error) {
+	var s []rune
+	for {
+		r1, _, err := l.r.ReadRune()
+		if err != nil {
+			return "", errors.New("unclosed quote")
+		}
+		if r1 == '\'' {
+			r2, _, err := l.r.ReadRune()
+			if (err == nil) && (r2 == '\'') {
+				s = append(s, r1)
+				continue
+			}
+			if err == nil {
+				l.r.UnreadRune()
+			}
+			break
+		}
+		s = append(s, r1)
+	}
+	return string(s), nil
+}
+
+// readWord reads an unquoted word.
+func (l *lexer) readWord() string {
+	var s []rune
+	for {
+		r1, _, err := l.r.ReadRune()
+		if err != nil {
+			break
+		}
+		if unicode.IsSpace(r1) || (r1 == '[') || strings.ContainsRune(punct, r1) {
+			l.r.UnreadRune()
+			break
+		}
+		s = append(s, r1)
+	}
+	return string(s)
+}
+
+// skipCommand skips the tokens up to the end of a NEXUS command.
+func (l *lexer) skipCommand() error {
+	for {
+		tk, err := l.next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if tk.isPunct(';') {
+			return nil
+		}
+	}
+}
+
+// readTranslate reads the pairs of the TRANSLATE command of a NEXUS file.
+func (l *lexer) readTranslate() (map[string]string, error) {
+	trans := make(map[string]string)
+	for {
+		key, err := l.next()
+		if err != nil {
+			return nil, err
+		}
+		if key.isPunct(';') {
+			break
+		}
+		if key.kind != wordToken {
+			return nil, fmt.Errorf("unexpected %q", key.val)
+		}
+		val, err := l.next()
+		if err != nil {
+			return nil, err
+		}
+		if val.kind != wordToken {
+			return nil, fmt.Errorf("token %s: undefined name", key.val)
+		}
+		trans[key.val] = val.name()
+		sep, err := l.next()
+		if err != nil {
+			return nil, err
+		}
+		if sep.isPunct(';') {
+			break
+		}
+		if !sep.isPunct(',') {
+			return nil, fmt.Errorf("unexpected %q", sep.val)
+		}
+	}
+	return trans, nil
+}
+
+// readTree reads a tree in parenthetical format, up to the semicolon that
+// ends the tree (or the end of the input). Tokens before the first
+// parenthesis are ignored. If trans is defined, terminals are named using
+// the translation table. It returns io.EOF if there are no more trees.
+func (l *lexer) readTree(id string, trans map[string]string) (*Tree, error) {
+	for {
+		tk, err := l.next()
+		if err != nil {
+			return nil, err
+		}
+		if tk.isPunct('(') {
+			break
+		}
+	}
+	t := &Tree{ID: id}
+	n, err := t.parseNode(l, nil, trans)
+	if err != nil {
+		return nil, err
+	}
+	t.Root = n
+
+	// the label and length of the root are ignored
+	for {
+		tk, err := l.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if tk.isPunct(';') {
+			break
+		}
+		if tk.isPunct('(') || tk.isPunct(')') || tk.isPunct(',') {
+			return nil, fmt.Errorf("unexpected %q after the root", tk.val)
+		}
+	}
+	t.SetAges()
+	return t, nil
+}
+
+// parseNode reads an internal node in parenthetical format (the opening
+// parenthesis was already read).
+func (t *Tree) parseNode(l *lexer, anc *Node, trans map[string]string) (*Node, error) {
+	n := t.addNode(anc, "")
+	num := 0
+	var last *Node
+	for {
+		tk, err := l.next()
+		if err == io.EOF {
+			return nil, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return nil, err
+		}
+		if tk.isPunct(')') {
+			break
+		}
+		if tk.isPunct(',') {
+			continue
+		}
+		var desc *Node
+		switch {
+		case tk.isPunct('('):
+			desc, err = t.parseNode(l, n, trans)
+			if err != nil {
+				return nil, err
+			}
+			// the label of an internal node (e.g. a support value)
+			// is ignored
+			if _, err := l.suffix(true); err != nil {
+				return nil, err
+			}
+		case tk.kind == wordToken:
+			nm := tk.name()
+			if v, ok := trans[tk.val]; ok {
+				nm = v
+			}
+			if len(nm) == 0 {
+				return nil, errors.New("empty taxon name (just underlines)")
+			}
+			desc = t.addNode(n, nm)
+		default:
+			return nil, fmt.Errorf("unexpected %q", tk.val)
+		}
+		ln, err := l.suffix(false)
+		if err != nil {
+			return nil, err
+		}
+		if ln >= 0 {
+			desc.Len = ln
+		}
+		num++
+		if last != nil {
+			last.Sister = desc
+		} else {
+			n.First = desc
+		}
+		last = desc
+	}
+	if num < 2 {
+		return nil, fmt.Errorf("node %d with too few descendants", num)
+	}
+	return n, nil
+}
+
+// addNode adds a new node to the tree.
+func (t *Tree) addNode(anc *Node, term string) *Node {
+	n := &Node{
+		Index: len(t.Nodes),
+		ID:    strconv.FormatInt(int64(len(t.Nodes)), 10),
+		Anc:   anc,
+		Term:  term,
+		Len:   1,
+	}
+	t.Nodes = append(t.Nodes, n)
+	return n
+}
+
+// suffix reads the optional label (if label is true) or the optional
+// branch length after a node. It returns the branch length, or -1 if the
+// length is not defined.
+func (l *lexer) suffix(label bool) (float64, error) {
+	tk, err := l.peek()
+	if err == io.EOF {
+		return -1, io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return -1, err
+	}
+	if label {
+		if tk.kind == wordToken {
+			l.next()
+		}
+		return -1, nil
+	}
+	if !tk.isPunct(':') {
+		return -1, nil
+	}
+	l.next()
+	v, err := l.next()
+	if err == io.EOF {
+		return -1, io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return -1, err
+	}
+	ln, err := strconv.ParseFloat(v.val, 64)
+	if err != nil {
+		return -1, fmt.Errorf("branch length: %v", err)
+	}
+	return ln, nil
+}
@@ -0,0 +1,142 @@
+// Copyright (c) 2015, J. Salvador Arias <jsalarias@csnat.unt.edu.ar>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package tree
+
+import (
+	"strings"
+	"testing"
+)
+
+// terms returns the terminals of a tree, in the order found.
+func terms(t *Tree) []string {
+	var ls []string
+	for _, n := range t.Nodes {
+		if len(n.Term) > 0 {
+			ls = append(ls, n.Term)
+		}
+	}
+	return ls
+}
+
+func TestReadParenthetic(t *testing.T) {
+	tr, err := ReadParenthetic(strings.NewReader("tree = ((Aus_bus:0.5,'Aus  cus')95:2,Dus_eus[&height=1]);"), "t1")
+	if err != nil {
+		t.Fatalf("read error: %v", err)
+	}
+	if len(tr.Nodes) != 5 {
+		t.Fatalf("nodes error: expecting 5 nodes, found %d", len(tr.Nodes))
+	}
+	want := []string{"Aus bus", "Aus cus", "Dus eus"}
+	if got := terms(tr); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("terminals error: expecting %v, found %v", want, got)
+	}
+	if ln := tr.Nodes[1].Len; ln != 2 {
+		t.Errorf("length error: expecting 2, found %.2f", ln)
+	}
+	if ln := tr.Nodes[2].Len; ln != 0.5 {
+		t.Errorf("length error: expecting 0.5, found %.2f", ln)
+	}
+	if ln := tr.Nodes[4].Len; ln != 1 {
+		t.Errorf("length error: expecting default length, found %.2f", ln)
+	}
+
+	for _, s := range []string{"((a,b),c", "((a),b);", "(a,b:x);"} {
+		if _, err := ReadParenthetic(strings.NewReader(s), "t1"); err == nil {
+			t.Errorf("read error: expecting error on %q", s)
+		}
+	}
+}
+
+func TestReadNewick(t *testing.T) {
+	ts, err := ReadNewick(strings.NewReader("((a,b),c);\n(a,(b,c));\n((a,c),b);\n"), "mp")
+	if err != nil {
+		t.Fatalf("read error: %v", err)
+	}
+	if len(ts) != 3 {
+		t.Fatalf("trees error: expecting 3 trees, found %d", len(ts))
+	}
+	if ts[2].ID != "mp3" {
+		t.Errorf("id error: expecting mp3, found %s", ts[2].ID)
+	}
+	if got := terms(ts[1]); strings.Join(got, ",") != "a,b,c" {
+		t.Errorf("terminals error: found %v", got)
+	}
+}
+
+func TestReadNexus(t *testing.T) {
+	data := `#NEXUS
+[written by a program]
+begin taxa;
+	dimensions ntax=3;
+	taxlabels Aus_bus 'Aus cus' Dus_eus;
+end;
+
+begin trees;
+	translate
+		1 Aus_bus,
+		2 'Aus cus',
+		3 Dus_eus
+	;
+	tree STATE_0 = [&R] ((1[&rate=1.0]:0.1,2:0.2)[&posterior=0.9]:0.3,3:0.4);
+	tree STATE_1000 = [&R] (1:0.1,(2:0.2,3:0.3):0.4);
+end;
+`
+	ts, err := ReadNexus(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("read error: %v", err)
+	}
+	if len(ts) != 2 {
+		t.Fatalf("trees error: expecting 2 trees, found %d", len(ts))
+	}
+	if (ts[0].ID != "STATE_0") || (ts[1].ID != "STATE_1000") {
+		t.Errorf("id error: found %s, %s", ts[0].ID, ts[1].ID)
+	}
+	want := []string{"Aus bus", "Aus cus", "Dus eus"}
+	if got := terms(ts[0]); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("terminals error: expecting %v, found %v", want, got)
+	}
+	if ln := ts[0].Nodes[2].Len; ln != 0.1 {
+		t.Errorf("length error: expecting 0.1, found %.2f", ln)
+	}
+
+	if _, err := ReadNexus(strings.NewReader("((a,b),c);")); err == nil {
+		t.Errorf("read error: expecting error on a file without NEXUS header")
+	}
+}
+
+func TestWriteNewick(t *testing.T) {
+	tr, err := ReadParenthetic(strings.NewReader("((Aus_bus:0.5,'Aus cus''s':2):1.25,'Dus_eus');"), "t1")
+	if err != nil {
+		t.Fatalf("read error: %v", err)
+	}
+	want := "((Aus_bus:0.5,'Aus cus''s':2)1:1.25,'Dus_eus':1)0;"
+	if s := tr.Newick(nil); s != want {
+		t.Errorf("newick error: expecting %q, found %q", want, s)
+	}
+	s := tr.Newick(func(n *Node) string {
+		if n.First == nil {
+			return ""
+		}
+		return "&id=" + n.ID
+	})
+	want = "((Aus_bus:0.5,'Aus cus''s':2)1[&id=1]:1.25,'Dus_eus':1)0[&id=0];"
+	if s != want {
+		t.Errorf("newick error: expecting %q, found %q", want, s)
+	}
+
+	// the output is read back as the same tree
+	nt, err := ReadParenthetic(strings.NewReader(s), "t1")
+	if err != nil {
+		t.Fatalf("read error: %v", err)
+	}
+	if got, exp := terms(nt), terms(tr); strings.Join(got, ",") != strings.Join(exp, ",") {
+		t.Errorf("round-trip error: expecting %v, found %v", exp, got)
+	}
+	for i, n := range tr.Nodes {
+		if nt.Nodes[i].Len != n.Len {
+			t.Errorf("round-trip error: node %d: expecting length %.2f, found %.2f", i, n.Len, nt.Nodes[i].Len)
+		}
+	}
+}
@@ -0,0 +1,428 @@
+// Copyright (c) 2015, J. Salvador Arias <jsalarias@csnat.unt.edu.ar>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package tree
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Most operations that modify the topology of a tree renumber its nodes
+// in preorder: the index of each node is its position in the Nodes slice.
+// The identifiers of the nodes are kept, so a reconstruction of the
+// original tree refers to the same clades. Only the nodes created by an
+// operation (e.g. the new root of a rerooted tree) take a new identifier.
+
+// normName returns the form of a name used for comparisons.
+func normName(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+// Terminal returns the terminal of a tree with a given name, or nil if
+// there is no terminal with that name.
+func (t *Tree) Terminal(name string) *Node {
+	nm := normName(name)
+	for _, n := range t.Nodes {
+		if (len(n.Term) > 0) && (normName(n.Term) == nm) {
+			return n
+		}
+	}
+	return nil
+}
+
+// terminals returns the terminal nodes of a list of names.
+func (t *Tree) terminals(names []string) ([]*Node, error) {
+	if len(names) == 0 {
+		return nil, errors.New("empty list of terminals")
+	}
+	var ls []*Node
+	for _, nm := range names {
+		n := t.Terminal(nm)
+		if n == nil {
+			return nil, fmt.Errorf("tree %s: terminal %s not found", t.ID, nm)
+		}
+		ls = append(ls, n)
+	}
+	return ls, nil
+}
+
+// MRCA returns the most recent common ancestor of a set of terminals.
+func (t *Tree) MRCA(names []string) (*Node, error) {
+	ls, err := t.terminals(names)
+	if err != nil {
+		return nil, err
+	}
+	return mrca(ls), nil
+}
+
+// mrca returns the most recent common ancestor of a set of nodes.
+func mrca(ls []*Node) *Node {
+	var path []*Node
+	pos := make(map[*Node]int)
+	for n := ls[0]; n != nil; n = n.Anc {
+		pos[n] = len(path)
+		path = append(path, n)
+	}
+	max := 0
+	for _, n := range ls[1:] {
+		for ; n != nil; n = n.Anc {
+			if p, ok := pos[n]; ok {
+				if p > max {
+					max = p
+				}
+				break
+			}
+		}
+	}
+	return path[max]
+}
+
+// numTerms returns the number of terminals descendant of a node.
+func numTerms(n *Node) int {
+	if n.First == nil {
+		return 1
+	}
+	num := 0
+	for d := n.First; d != nil; d = d.Sister {
+		num += numTerms(d)
+	}
+	return num
+}
+
+// Copy returns a copy of a tree. The nodes of the copy are stored in
+// preorder, and keep the identifiers of the original tree.
+func (t *Tree) Copy() *Tree {
+	c := &Tree{ID: t.ID, Dated: t.Dated}
+	c.Root = c.copyNode(t.Root, nil)
+	return c
+}
+
+// copyNode adds a copy of node n, and its descendants, to the tree.
+func (t *Tree) copyNode(n, anc *Node) *Node {
+	c := &Node{
+		Index: len(t.Nodes),
+		ID:    n.ID,
+		Anc:   anc,
+		Len:   n.Len,
+		Term:  n.Term,
+		Age:   n.Age,
+	}
+	t.Nodes = append(t.Nodes, c)
+	var last *Node
+	for d := n.First; d != nil; d = d.Sister {
+		cd := t.copyNode(d, c)
+		if last == nil {
+			c.First = cd
+		} else {
+			last.Sister = cd
+		}
+		last = cd
+	}
+	return c
+}
+
+// Subtree returns a new tree with the clade defined by the most recent
+// common ancestor of a set of terminals. The nodes of the new tree are
+// renumbered, and keep the identifiers of the original tree.
+func (t *Tree) Subtree(names []string, id string) (*Tree, error) {
+	m, err := t.MRCA(names)
+	if err != nil {
+		return nil, err
+	}
+	if m.First == nil {
+		return nil, fmt.Errorf("tree %s: subtree with a single terminal", t.ID)
+	}
+	s := &Tree{ID: id, Dated: t.Dated}
+	s.Root = s.copyNode(m, nil)
+	s.reindex()
+	return s, nil
+}
+
+// Prune removes a set of terminals from a tree. Internal nodes left with
+// a single descendant are removed, and its branch length is added to the
+// branch of its descendant. The nodes of the tree are renumbered.
+func (t *Tree) Prune(names []string) error {
+	ls, err := t.terminals(names)
+	if err != nil {
+		return err
+	}
+	rm := make(map[*Node]bool)
+	for _, n := range ls {
+		rm[n] = true
+	}
+	if numTerms(t.Root)-len(rm) < 2 {
+		return fmt.Errorf("tree %s: pruned tree with less than 2 terminals", t.ID)
+	}
+	for n := range rm {
+		t.remove(n)
+	}
+	t.reindex()
+	return nil
+}
+
+// remove removes a node from the tree.
+func (t *Tree) remove(n *Node) {
+	a := n.Anc
+	removeDesc(a, n)
+	switch {
+	case a.First == nil:
+		t.remove(a)
+	case a.First.Sister == nil:
+		// collapse the ancestor
+		d := a.First
+		if a.Anc == nil {
+			d.Anc = nil
+			d.Len = a.Len
+			t.Root = d
+			return
+		}
+		d.Len += a.Len
+		replaceDesc(a.Anc, a, d)
+	}
+}
+
+// removeDesc removes the descendant d of node n.
+func removeDesc(n, d *Node) {
+	if n.First == d {
+		n.First = d.Sister
+	} else {
+		for s := n.First; s != nil; s = s.Sister {
+			if s.Sister == d {
+				s.Sister = d.Sister
+				break
+			}
+		}
+	}
+	d.Anc = nil
+	d.Sister = nil
+}
+
+// replaceDesc replaces the descendant old of node n with nd.
+func replaceDesc(n, old, nd *Node) {
+	nd.Anc = n
+	nd.Sister = old.Sister
+	if n.First == old {
+		n.First = nd
+	} else {
+		for s := n.First; s != nil; s = s.Sister {
+			if s.Sister == old {
+				s.Sister = nd
+				break
+			}
+		}
+	}
+	old.Anc = nil
+	old.Sister = nil
+}
+
+// An edge is a connection between nodes of an unrooted tree.
+type edge struct {
+	n   *Node
+	len float64
+}
+
+// Reroot roots the tree at the branch that separates a set of terminals
+// (the outgroup) from the rest of the tree. The length of that branch is
+// divided in equal parts between the two descendants of the new root. The
+// outgroup must be monophyletic in the unrooted tree. The nodes of the tree
+// are renumbered, and the new root takes an unused identifier.
+func (t *Tree) Reroot(out []string) error {
+	ls, err := t.terminals(out)
+	if err != nil {
+		return err
+	}
+	o := mrca(ls)
+	if o == t.Root {
+		// the outgroup includes the root, so the tree is rooted at the
+		// clade of the ingroup
+		in := make(map[*Node]bool)
+		for _, n := range ls {
+			in[n] = true
+		}
+		var ig []*Node
+		for _, n := range t.Nodes {
+			if (n.First == nil) && !in[n] {
+				ig = append(ig, n)
+			}
+		}
+		if len(ig) == 0 {
+			return fmt.Errorf("tree %s: outgroup includes all terminals", t.ID)
+		}
+		ls = ig
+		o = mrca(ls)
+		if o == t.Root {
+			return fmt.Errorf("tree %s: outgroup is not monophyletic", t.ID)
+		}
+	}
+	set := make(map[*Node]bool)
+	for _, n := range ls {
+		set[n] = true
+	}
+	if numTerms(o) != len(set) {
+		return fmt.Errorf("tree %s: outgroup is not monophyletic", t.ID)
+	}
+
+	// builds the unrooted tree
+	adj := make(map[*Node][]edge)
+	for _, n := range t.Nodes {
+		if n.Anc == nil {
+			continue
+		}
+		adj[n] = append(adj[n], edge{n.Anc, n.Len})
+		adj[n.Anc] = append(adj[n.Anc], edge{n, n.Len})
+	}
+	root := t.Root
+	if (root.First != nil) && (root.First.Sister != nil) && (root.First.Sister.Sister == nil) {
+		// a binary root is removed
+		l, r := root.First, root.First.Sister
+		delete(adj, root)
+		adj[l] = replaceEdge(adj[l], root, edge{r, l.Len + r.Len})
+		adj[r] = replaceEdge(adj[r], root, edge{l, l.Len + r.Len})
+	}
+
+	// the new root is placed at the branch between the outgroup and
+	// its neighbour
+	p := adj[o][0]
+	for _, e := range adj[o] {
+		if e.n == o.Anc {
+			p = e
+			break
+		}
+	}
+	nr := &Node{Len: root.Len}
+	adj[o] = replaceEdge(adj[o], p.n, edge{nr, p.len / 2})
+	adj[p.n] = replaceEdge(adj[p.n], o, edge{nr, p.len / 2})
+	adj[nr] = []edge{{o, p.len / 2}, {p.n, p.len / 2}}
+
+	nr.Anc = nil
+	nr.Sister = nil
+	nr.ID = t.newID()
+	link(nr, nil, adj)
+	t.Root = nr
+	// the ages of a rerooted tree are calculated from the branch lengths
+	t.Dated = false
+	t.reindex()
+	return nil
+}
+
+// replaceEdge replaces the edge to node n in a list of edges.
+func replaceEdge(ls []edge, n *Node, e edge) []edge {
+	for i := range ls {
+		if ls[i].n == n {
+			ls[i] = e
+			break
+		}
+	}
+	return ls
+}
+
+// link sets the descendants of node n from the edges of an unrooted tree,
+// ignoring the edge to the node from, which is the ancestor of n.
+func link(n, from *Node, adj map[*Node][]edge) {
+	n.First = nil
+	var last *Node
+	for _, e := range adj[n] {
+		if e.n == from {
+			continue
+		}
+		d := e.n
+		d.Anc = n
+		d.Len = e.len
+		d.Sister = nil
+		if last == nil {
+			n.First = d
+		} else {
+			last.Sister = d
+		}
+		last = d
+		link(d, n, adj)
+	}
+}
+
+// Ladderize sorts the descendants of each node by the number of its
+// terminals, from the smallest to the largest clade. The nodes of the tree
+// are renumbered.
+func (t *Tree) Ladderize() {
+	ladderize(t.Root)
+	t.reindex()
+}
+
+// ladderize sorts the descendants of a node, and returns the number of
+// terminals of the node.
+func ladderize(n *Node) int {
+	if n.First == nil {
+		return 1
+	}
+	var desc []*Node
+	num := make(map[*Node]int)
+	total := 0
+	for d := n.First; d != nil; d = d.Sister {
+		desc = append(desc, d)
+		num[d] = ladderize(d)
+		total += num[d]
+	}
+	sort.SliceStable(desc, func(i, j int) bool {
+		return num[desc[i]] < num[desc[j]]
+	})
+	n.First = desc[0]
+	for i, d := range desc {
+		d.Sister = nil
+		if i > 0 {
+			desc[i-1].Sister = d
+		}
+	}
+	return total
+}
+
+// RenameTerminal changes the name of a terminal.
+func (t *Tree) RenameTerminal(old, name string) error {
+	n := t.Terminal(old)
+	if n == nil {
+		return fmt.Errorf("tree %s: terminal %s not found", t.ID, old)
+	}
+	name = strings.Join(strings.Fields(name), " ")
+	if len(name) == 0 {
+		return fmt.Errorf("tree %s: empty terminal name", t.ID)
+	}
+	if o := t.Terminal(name); (o != nil) && (o != n) {
+		return fmt.Errorf("tree %s: terminal %s already in the tree", t.ID, name)
+	}
+	n.Term = name
+	return nil
+}
+
+// reindex renumbers the nodes of a tree in preorder, keeping its
+// identifiers. If the tree is not dated, the node ages are updated.
+func (t *Tree) reindex() {
+	t.Nodes = t.Nodes[:0]
+	t.addPreorder(t.Root)
+	if !t.Dated {
+		t.SetAges()
+	}
+}
+
+// addPreorder adds a node, and its descendants, to the node list.
+func (t *Tree) addPreorder(n *Node) {
+	n.Index = len(t.Nodes)
+	t.Nodes = append(t.Nodes, n)
+	for d := n.First; d != nil; d = d.Sister {
+		t.addPreorder(d)
+	}
+}
+
+// newID returns an identifier not used by the nodes of the tree: the
+// largest numeric identifier of the tree plus one.
+func (t *Tree) newID() string {
+	max := len(t.Nodes) - 1
+	for _, n := range t.Nodes {
+		if v, err := strconv.Atoi(n.ID); (err == nil) && (v > max) {
+			max = v
+		}
+	}
+	return strconv.Itoa(max + 1)
+}
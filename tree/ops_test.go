@@ -0,0 +1,134 @@
+// Copyright (c) 2015, J. Salvador Arias <jsalarias@csnat.unt.edu.ar>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package tree
+
+import (
+	"strings"
+	"testing"
+)
+
+// checkIndex checks that the index of each node is its position in the
+// node list, and that ancestors are before its descendants.
+func checkIndex(t *testing.T, tr *Tree) {
+	for i, n := range tr.Nodes {
+		if n.Index != i {
+			t.Errorf("index error: tree %s, node %d with index %d", tr.ID, i, n.Index)
+		}
+		if (n.Anc != nil) && (n.Anc.Index >= i) {
+			t.Errorf("index error: tree %s, node %d after its ancestor", tr.ID, i)
+		}
+	}
+	if tr.Nodes[0] != tr.Root {
+		t.Errorf("index error: tree %s, root is not the first node", tr.ID)
+	}
+}
+
+func readTest(t *testing.T, s string) *Tree {
+	tr, err := ReadParenthetic(strings.NewReader(s), "t1")
+	if err != nil {
+		t.Fatalf("read error: %v", err)
+	}
+	return tr
+}
+
+func TestPrune(t *testing.T) {
+	tr := readTest(t, "((a:1,b:1):2,(c:1,(d:1,e:1):3):1);")
+	if err := tr.Prune([]string{"b", "d"}); err != nil {
+		t.Fatalf("prune error: %v", err)
+	}
+	checkIndex(t, tr)
+	want := "(a:3,(c:1,e:4)4:1)0;"
+	if s := tr.Newick(nil); s != want {
+		t.Errorf("prune error: expecting %q, found %q", want, s)
+	}
+	if err := tr.Prune([]string{"a", "c"}); err == nil {
+		t.Errorf("prune error: expecting error on a tree with a single terminal")
+	}
+	if err := tr.Prune([]string{"x"}); err == nil {
+		t.Errorf("prune error: expecting error on an undefined terminal")
+	}
+}
+
+func TestReroot(t *testing.T) {
+	tr := readTest(t, "((a:1,b:1):2,(c:1,(d:1,e:1):3):1);")
+	if err := tr.Reroot([]string{"d", "e"}); err != nil {
+		t.Fatalf("reroot error: %v", err)
+	}
+	checkIndex(t, tr)
+	// the new root takes an unused ID
+	want := "((d:1,e:1)6:1.5,((a:1,b:1)1:3,c:1)4:1.5)9;"
+	if s := tr.Newick(nil); s != want {
+		t.Errorf("reroot error: expecting %q, found %q", want, s)
+	}
+
+	// an outgroup that includes the root
+	tr = readTest(t, "((a:1,b:1):2,(c:1,(d:1,e:1):3):1);")
+	if err := tr.Reroot([]string{"a", "b", "c"}); err != nil {
+		t.Fatalf("reroot error: %v", err)
+	}
+	checkIndex(t, tr)
+	if m, _ := tr.MRCA([]string{"a", "b", "c"}); m.Anc != tr.Root {
+		t.Errorf("reroot error: outgroup is not a descendant of the root")
+	}
+
+	if err := tr.Reroot([]string{"a", "d"}); err == nil {
+		t.Errorf("reroot error: expecting error on a non monophyletic outgroup")
+	}
+}
+
+func TestLadderize(t *testing.T) {
+	tr := readTest(t, "(((a,b),c),d);")
+	tr.Ladderize()
+	checkIndex(t, tr)
+	want := "(d:1,(c:1,(a:1,b:1)2:1)1:1)0;"
+	if s := tr.Newick(nil); s != want {
+		t.Errorf("ladderize error: expecting %q, found %q", want, s)
+	}
+
+	// the nodes keep its IDs
+	ids := map[string]string{"a,b": "2", "a,c": "1", "a,d": "0", "d": "6"}
+	for ts, id := range ids {
+		var n *Node
+		if terms := strings.Split(ts, ","); len(terms) == 1 {
+			n = tr.Terminal(terms[0])
+		} else {
+			n, _ = tr.MRCA(terms)
+		}
+		if n.ID != id {
+			t.Errorf("ladderize error: node of %s: expecting ID %s, found %s", ts, id, n.ID)
+		}
+	}
+}
+
+func TestSubtree(t *testing.T) {
+	tr := readTest(t, "((a,b),(c,(d,e)));")
+	s, err := tr.Subtree([]string{"c", "e"}, "sub")
+	if err != nil {
+		t.Fatalf("subtree error: %v", err)
+	}
+	checkIndex(t, s)
+	if got := terms(s); strings.Join(got, ",") != "c,d,e" {
+		t.Errorf("subtree error: found %v", got)
+	}
+	if len(tr.Nodes) != 9 {
+		t.Errorf("subtree error: original tree modified")
+	}
+	if _, err := tr.Subtree([]string{"c"}, "sub"); err == nil {
+		t.Errorf("subtree error: expecting error on a single terminal")
+	}
+}
+
+func TestRenameTerminal(t *testing.T) {
+	tr := readTest(t, "((Aus_bus,b),c);")
+	if err := tr.RenameTerminal("aus bus", "Aus  cus"); err != nil {
+		t.Fatalf("rename error: %v", err)
+	}
+	if tr.Terminal("Aus cus") == nil {
+		t.Errorf("rename error: terminal not renamed")
+	}
+	if err := tr.RenameTerminal("b", "c"); err == nil {
+		t.Errorf("rename error: expecting error on a duplicated name")
+	}
+}
@@ -5,14 +5,12 @@
 package tree
 
 import (
-	"bufio"
 	"encoding/csv"
 	"errors"
 	"fmt"
 	"io"
 	"strconv"
 	"strings"
-	"unicode"
 )
 
 // A Node is a node of a phylogenetic tree.
@@ -24,21 +22,27 @@ type Node struct {
 	First  *Node
 	Len    float64
 	Term   string
+	Age    float64
 }
 
-// A Tree is a phylogenetic tree.
+// A Tree is a phylogenetic tree. If Dated is true, the ages of the nodes
+// were set explicitly (e.g. read from the trees file), otherwise, they are
+// calculated from the branch lengths.
 type Tree struct {
 	ID    string
 	Root  *Node
 	Nodes []*Node
+	Dated bool
 }
 
-// Read reads one or more trees in tsv format from an input stream.
+// Read reads one or more trees in tsv format from an input stream. If the
+// input has an age column, and all the nodes of a tree have an age, the
+// tree is dated, and the nodes without a branch length take its length
+// from the ages.
 func Read(in io.Reader) ([]*Tree, error) {
 	var tr []*Tree
 	r := csv.NewReader(in)
 	r.Comma = '\t'
-	r.TrimLeadingSpace = true
 
 	// reads the file header
 	h, err := r.Read()
@@ -50,8 +54,9 @@ func Read(in io.Reader) ([]*Tree, error) {
 	anc := -1
 	term := -1
 	lenF := -1
+	ageF := -1
 	for i, v := range h {
-		switch strings.ToLower(v) {
+		switch strings.ToLower(strings.TrimSpace(v)) {
 		case "tree":
 			tree = i
 		case "node id", "node":
@@ -62,6 +67,8 @@ func Read(in io.Reader) ([]*Tree, error) {
 			term = i
 		case "length", "len":
 			lenF = i
+		case "age":
+			ageF = i
 		}
 	}
 	if (tree < 0) || (node < 0) || (anc < 0) || (term < 0) {
@@ -73,6 +80,9 @@ func Read(in io.Reader) ([]*Tree, error) {
 	tids := make(map[string]*Tree)
 	// map of tree-id:map of node-id:node-index
 	tn := make(map[string]map[string]int)
+	// nodes with an age, and nodes without a length
+	hasAge := make(map[*Node]bool)
+	noLen := make(map[*Node]bool)
 	for i := 1; ; i++ {
 		row, err := r.Read()
 		if err != nil {
@@ -81,6 +91,11 @@ func Read(in io.Reader) ([]*Tree, error) {
 			}
 			return nil, fmt.Errorf("(tree) row %d: %v", i, err)
 		}
+		// leading spaces are not trimmed by the csv reader, as the
+		// tab is also a space, and empty fields will be lost
+		for j := range row {
+			row[j] = strings.TrimSpace(row[j])
+		}
 		if lr := len(row); (lr <= tree) || (lr <= node) || (lr <= anc) || (lr <= term) {
 			continue
 		}
@@ -107,6 +122,9 @@ func Read(in io.Reader) ([]*Tree, error) {
 				ID:    row[node],
 				Len:   1,
 			}
+			if err := readAge(row, ageF, n, hasAge); err != nil {
+				return nil, fmt.Errorf("(tree) row %d: %v", i, err)
+			}
 			t.Root = n
 			ids[n.ID] = n.Index
 			t.Nodes = append(t.Nodes, n)
@@ -125,10 +143,12 @@ func Read(in io.Reader) ([]*Tree, error) {
 			tx = strings.Join(strings.Fields(row[term]), " ")
 		}
 		ln := float64(1)
-		if (lenF != -1) && (len(row[lenF]) > 0) {
+		defLen := false
+		if (lenF != -1) && (len(row) > lenF) && (len(row[lenF]) > 0) {
 			if l, err := strconv.ParseFloat(row[lenF], 64); err == nil {
 				if l >= 0 {
 					ln = l
+					defLen = true
 				}
 			}
 		}
@@ -139,6 +159,12 @@ func Read(in io.Reader) ([]*Tree, error) {
 			Term:  tx,
 			Len:   ln,
 		}
+		if !defLen {
+			noLen[n] = true
+		}
+		if err := readAge(row, ageF, n, hasAge); err != nil {
+			return nil, fmt.Errorf("(tree) row %d: %v", i, err)
+		}
 		if a.First != nil {
 			for d := a.First; ; d = d.Sister {
 				if d.Sister == nil {
@@ -152,18 +178,57 @@ func Read(in io.Reader) ([]*Tree, error) {
 		ids[n.ID] = n.Index
 		t.Nodes = append(t.Nodes, n)
 	}
+
+	// node ages
+	for _, t := range tr {
+		num := 0
+		for _, n := range t.Nodes {
+			if hasAge[n] {
+				num++
+			}
+		}
+		if num == 0 {
+			t.SetAges()
+			continue
+		}
+		if num < len(t.Nodes) {
+			return nil, fmt.Errorf("(tree) tree %s: %d nodes without age", t.ID, len(t.Nodes)-num)
+		}
+		if err := t.setLenFromAges(noLen); err != nil {
+			return nil, fmt.Errorf("(tree) %v", err)
+		}
+		t.Dated = true
+	}
 	return tr, nil
 }
 
+// readAge reads the age of a node from a row.
+func readAge(row []string, ageF int, n *Node, hasAge map[*Node]bool) error {
+	if (ageF < 0) || (len(row) <= ageF) || (len(row[ageF]) == 0) {
+		return nil
+	}
+	a, err := strconv.ParseFloat(row[ageF], 64)
+	if err != nil {
+		return fmt.Errorf("node %s: age: %v", n.ID, err)
+	}
+	if a < 0 {
+		return fmt.Errorf("node %s: invalid age %g", n.ID, a)
+	}
+	n.Age = a
+	hasAge[n] = true
+	return nil
+}
+
 // Write writes a tree as csv into an output stream. If header is false, it
-// will not print the column names (the header).
+// will not print the column names (the header). The ages of the nodes are
+// written only if the tree is dated.
 func (t *Tree) Write(out io.Writer, header bool) error {
 	w := csv.NewWriter(out)
 	w.Comma = '\t'
 	w.UseCRLF = true
 	defer w.Flush()
 	if header {
-		err := w.Write([]string{"Tree", "Node", "Ancestor", "Length", "Terminal"})
+		err := w.Write([]string{"Tree", "Node", "Ancestor", "Length", "Terminal", "Age"})
 		if err != nil {
 			return err
 		}
@@ -179,6 +244,10 @@ func (t *Tree) Write(out io.Writer, header bool) error {
 			anc,
 			strconv.FormatFloat(n.Len, 'f', 6, 64),
 			n.Term,
+			"",
+		}
+		if t.Dated {
+			rec[5] = strconv.FormatFloat(n.Age, 'f', 6, 64)
 		}
 		err := w.Write(rec)
 		if err != nil {
@@ -187,197 +256,3 @@ func (t *Tree) Write(out io.Writer, header bool) error {
 	}
 	return nil
 }
-
-// ReadParenthetic reads a single tree in parenthetical format.
-func ReadParenthetic(in io.Reader, id string) (*Tree, error) {
-	r := bufio.NewReader(in)
-	for {
-		r1, _, err := r.ReadRune()
-		if err != nil {
-			return nil, fmt.Errorf("(tree): %v", err)
-		}
-		if r1 == '(' {
-			break
-		}
-	}
-	t := &Tree{ID: id}
-	n, err := t.readNode(r, nil)
-	if err != nil {
-		return nil, fmt.Errorf("(tree): %v", err)
-	}
-	t.Root = n
-	return t, nil
-}
-
-// readNode reads a node in parenthetical format.
-func (t *Tree) readNode(r *bufio.Reader, anc *Node) (*Node, error) {
-	n := &Node{
-		Index: len(t.Nodes),
-		ID:    strconv.FormatInt(int64(len(t.Nodes)), 10),
-		Anc:   anc,
-		Len:   1,
-	}
-	t.Nodes = append(t.Nodes, n)
-	num := 0
-	var last, desc *Node
-	for {
-		r1, _, err := r.ReadRune()
-		if err != nil {
-			return nil, err
-		}
-		if unicode.IsSpace(r1) {
-			continue
-		}
-		if r1 == ',' {
-			continue
-		}
-		if r1 == ':' {
-			if last == nil {
-				return nil, errors.New("unexpected branch length")
-			}
-			ln, err := readLen(r)
-			if err != nil {
-				return nil, err
-			}
-			if ln >= 0 {
-				last.Len = ln
-			}
-			continue
-		}
-		if r1 == '(' {
-			desc, err = t.readNode(r, n)
-			if err != nil {
-				return nil, err
-			}
-			num++
-			if last != nil {
-				last.Sister = desc
-			} else {
-				n.First = desc
-			}
-			last = desc
-			continue
-		}
-		if r1 == ')' {
-			break
-		}
-		// a terminal
-		r.UnreadRune()
-		tx, err := readTerm(r)
-		if err != nil {
-			return nil, err
-		}
-		desc = &Node{
-			Index: len(t.Nodes),
-			ID:    strconv.FormatInt(int64(len(t.Nodes)), 10),
-			Anc:   n,
-			Term:  tx,
-			Len:   1,
-		}
-		t.Nodes = append(t.Nodes, desc)
-		num++
-		if last != nil {
-			last.Sister = desc
-		} else {
-			n.First = desc
-		}
-		last = desc
-	}
-	if num < 2 {
-		return nil, fmt.Errorf("node %d with too few descendants", num)
-	}
-	return n, nil
-}
-
-// readTerm reads a terminal from a tree string.
-func readTerm(r *bufio.Reader) (string, error) {
-	r1, _, _ := r.ReadRune()
-	if r1 == '\'' {
-		return readBlock(r, '\'')
-	}
-	r.UnreadRune()
-	var nm []rune
-	first := true
-	space := false
-	for {
-		r1, _, err := r.ReadRune()
-		if err != nil {
-			return "", err
-		}
-		if unicode.IsSpace(r1) || (r1 == ',') {
-			break
-		}
-		if (r1 == '(') || (r1 == ')') || (r1 == ':') {
-			r.UnreadRune()
-			break
-		}
-		if r1 == '_' {
-			space = true
-			continue
-		}
-		if space {
-			if !first {
-				nm = append(nm, ' ')
-			}
-			space = false
-		}
-		first = false
-		nm = append(nm, r1)
-	}
-	if len(nm) == 0 {
-		return "", errors.New("empty taxon name (just underlines)")
-	}
-	return string(nm), nil
-}
-
-// readBlock reads a string inside a block.
-func readBlock(r *bufio.Reader, delim rune) (string, error) {
-	var s []rune
-	first := true
-	space := false
-	for {
-		r1, _, err := r.ReadRune()
-		if err != nil {
-			return "", err
-		}
-		if r1 == delim {
-			break
-		}
-		if unicode.IsSpace(r1) {
-			space = true
-			continue
-		}
-		if space {
-			if !first {
-				s = append(s, ' ')
-			}
-			space = false
-		}
-		first = false
-		s = append(s, r1)
-	}
-	if len(s) == 0 {
-		return "", errors.New("empty block string")
-	}
-	return string(s), nil
-}
-
-// readLen reads the lenght of the node, if defined.
-func readLen(r *bufio.Reader) (float64, error) {
-	var s []rune
-	for {
-		r1, _, err := r.ReadRune()
-		if err != nil {
-			return 0, err
-		}
-		if unicode.IsSpace(r1) || (r1 == ',') {
-			break
-		}
-		if (r1 == '(') || (r1 == ')') {
-			r.UnreadRune()
-			break
-		}
-		s = append(s, r1)
-	}
-	return strconv.ParseFloat(string(s), 64)
-}
@@ -0,0 +1,121 @@
+// Copyright (c) 2015, J. Salvador Arias <jsalarias@csnat.unt.edu.ar>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package tree
+
+// Kinds of problems found in a tree.
+const (
+	UnaryNode   = "unary node"
+	ZeroLength  = "zero length"
+	DupTerminal = "duplicated terminal"
+	NoData      = "terminal without data"
+)
+
+// A Problem is a problem found in a node of a tree.
+type Problem struct {
+	Node *Node
+	Kind string
+}
+
+// Validate returns the problems found in a tree: internal nodes with a
+// single descendant, branches (other than the root) with a length of zero
+// or less, and terminals with a name already used in the tree. If hasData
+// is not nil, it is used to check if a terminal has data.
+func (t *Tree) Validate(hasData func(term string) bool) []Problem {
+	var ps []Problem
+	names := make(map[string]bool)
+	for _, n := range t.Nodes {
+		if (n.First != nil) && (n.First.Sister == nil) {
+			ps = append(ps, Problem{n, UnaryNode})
+		}
+		if (n.Anc != nil) && (n.Len <= 0) {
+			ps = append(ps, Problem{n, ZeroLength})
+		}
+		if n.First != nil {
+			continue
+		}
+		nm := normName(n.Term)
+		if names[nm] {
+			ps = append(ps, Problem{n, DupTerminal})
+			continue
+		}
+		names[nm] = true
+		if (hasData != nil) && !hasData(n.Term) {
+			ps = append(ps, Problem{n, NoData})
+		}
+	}
+	return ps
+}
+
+// CollapseUnary removes the internal nodes with a single descendant. The
+// branch length of a removed node is added to the branch of its
+// descendant. It returns the number of removed nodes. If a node is removed,
+// the nodes of the tree are renumbered.
+func (t *Tree) CollapseUnary() int {
+	var un []*Node
+	for _, n := range t.Nodes {
+		if (n.First != nil) && (n.First.Sister == nil) {
+			un = append(un, n)
+		}
+	}
+	for _, n := range un {
+		d := n.First
+		removeDesc(n, d)
+		if n.Anc == nil {
+			d.Len = n.Len
+			t.Root = d
+			continue
+		}
+		d.Len += n.Len
+		replaceDesc(n.Anc, n, d)
+	}
+	if len(un) > 0 {
+		t.reindex()
+	}
+	return len(un)
+}
+
+// SetMinLen sets the length of the branches (other than the root) shorter
+// than min to min. It returns the number of modified branches. If the tree
+// is not dated, the node ages are updated.
+func (t *Tree) SetMinLen(min float64) int {
+	num := 0
+	for _, n := range t.Nodes {
+		if (n.Anc != nil) && (n.Len < min) {
+			n.Len = min
+			num++
+		}
+	}
+	if (num > 0) && !t.Dated {
+		t.SetAges()
+	}
+	return num
+}
+
+// DropDuplicates removes the terminals with a name already used in the
+// tree, keeping the first terminal with that name. It returns the number
+// of removed terminals. If a terminal is removed, the nodes of the tree
+// are renumbered.
+func (t *Tree) DropDuplicates() int {
+	var dup []*Node
+	names := make(map[string]bool)
+	for _, n := range t.Nodes {
+		if n.First != nil {
+			continue
+		}
+		nm := normName(n.Term)
+		if names[nm] {
+			dup = append(dup, n)
+			continue
+		}
+		names[nm] = true
+	}
+	for _, n := range dup {
+		t.remove(n)
+	}
+	if len(dup) > 0 {
+		t.reindex()
+	}
+	return len(dup)
+}
@@ -0,0 +1,63 @@
+// Copyright (c) 2015, J. Salvador Arias <jsalarias@csnat.unt.edu.ar>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package tree
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	data := "Tree\tNode\tAncestor\tLength\tTerminal\r\n" +
+		"t1\t0\t-1\t1\t\r\n" +
+		"t1\t1\t0\t1\t\r\n" +
+		"t1\t2\t1\t2\t\r\n" +
+		"t1\t3\t2\t1\ta\r\n" +
+		"t1\t4\t2\t0\tb\r\n" +
+		"t1\t5\t0\t1\tc\r\n" +
+		"t1\t6\t0\t1\tA\r\n"
+	ts, err := Read(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("read error: %v", err)
+	}
+	tr := ts[0]
+	ps := tr.Validate(func(term string) bool { return term != "c" })
+	want := []struct {
+		id   string
+		kind string
+	}{
+		{"1", UnaryNode},
+		{"4", ZeroLength},
+		{"5", NoData},
+		{"6", DupTerminal},
+	}
+	if len(ps) != len(want) {
+		t.Fatalf("validate error: expecting %d problems, found %v", len(want), ps)
+	}
+	for i, p := range ps {
+		if (p.Node.ID != want[i].id) || (p.Kind != want[i].kind) {
+			t.Errorf("validate error: problem %d: expecting %v, found node %s, %s", i, want[i], p.Node.ID, p.Kind)
+		}
+	}
+
+	if n := tr.CollapseUnary(); n != 1 {
+		t.Errorf("collapse error: expecting 1 node, found %d", n)
+	}
+	if n := tr.SetMinLen(0.5); n != 1 {
+		t.Errorf("minimum length error: expecting 1 branch, found %d", n)
+	}
+	if n := tr.DropDuplicates(); n != 1 {
+		t.Errorf("duplicates error: expecting 1 terminal, found %d", n)
+	}
+	checkIndex(t, tr)
+	if ps := tr.Validate(nil); len(ps) != 0 {
+		t.Errorf("validate error: expecting no problems, found %v", ps)
+	}
+	// the descendant of the collapsed node keeps its ID
+	want2 := "((a:1,b:0.5)2:3,c:1)0;"
+	if s := tr.Newick(nil); s != want2 {
+		t.Errorf("repair error: expecting %q, found %q", want2, s)
+	}
+}
@@ -88,8 +88,10 @@ func arrow(x int, y int, top bool) string {
 	return fmt.Sprintf("%d,%d %d,%d %d,%d", x-2, y, x+2, y, x, y2)
 }
 
-// SVG creates an svg version of a list of trees.
-func SVG(ts []*tree.Tree, recs []*events.Recons, stepX, stepY int, useLen bool) error {
+// SVG creates an svg version of a list of trees. If ps is not nil, the
+// vertical line of each internal node of a dated tree is drawn with the
+// color of the period that includes the age of the node.
+func SVG(ts []*tree.Tree, recs []*events.Recons, stepX, stepY int, useLen bool, ps []tree.Period) error {
 	if stepX <= 0 {
 		stepX = 10
 	}
@@ -170,6 +172,9 @@ func SVG(ts []*tree.Tree, recs []*events.Recons, stepX, stepY int, useLen bool)
 			ln.Attr[0].Value = ln.Attr[2].Value
 			ln.Attr[1].Value = strconv.FormatInt(int64(tv.Nodes[i].TopY), 10)
 			ln.Attr[3].Value = strconv.FormatInt(int64(tv.Nodes[i].BotY), 10)
+			if cl := periodColor(ps, t, t.Nodes[i]); len(cl) > 0 {
+				ln.Attr = append(ln.Attr, xml.Attr{Name: xml.Name{Local: "stroke"}, Value: cl})
+			}
 			e.EncodeToken(ln)
 			e.EncodeToken(ln.End())
 		}
@@ -281,6 +286,9 @@ func SVG(ts []*tree.Tree, recs []*events.Recons, stepX, stepY int, useLen bool)
 			ln.Attr[0].Value = ln.Attr[2].Value
 			ln.Attr[1].Value = strconv.FormatInt(int64(tv.Nodes[i].TopY), 10)
 			ln.Attr[3].Value = strconv.FormatInt(int64(tv.Nodes[i].BotY), 10)
+			if cl := periodColor(ps, t, t.Nodes[i]); len(cl) > 0 {
+				ln.Attr = append(ln.Attr, xml.Attr{Name: xml.Name{Local: "stroke"}, Value: cl})
+			}
 			e.EncodeToken(ln)
 			e.EncodeToken(ln.End())
 
@@ -328,7 +336,7 @@ func SVG(ts []*tree.Tree, recs []*events.Recons, stepX, stepY int, useLen bool)
 					},
 				}
 				p := rc.Rec[i].SetL
-				if tv.Nodes[p].Y > tv.Nodes[i].Y {
+				if p = realNode(rc, p); tv.Nodes[p].Y > tv.Nodes[i].Y {
 					circ.Attr[1].Value = strconv.FormatInt(int64(tv.Nodes[i].Y+4), 10)
 				}
 				e.EncodeToken(circ)
@@ -346,7 +354,7 @@ func SVG(ts []*tree.Tree, recs []*events.Recons, stepX, stepY int, useLen bool)
 					},
 				}
 				p := rc.Rec[i].SetR
-				if tv.Nodes[p].Y > tv.Nodes[i].Y {
+				if p = realNode(rc, p); tv.Nodes[p].Y > tv.Nodes[i].Y {
 					circ.Attr[1].Value = strconv.FormatInt(int64(tv.Nodes[i].Y+4), 10)
 				}
 				e.EncodeToken(circ)
@@ -362,7 +370,7 @@ func SVG(ts []*tree.Tree, recs []*events.Recons, stepX, stepY int, useLen bool)
 					},
 				}
 				f := rc.Rec[i].SetL
-				if tv.Nodes[f].Y > tv.Nodes[i].Y {
+				if f = realNode(rc, f); tv.Nodes[f].Y > tv.Nodes[i].Y {
 					poly.Attr[0].Value = arrow(int(tv.Nodes[i].X), tv.Nodes[i].Y+2, false)
 				} else {
 					poly.Attr[0].Value = arrow(int(tv.Nodes[i].X), tv.Nodes[i].Y-2, true)
@@ -380,7 +388,7 @@ func SVG(ts []*tree.Tree, recs []*events.Recons, stepX, stepY int, useLen bool)
 					},
 				}
 				f := rc.Rec[i].SetR
-				if tv.Nodes[f].Y > tv.Nodes[i].Y {
+				if f = realNode(rc, f); tv.Nodes[f].Y > tv.Nodes[i].Y {
 					poly.Attr[0].Value = arrow(int(tv.Nodes[i].X), tv.Nodes[i].Y+2, false)
 				} else {
 					poly.Attr[0].Value = arrow(int(tv.Nodes[i].X), tv.Nodes[i].Y-2, true)
@@ -396,3 +404,27 @@ func SVG(ts []*tree.Tree, recs []*events.Recons, stepX, stepY int, useLen bool)
 	}
 	return nil
 }
+
+// realNode returns the index of a node of the tree for node n of a
+// reconstruction. If n is a nested node of a polytomy, it returns the first
+// descendant in the tree of the nested node.
+func realNode(rc *events.Recons, n int) int {
+	for n >= len(rc.Tree.Nodes) {
+		n = rc.Rec[n].SetL
+	}
+	return n
+}
+
+// periodColor returns the color of the period that includes the age of
+// a node, or an empty string if the tree is not dated, there is no such
+// period, or the period has no color.
+func periodColor(ps []tree.Period, t *tree.Tree, n *tree.Node) string {
+	if (ps == nil) || !t.Dated {
+		return ""
+	}
+	p := tree.PeriodOf(ps, n.Age)
+	if p == nil {
+		return ""
+	}
+	return p.Color
+}
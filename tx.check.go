@@ -0,0 +1,203 @@
+// Copyright (c) 2015, J. Salvador Arias <jsalarias@csnat.unt.edu.ar>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/js-arias/evs/biogeo"
+	"github.com/js-arias/evs/cmdapp"
+	"github.com/js-arias/evs/raster"
+	"github.com/js-arias/evs/tree"
+)
+
+var txCheck = &cmdapp.Command{
+	Run: txCheckRun,
+	UsageLine: `tx.check [--dist number] [--maps file] [--ranges file]
+	[--rangesName name]`,
+	Short: "check the names of the terminals",
+	Long: `
+Tx.check compares the names of the terminals of the trees in the 'trees.tab'
+file with the names of the taxa in the 'records.tab' file, and prints the
+terminals without data, and the taxa without terminals. Names are compared
+after the synonyms in the 'synonyms.tab' file (if any) are replaced by its
+accepted names.
+
+For each unmatched name, the unmatched names of the other file that are
+likely a different spelling are proposed as matches: names that are the
+same without the authorship, names with the same words in a different order
+(e.g. a genus/epithet swap), and names with a small edit distance.
+
+The output is a tab table with the following columns:
+	Kind	'terminal' for terminals without data, 'taxon' for taxa
+		without terminals
+	Name	Name of the unmatched terminal or taxon
+	Match	A proposed match (if any)
+	Reason	The reason of the proposed match: 'authorship', 'swap' or
+		'distance' followed by the edit distance
+
+Options are:
+
+    --dist number
+      Set the maximum edit distance between two names to be proposed as a
+      match. Default = 2.
+
+    --maps file
+      Includes the taxa with presence maps in the indicated manifest file.
+
+    --ranges file
+      Includes the taxa with range polygons in the indicated GeoJSON file.
+
+    --rangesName name
+      Sets the property of the features of the ranges file used as the
+      name of the taxon. By default, the first property found of 'name',
+      'scientificName', 'binomial', 'sci_name' or 'species' is used.
+	`,
+}
+
+var maxDist int // --dist
+
+func init() {
+	txCheck.Flag.IntVar(&maxDist, "dist", 2, "")
+	txCheck.Flag.StringVar(&rangeFls, "ranges", "", "")
+	txCheck.Flag.StringVar(&rangesName, "rangesName", "", "")
+	txCheck.Flag.StringVar(&mapsFile, "maps", "", "")
+}
+
+func txCheckRun(c *cmdapp.Command, args []string) {
+	d, err := rasterData()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
+		os.Exit(1)
+	}
+	ts, err := loadTrees()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
+		os.Exit(1)
+	}
+	syn, err := loadSynonyms()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
+		os.Exit(1)
+	}
+
+	// terminals without data
+	terms := termNames(ts)
+	var noData []string
+	inTree := make(map[string]bool)
+	for _, tm := range terms {
+		acc := syn.Accepted(tm)
+		inTree[strings.ToLower(acc)] = true
+		if d.Taxon(acc) == nil {
+			noData = append(noData, tm)
+		}
+	}
+
+	// taxa without terminals
+	var noTerm []string
+	for _, tx := range d.Ls {
+		if !inTree[strings.ToLower(tx.Name)] {
+			noTerm = append(noTerm, tx.Name)
+		}
+	}
+
+	w := csv.NewWriter(os.Stdout)
+	w.Comma = '\t'
+	w.UseCRLF = true
+	defer w.Flush()
+	if err := w.Write([]string{"Kind", "Name", "Match", "Reason"}); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
+		os.Exit(1)
+	}
+	for _, v := range []struct {
+		kind  string
+		names []string
+		other []string
+	}{
+		{"terminal", noData, noTerm},
+		{"taxon", noTerm, noData},
+	} {
+		for _, nm := range v.names {
+			ms := biogeo.Suggest(nm, v.other, maxDist)
+			if len(ms) == 0 {
+				if err := w.Write([]string{v.kind, nm, "", ""}); err != nil {
+					fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
+					os.Exit(1)
+				}
+				continue
+			}
+			for _, m := range ms {
+				reason := m.Reason
+				if m.Reason == biogeo.DistMatch {
+					reason += " " + strconv.Itoa(m.Dist)
+				}
+				if err := w.Write([]string{v.kind, nm, m.Name, reason}); err != nil {
+					fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name(), err)
+					os.Exit(1)
+				}
+			}
+		}
+	}
+}
+
+// termNames returns the names of the terminals of a set of trees, in the
+// order found.
+func termNames(ts []*tree.Tree) []string {
+	var terms []string
+	found := make(map[string]bool)
+	for _, t := range ts {
+		for _, n := range t.Nodes {
+			if len(n.Term) == 0 {
+				continue
+			}
+			if found[strings.ToLower(n.Term)] {
+				continue
+			}
+			found[strings.ToLower(n.Term)] = true
+			terms = append(terms, n.Term)
+		}
+	}
+	return terms
+}
+
+// checkTerms returns an error if there are terminals of the trees without
+// data in the raster. The error includes the proposed matches of each
+// terminal among the taxa of the raster without terminals.
+func checkTerms(ts []*tree.Tree, r *raster.Raster) error {
+	terms := termNames(ts)
+	inTree := make(map[string]bool)
+	var noData []string
+	for _, tm := range terms {
+		tx := r.Taxon(tm)
+		if tx == nil {
+			noData = append(noData, tm)
+			continue
+		}
+		inTree[strings.ToLower(tx.Name)] = true
+	}
+	if len(noData) == 0 {
+		return nil
+	}
+	var noTerm []string
+	for _, tx := range r.Names {
+		if !inTree[strings.ToLower(tx.Name)] {
+			noTerm = append(noTerm, tx.Name)
+		}
+	}
+	msg := make([]string, 0, len(noData))
+	for _, tm := range noData {
+		ms := biogeo.Suggest(tm, noTerm, 2)
+		if len(ms) == 0 {
+			msg = append(msg, tm)
+			continue
+		}
+		msg = append(msg, fmt.Sprintf("%s (did you mean %s?)", tm, ms[0].Name))
+	}
+	return fmt.Errorf("%d terminals without data: %s", len(noData), strings.Join(msg, ", "))
+}